@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/database"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/storage"
+)
+
+// import reads a Slack or Discord export straight from disk, without uploading it to the server:
+//
+//	go run ./cmd/import -config config/local.yaml -source slack -file export.zip -owner 1
+//
+// Running it again with the same export continues where the last run stopped.
+func main() {
+	source := flag.String("source", "", "slack or discord")
+	file := flag.String("file", "", "path to the export zip, or a Discord json file")
+	owner := flag.Int("owner", 0, "id of the user who owns the imported rooms")
+
+	// loading queries
+	queryManager, err := database.NewQueryManager()
+	if err != nil {
+		log.Fatalf("Failed to load SQL queries: %v", err)
+	}
+
+	// load config, this parses the flags when -config is used
+	cfg := config.ConfigMustLoad()
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	if *file == "" || *owner == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// database setup
+	database.InitDB(cfg.DatabaseUri)
+	defer database.CloseDB()
+
+	auditRepo := repositories.NewAuditRepository(database.DB)
+	auditService := services.NewAuditService(auditRepo)
+
+	fileStorage, err := storage.NewCloudinary(cfg.Cloudinary)
+	if err != nil {
+		log.Fatalf("Failed to setup file storage: %v", err)
+	}
+
+	chatRepo := repositories.NewChatRepository(database.DB, queryManager)
+	joinRequestRepo := repositories.NewJoinRequestRepository(database.DB)
+	chatService := services.NewChatService(chatRepo, joinRequestRepo, auditService, fileStorage)
+
+	accountRepo := repositories.NewAccountRepository(database.DB)
+	identityRepo := repositories.NewIdentityRepository(database.DB)
+
+	importRepo := repositories.NewImportRepository(database.DB)
+	importService := services.NewImportService(importRepo, identityRepo, accountRepo, chatService, auditService, fileStorage, cfg.Uploads)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats, err := importService.Import(ctx, cfg.Imports, *source, *file, *owner, func(stats *models.ImportStats) {
+		slog.Info("importing", slog.Int("rooms", stats.Rooms), slog.Int("users", stats.Users),
+			slog.Int("messages", stats.Messages), slog.Int("files", stats.Files), slog.Int("skipped", stats.Skipped))
+	})
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	fmt.Printf("imported %d rooms, %d users, %d messages and %d files, skipped %d messages\n",
+		stats.Rooms, stats.Users, stats.Messages, stats.Files, stats.Skipped)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
@@ -16,9 +17,15 @@ import (
 	"github.com/gauravst/real-time-chat/internal/api/middleware"
 	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/database"
+	"github.com/gauravst/real-time-chat/internal/jobs"
+	"github.com/gauravst/real-time-chat/internal/mailer"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/repositories"
 	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/storage"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
+	"github.com/gauravst/real-time-chat/internal/utils/unfurl"
 	"github.com/gorilla/websocket"
 )
 
@@ -36,28 +43,93 @@ func main() {
 	database.InitDB(cfg.DatabaseUri)
 	defer database.CloseDB()
 
+	// token signing keys
+	keys, err := loadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load jwt keys: %v", err)
+	}
+
+	// file storage
+	fileStorage, err := storage.NewCloudinary(cfg.Cloudinary)
+	if err != nil {
+		log.Fatalf("Failed to setup file storage: %v", err)
+	}
+
 	// Initialize repositories and services
+	auditRepo := repositories.NewAuditRepository(database.DB)
+	auditService := services.NewAuditService(auditRepo)
+
 	userRepo := repositories.NewUserRepository(database.DB)
-	userService := services.NewUserService(userRepo)
+	userService := services.NewUserService(userRepo, auditService, fileStorage)
+
+	twoFactorRepo := repositories.NewTwoFactorRepository(database.DB)
+	twoFactorService := services.NewTwoFactorService(twoFactorRepo)
+
+	apiTokenRepo := repositories.NewApiTokenRepository(database.DB)
+	apiTokenService := services.NewApiTokenService(apiTokenRepo)
 
 	authRepo := repositories.NewAuthRepository(database.DB)
-	authService := services.NewAuthService(authRepo)
+	authService := services.NewAuthService(authRepo, twoFactorService, auditService, keys)
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to setup mailer: %v", err)
+	}
+
+	accountRepo := repositories.NewAccountRepository(database.DB)
+	accountService := services.NewAccountService(accountRepo, mail)
+
+	identityRepo := repositories.NewIdentityRepository(database.DB)
+	// a provider that hangs must not hold logins forever
+	oidcClient := &http.Client{Timeout: 10 * time.Second}
+	oidcService := services.NewOIDCService(authService, identityRepo, cfg.OIDCProviders, oidcClient, keys)
 
 	chatRepo := repositories.NewChatRepository(database.DB, queryManager)
-	chatService := services.NewChatService(chatRepo)
+	joinRequestRepo := repositories.NewJoinRequestRepository(database.DB)
+	chatService := services.NewChatService(chatRepo, joinRequestRepo, auditService, fileStorage)
+	joinRequestService := services.NewJoinRequestService(joinRequestRepo)
+
+	pinRepo := repositories.NewPinRepository(database.DB)
+	pinService := services.NewPinService(pinRepo, chatRepo, joinRequestRepo, auditService, cfg.Rooms.MaxPins)
+
+	retentionRepo := repositories.NewRetentionRepository(database.DB)
+	retentionService := services.NewRetentionService(retentionRepo, auditService, fileStorage)
+
+	exportRepo := repositories.NewExportRepository(database.DB)
+	exportService := services.NewExportService(exportRepo, chatRepo, auditService, fileStorage)
+
+	importRepo := repositories.NewImportRepository(database.DB)
+	importService := services.NewImportService(importRepo, identityRepo, accountRepo, chatService, auditService, fileStorage, cfg.Uploads)
+
+	blockRepo := repositories.NewBlockRepository(database.DB)
+	blockService := services.NewBlockService(blockRepo)
+
+	inviteRepo := repositories.NewInviteRepository(database.DB)
+	inviteService := services.NewInviteService(inviteRepo, chatRepo, blockService, auditService)
+
+	unfurlRepo := repositories.NewUnfurlRepository(database.DB)
+	unfurlFetcher := unfurl.New(cfg.Unfurl.Timeout, cfg.Unfurl.MaxBytes, cfg.Unfurl.UserAgent)
+	unfurlService := services.NewUnfurlService(unfurlRepo, auditService, unfurlFetcher, cfg.Unfurl)
 
 	fileRepo := repositories.NewFileRepository(database.DB, queryManager)
-	fileService := services.NewFileService(fileRepo, chatRepo)
+	fileService := services.NewFileService(fileRepo, chatRepo, blockService, unfurlService, fileStorage)
 
-	// Setup routers
+	profileRepo := repositories.NewProfileRepository(database.DB)
+	profileService := services.NewProfileService(profileRepo, fileStorage)
+
+	// Setup routers. Routes wrapped with RequireScope also accept personal access tokens,
+	// every other protected route needs a login session.
 	router := http.NewServeMux()
 	publicRouter := http.NewServeMux()
 	// publicRouter2 := http.NewServeMux()
 
 	wsServer := &models.WsServer{
 		RoomMutex:  &sync.Mutex{},
-		Rooms:      make(map[string][]*websocket.Conn),
-		OnlineUser: make(map[string]map[string]bool),
+		Rooms:      make(map[int][]*websocket.Conn),
+		OnlineUser: make(map[int]map[string]bool),
+		Sessions:   make(map[int][]*websocket.Conn),
+		ApiTokens:  make(map[int][]*websocket.Conn),
+		ConnUsers:  make(map[*websocket.Conn]int),
 		Upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
@@ -70,46 +142,125 @@ func main() {
 	})
 
 	// Public routes (No Auth)
+	publicRouter.HandleFunc("POST /api/auth/register", handlers.RegisterUser(authService, *cfg))
 	publicRouter.HandleFunc("POST /api/auth/login", handlers.LoginUser(authService, *cfg))
 	publicRouter.HandleFunc("POST /api/auth/loginWithoutAuth", handlers.LoginWithoutAuth(authService, *cfg))
+	publicRouter.HandleFunc("POST /api/auth/refresh", handlers.RefreshToken(authService, *cfg, wsServer))
+	publicRouter.HandleFunc("POST /api/auth/2fa", handlers.VerifyTwoFactor(authService, *cfg))
+	publicRouter.HandleFunc("POST /api/auth/email/verify", handlers.VerifyEmail(accountService))
+	publicRouter.HandleFunc("POST /api/auth/password/forgot", handlers.ForgotPassword(accountService, *cfg))
+	publicRouter.HandleFunc("POST /api/auth/password/reset", handlers.ResetPassword(accountService, *cfg, wsServer))
+
+	// single sign on
+	publicRouter.HandleFunc("GET /api/auth/oidc", handlers.GetOIDCProviders(oidcService))
+	publicRouter.HandleFunc("GET /api/auth/oidc/{provider}/login", handlers.OIDCLogin(oidcService, *cfg))
+	publicRouter.HandleFunc("GET /api/auth/oidc/{provider}/callback", handlers.OIDCCallback(oidcService, *cfg))
 
 	// Protected routes (Require Auth)
-	router.HandleFunc("GET /api/users", handlers.GetAllUsers(userService))
-	router.HandleFunc("GET /api/user", handlers.GetUser(userService))
-	router.HandleFunc("POST /api/user/logout", handlers.LogoutUser(authService))
-	router.HandleFunc("GET /api/user/{id}", handlers.GetUserById(userService))
+	router.HandleFunc("GET /api/users", middleware.RequireScope(services.ScopeUserRead, handlers.GetAllUsers(userService)))
+	router.HandleFunc("GET /api/user", middleware.RequireScope(services.ScopeUserRead, handlers.GetUser(userService, profileService)))
+	router.HandleFunc("POST /api/user/upgrade", handlers.UpgradeGuest(authService, *cfg))
+	router.HandleFunc("POST /api/user/logout", handlers.LogoutUser(authService, *cfg, wsServer))
+	router.HandleFunc("GET /api/user/identities", handlers.GetAllIdentities(oidcService))
+	router.HandleFunc("GET /api/user/identities/{provider}/link", handlers.LinkOIDCIdentity(oidcService, *cfg))
+	router.HandleFunc("GET /api/user/email", handlers.GetEmail(accountService))
+	router.HandleFunc("PUT /api/user/email", handlers.ChangeEmail(accountService, *cfg))
+	router.HandleFunc("POST /api/user/2fa/enroll", handlers.EnrollTwoFactor(twoFactorService, *cfg))
+	router.HandleFunc("POST /api/user/2fa/confirm", handlers.ConfirmTwoFactor(twoFactorService))
+	router.HandleFunc("DELETE /api/user/2fa", handlers.DisableTwoFactor(twoFactorService))
+	router.HandleFunc("GET /api/user/tokens", handlers.GetAllApiTokens(apiTokenService))
+	router.HandleFunc("POST /api/user/tokens", handlers.CreateApiToken(apiTokenService))
+	router.HandleFunc("DELETE /api/user/tokens/{id}", handlers.DeleteApiToken(apiTokenService, *cfg, wsServer))
+	router.HandleFunc("GET /api/user/sessions", handlers.GetAllSessions(authService))
+	router.HandleFunc("DELETE /api/user/sessions", handlers.RevokeOtherSessions(authService, *cfg, wsServer))
+	router.HandleFunc("DELETE /api/user/sessions/{id}", handlers.RevokeSession(authService, *cfg, wsServer))
+	router.HandleFunc("GET /api/user/blocks", handlers.GetAllBlocks(blockService))
+	router.HandleFunc("POST /api/user/blocks", handlers.BlockUser(blockService))
+	router.HandleFunc("DELETE /api/user/blocks/{id}", handlers.UnblockUser(blockService))
+	router.HandleFunc("GET /api/user/profile", middleware.RequireScope(services.ScopeUserRead, handlers.GetMyProfile(profileService)))
+	router.HandleFunc("PUT /api/user/profile", handlers.UpdateProfile(profileService))
+	router.HandleFunc("POST /api/user/profile/avatar", handlers.UploadAvatar(fileService, profileService))
+	router.HandleFunc("DELETE /api/user/profile/avatar", handlers.DeleteAvatar(profileService))
+	router.HandleFunc("GET /api/user/{id}/profile", middleware.RequireScope(services.ScopeUserRead, handlers.GetProfile(profileService)))
+	router.HandleFunc("GET /api/user/{id}/identicon", middleware.RequireScope(services.ScopeUserRead, handlers.GetIdenticon(profileService)))
+	router.HandleFunc("GET /api/user/{id}", middleware.RequireScope(services.ScopeUserRead, handlers.GetUserById(userService)))
 	router.HandleFunc("PUT /api/user/{id}", handlers.UpdateUser(userService))
 	router.HandleFunc("DELETE /api/user/{id}", handlers.DeleteUser(userService))
 
-	router.HandleFunc("GET /api/room", handlers.GetAllChatRoom(chatService))
-	router.HandleFunc("GET /api/room/{name}", handlers.GetChatRoomByName(chatService))
-	router.HandleFunc("GET /api/room/private/{code}", handlers.GetPrivateChatRoom(chatService))
-	router.HandleFunc("POST /api/room", handlers.CreateNewChatRoom(chatService))
-	router.HandleFunc("PUT /api/room/{name}", handlers.UpdateChatRoom(chatService))
-	router.HandleFunc("DELETE /api/room/{name}", handlers.DeleteChatRoom(chatService))
+	// admin
+	router.HandleFunc("GET /api/admin/audit", handlers.GetAuditEvents(auditService))
+	router.HandleFunc("GET /api/admin/audit/verify", handlers.VerifyAuditLog(auditService))
+	router.HandleFunc("GET /api/admin/metrics", handlers.GetMetrics())
+	router.HandleFunc("GET /api/admin/imports", handlers.GetAllImports(importService))
+	router.HandleFunc("POST /api/admin/imports", handlers.CreateImport(importService, *cfg))
+	router.HandleFunc("GET /api/admin/imports/{id}", handlers.GetImport(importService))
+	router.HandleFunc("POST /api/admin/imports/{id}/retry", handlers.RetryImport(importService))
+
+	router.HandleFunc("GET /api/room", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetAllChatRoom(chatService)))
+	router.HandleFunc("GET /api/room/{slug}", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetChatRoomBySlug(chatService, pinService)))
+	router.HandleFunc("GET /api/room/private/{code}", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetPrivateChatRoom(chatService, inviteService)))
+	router.HandleFunc("POST /api/room", middleware.RequireScope(services.ScopeRoomsWrite, handlers.CreateNewChatRoom(chatService)))
+	router.HandleFunc("PUT /api/room/{slug}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.UpdateChatRoom(chatService, wsServer)))
+	router.HandleFunc("DELETE /api/room/{slug}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.DeleteChatRoom(chatService, *cfg, wsServer)))
+	router.HandleFunc("POST /api/room/{slug}/archive", middleware.RequireScope(services.ScopeRoomsWrite, handlers.ArchiveChatRoom(chatService, true, *cfg, wsServer)))
+	router.HandleFunc("POST /api/room/{slug}/unarchive", middleware.RequireScope(services.ScopeRoomsWrite, handlers.ArchiveChatRoom(chatService, false, *cfg, wsServer)))
+	router.HandleFunc("PUT /api/room/{slug}/retention", middleware.RequireScope(services.ScopeRoomsWrite, handlers.SetRoomRetention(chatService, retentionService)))
+	router.HandleFunc("PUT /api/room/{slug}/unfurl", middleware.RequireScope(services.ScopeRoomsWrite, handlers.SetRoomUnfurl(chatService, unfurlService)))
+	router.HandleFunc("POST /api/room/{slug}/restore", middleware.RequireScope(services.ScopeRoomsWrite, handlers.RestoreChatRoom(chatService, *cfg)))
+
+	// room invites
+	router.HandleFunc("GET /api/room/{slug}/invites", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetAllInvites(chatService, inviteService)))
+	router.HandleFunc("POST /api/room/{slug}/invites", middleware.RequireScope(services.ScopeRoomsWrite, handlers.CreateInvite(chatService, inviteService)))
+	router.HandleFunc("DELETE /api/room/{slug}/invites/{id}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.RevokeInvite(chatService, inviteService)))
+
+	// history exports
+	router.HandleFunc("GET /api/room/{slug}/export", middleware.RequireScope(services.ScopeMessagesRead, handlers.StreamRoomExport(chatService, exportService)))
+	router.HandleFunc("POST /api/room/{slug}/exports", middleware.RequireScope(services.ScopeMessagesRead, handlers.CreateRoomExport(chatService, exportService)))
+	router.HandleFunc("GET /api/room/{slug}/exports/{id}", middleware.RequireScope(services.ScopeMessagesRead, handlers.GetRoomExport(chatService, exportService)))
+	router.HandleFunc("GET /api/room/{slug}/exports/{id}/download", middleware.RequireScope(services.ScopeMessagesRead, handlers.DownloadRoomExport(chatService, exportService)))
+
+	// pinned messages and topic
+	router.HandleFunc("GET /api/room/{slug}/pins", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetPinnedMessages(chatService, pinService)))
+	router.HandleFunc("POST /api/room/{slug}/pins/{id}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.PinMessage(chatService, pinService, wsServer)))
+	router.HandleFunc("DELETE /api/room/{slug}/pins/{id}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.UnpinMessage(chatService, pinService, wsServer)))
+	router.HandleFunc("PUT /api/room/{slug}/topic", middleware.RequireScope(services.ScopeRoomsWrite, handlers.SetRoomTopic(chatService, pinService, wsServer)))
+
+	// join requests
+	router.HandleFunc("GET /api/room/{slug}/requests", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetPendingJoinRequests(chatService, joinRequestService)))
+	router.HandleFunc("POST /api/room/{slug}/requests/{id}/approve", middleware.RequireScope(services.ScopeRoomsWrite, handlers.DecideJoinRequest(chatService, joinRequestService, true, wsServer)))
+	router.HandleFunc("POST /api/room/{slug}/requests/{id}/deny", middleware.RequireScope(services.ScopeRoomsWrite, handlers.DecideJoinRequest(chatService, joinRequestService, false, wsServer)))
+	router.HandleFunc("GET /api/join/requests", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetUserJoinRequests(joinRequestService)))
 
 	// Join room
-	router.HandleFunc("GET /api/join", handlers.GetAllJoinRoom(chatService))
-	router.HandleFunc("POST /api/join/{name}", handlers.JoinRoom(chatService))
-	router.HandleFunc("POST /api/join/private/{code}", handlers.JoinPrivateRoom(chatService))
-	router.HandleFunc("DELETE /api/join/{name}", handlers.LeaveRoom(chatService))
+	router.HandleFunc("GET /api/join", middleware.RequireScope(services.ScopeRoomsRead, handlers.GetAllJoinRoom(chatService)))
+	router.HandleFunc("POST /api/join/{slug}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.JoinRoom(chatService, wsServer)))
+	router.HandleFunc("POST /api/join/private/{code}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.JoinPrivateRoom(inviteService)))
+	router.HandleFunc("DELETE /api/join/{slug}", middleware.RequireScope(services.ScopeRoomsWrite, handlers.LeaveRoom(chatService)))
 
 	// WebSocket route
-	router.HandleFunc("/chat/{roomName}", handlers.LiveChat(chatService, *cfg, wsServer))
+	router.HandleFunc("/chat/{slug}", middleware.RequireScopes([]string{services.ScopeMessagesRead, services.ScopeMessagesWrite}, handlers.LiveChat(chatService, blockService, unfurlService, *cfg, wsServer)))
 
 	// upload files
-	router.HandleFunc("POST /api/chat/upload/{roomName}", handlers.UploadFileInRoom(fileService, *cfg, wsServer))
+	router.HandleFunc("POST /api/chat/upload/{slug}", middleware.RequireScope(services.ScopeFilesWrite, handlers.UploadFileInRoom(chatService, fileService, *cfg, wsServer)))
+	router.HandleFunc("GET /api/files/{id}", middleware.RequireScope(services.ScopeMessagesRead, handlers.GetFile(fileService, *cfg)))
 	// get old chats for a room
-	router.HandleFunc("GET /api/chat/{roomName}/{limit}", handlers.GetOldChats(chatService))
+	router.HandleFunc("GET /api/chat/{slug}/{limit}", middleware.RequireScope(services.ScopeMessagesRead, handlers.GetOldChats(chatService)))
 
 	// Merge both routers
 	mainRouter := http.NewServeMux()
-	mainRouter.Handle("/api/auth/", publicRouter)                     // Public routes (No Auth)
-	mainRouter.Handle("/", middleware.Auth(cfg, authService)(router)) // Protected routes
+	mainRouter.HandleFunc("GET /.well-known/jwks.json", handlers.GetJWKS(keys))              // Public keys for other services
+	mainRouter.Handle("/api/auth/", publicRouter)                                            // Public routes (No Auth)
+	mainRouter.Handle("/", middleware.Auth(cfg, authService, apiTokenService, keys)(router)) // Protected routes
 	// mainRouter.Handle("/chat/", publicRouter2)
 
+	// X-Forwarded-For is only read from these, anyone else could send any address
+	trustedProxies, err := clientinfo.ParseProxies(cfg.HTTPServer.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to read trusted proxies: %v", err)
+	}
+
 	// Wrap everything with CORS middleware
-	finalHandler := middleware.CORS(cfg)(mainRouter)
+	finalHandler := middleware.CORS(cfg)(middleware.RequestId(middleware.ClientIp(trustedProxies)(mainRouter)))
 
 	// Setup server
 	port := cfg.EnvPort
@@ -125,6 +276,87 @@ func main() {
 	}
 	slog.Info("server started", slog.String("address", cfg.Address))
 
+	// background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go jobs.Every(jobsCtx, "guest cleanup", cfg.Guests.CleanupInterval, func(ctx context.Context) error {
+		count, err := userService.CleanupGuests(cfg.Guests)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("inactive guests removed", slog.Int64("count", count))
+		return nil
+	})
+
+	go jobs.Every(jobsCtx, "room purge", cfg.Rooms.PurgeInterval, func(ctx context.Context) error {
+		count, err := chatService.PurgeDeletedRooms(cfg.Rooms.RestoreWindow)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("deleted rooms purged", slog.Int("count", count))
+		return nil
+	})
+
+	go jobs.Every(jobsCtx, "message retention", cfg.Retention.Interval, func(ctx context.Context) error {
+		result, err := retentionService.PurgeExpiredMessages(ctx, cfg.Retention)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("expired messages purged", slog.String("mode", cfg.Retention.Mode), slog.Int("messages", result.Messages),
+			slog.Int("files", result.Files), slog.Int("rooms", len(result.Rooms)))
+		return nil
+	})
+
+	go jobs.Every(jobsCtx, "room exports", cfg.Exports.PollInterval, func(ctx context.Context) error {
+		count, err := exportService.RunPendingExports(ctx, cfg.Exports)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			slog.Info("room exports written", slog.Int("count", count))
+		}
+		return nil
+	})
+
+	go jobs.Every(jobsCtx, "export cleanup", cfg.Exports.CleanupInterval, func(ctx context.Context) error {
+		count, err := exportService.DeleteExpiredExports(cfg.Exports)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("expired exports removed", slog.Int("count", count))
+		return nil
+	})
+
+	go unfurlService.Run(jobsCtx)
+
+	go jobs.Every(jobsCtx, "preview cleanup", cfg.Unfurl.CleanupInterval, func(ctx context.Context) error {
+		count, err := unfurlService.DeleteStalePreviews()
+		if err != nil {
+			return err
+		}
+
+		slog.Info("stale link previews removed", slog.Int64("count", count))
+		return nil
+	})
+
+	go jobs.Every(jobsCtx, "chat imports", cfg.Imports.PollInterval, func(ctx context.Context) error {
+		count, err := importService.RunPendingImports(ctx, cfg.Imports)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			slog.Info("chat imports finished", slog.Int("count", count))
+		}
+		return nil
+	})
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -138,6 +370,7 @@ func main() {
 	<-done
 
 	slog.Info("shutting down the server")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -149,3 +382,17 @@ func main() {
 
 	slog.Info("server shutdown successfully")
 }
+
+// loadKeySet reads the signing keys, dev falls back to a throwaway key so no setup is needed
+func loadKeySet(cfg *config.Config) (*jwtToken.KeySet, error) {
+	if cfg.JWT.KeysDir != "" {
+		return jwtToken.LoadKeySet(cfg.JWT.KeysDir, cfg.JWT.SigningKeyId, cfg.JWT.Issuer)
+	}
+
+	if cfg.Env != "dev" {
+		return nil, fmt.Errorf("jwt keys_dir not set")
+	}
+
+	slog.Warn("jwt keys_dir not set, using a throwaway key, tokens stop working on restart")
+	return jwtToken.GenerateKeySet(cfg.JWT.Issuer)
+}
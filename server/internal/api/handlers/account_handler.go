@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+	"github.com/gauravst/real-time-chat/internal/utils/credentials"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
+	"github.com/go-playground/validator/v10"
+)
+
+func GetEmail(accountService services.AccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, err := accountService.GetEmail(userData.UserId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"email":         data.Email,
+			"emailVerified": data.EmailVerified,
+		})
+		return
+	}
+}
+
+func ChangeEmail(accountService services.AccountService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.EmailRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		err := accountService.ChangeEmail(userData, data.Email, cfg)
+		if err != nil {
+			if errors.Is(err, services.ErrGuestEmail) {
+				response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusAccepted, map[string]string{"message": "verification email sent"})
+		return
+	}
+}
+
+func VerifyEmail(accountService services.AccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data models.EmailTokenRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		err := accountService.VerifyEmail(data.Token)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidEmailToken):
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			case errors.Is(err, services.ErrEmailInUse):
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+			default:
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			}
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "email verified"})
+		return
+	}
+}
+
+func ForgotPassword(accountService services.AccountService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data models.EmailRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		err := accountService.RequestPasswordReset(data.Email, clientinfo.GetIp(r), cfg)
+		if err != nil {
+			if errors.Is(err, services.ErrTooManyAttempts) {
+				response.WriteJson(w, http.StatusTooManyRequests, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		// same answer whether or not the address belongs to an account
+		response.WriteJson(w, http.StatusAccepted, map[string]string{"message": "if the email is registered a reset link was sent"})
+		return
+	}
+}
+
+func ResetPassword(accountService services.AccountService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data models.ResetPasswordRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		sessionIds, apiTokenIds, err := accountService.ResetPassword(&data, cfg)
+		if err != nil {
+			var credentialsErr *credentials.Error
+			switch {
+			case errors.Is(err, services.ErrInvalidEmailToken), errors.As(err, &credentialsErr):
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			default:
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			}
+			return
+		}
+
+		// every device was logged out, drop their live connections too
+		ws.CloseSessions(wsServer, sessionIds, cfg.WebSocket.WriteWait)
+		ws.CloseApiTokens(wsServer, apiTokenIds, cfg.WebSocket.WriteWait)
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "password changed, please login again"})
+		return
+	}
+}
+
+// decodeAndValidate reads a json body into data, it writes the error response itself
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, data interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(data)
+	if errors.Is(err, io.EOF) {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body")))
+		return false
+	}
+
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+		return false
+	}
+
+	err = validator.New().Struct(data)
+	if err != nil {
+		validateErrs := err.(validator.ValidationErrors)
+		response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateErrs))
+		return false
+	}
+
+	return true
+}
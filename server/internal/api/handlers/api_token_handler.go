@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
+)
+
+func CreateApiToken(apiTokenService services.ApiTokenService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.ApiTokenRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		apiToken, token, err := apiTokenService.CreateApiToken(userData.UserId, &data)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		// the token itself is only returned once
+		response.WriteJson(w, http.StatusCreated, map[string]interface{}{
+			"token":    token,
+			"apiToken": apiToken,
+		})
+		return
+	}
+}
+
+func GetAllApiTokens(apiTokenService services.ApiTokenService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, err := apiTokenService.GetAllApiTokens(userData.UserId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func DeleteApiToken(apiTokenService services.ApiTokenService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		idInt, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid token id")))
+			return
+		}
+
+		err = apiTokenService.DeleteApiToken(userData.UserId, idInt)
+		if err != nil {
+			if err.Error() == "token not found" {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		// the token can't be used anymore, neither can the sockets it opened
+		ws.CloseApiTokens(wsServer, []int{idInt}, cfg.WebSocket.WriteWait)
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "token revoked"})
+		return
+	}
+}
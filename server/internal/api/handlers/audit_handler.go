@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+func GetAuditEvents(auditService services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		data, err := auditService.GetAuditEvents(filter)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		// a full page means there may be more, the client passes nextCursor as ?before=
+		var nextCursor int64
+		if len(data) == filter.Limit {
+			nextCursor = data[len(data)-1].Id
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"events":     data,
+			"nextCursor": nextCursor,
+		})
+		return
+	}
+}
+
+func VerifyAuditLog(auditService services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		data, err := auditService.Verify()
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+// isAdmin writes the error response itself when the caller is not an admin
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userData, ok := r.Context().Value(middleware.UserDataKey).(*models.AccessToken)
+	if !ok {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+		return false
+	}
+
+	if userData.Role != "ADMIN" {
+		response.WriteJson(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("admin only")))
+		return false
+	}
+
+	return true
+}
+
+func parseAuditFilter(r *http.Request) (*models.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := &models.AuditFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("targetType"),
+		TargetId:   query.Get("targetId"),
+		Limit:      defaultAuditLimit,
+	}
+
+	var err error
+	if value := query.Get("actorId"); value != "" {
+		filter.ActorId, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid actorId")
+		}
+	}
+
+	if value := query.Get("before"); value != "" {
+		filter.Before, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid before")
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = min(filter.Limit, maxAuditLimit)
+	}
+
+	for key, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s, use RFC 3339", key)
+			}
+			t = t.UTC()
+			*target = &t
+		}
+	}
+
+	return filter, nil
+}
+
+// newAuditActor describes the caller of the request for the audit log. The ip is the address
+// resolved by middleware.ClientIp, headers are only believed from trusted proxies, so the actor
+// can't write another address into the chained events.
+func newAuditActor(r *http.Request, userData *models.AccessToken) *models.AuditActor {
+	return &models.AuditActor{
+		UserId:    userData.UserId,
+		Username:  userData.Username,
+		Ip:        clientinfo.GetIp(r),
+		RequestId: middleware.GetRequestId(r.Context()),
+	}
+}
@@ -6,16 +6,69 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gauravst/real-time-chat/internal/api/middleware"
 	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/services"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+	"github.com/gauravst/real-time-chat/internal/utils/credentials"
 	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
 	"github.com/gauravst/real-time-chat/internal/utils/response"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
 	"github.com/go-playground/validator/v10"
 )
 
+func RegisterUser(authService services.AuthService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user models.LoginRequest
+
+		err := json.NewDecoder(r.Body).Decode(&user)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body")))
+			return
+		}
+
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		// Request validation
+		err = validator.New().Struct(user)
+		if err != nil {
+			validateErrs := err.(validator.ValidationErrors)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateErrs))
+			return
+		}
+
+		session := clientinfo.NewLoginSession(r, user.DeviceName)
+		tokens, userData, err := authService.RegisterUser(&user, session, cfg)
+		if err != nil {
+			var credentialsErr *credentials.Error
+			switch {
+			case errors.Is(err, services.ErrRegistrationDisabled):
+				response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+			case errors.Is(err, services.ErrUsernameTaken):
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+			case errors.As(err, &credentialsErr):
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			default:
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			}
+			return
+		}
+
+		// seting new access and refresh token
+		jwtToken.SetAccessToken(w, r, tokens.AccessToken, false)
+		jwtToken.SetRefreshToken(w, r, tokens.RefreshToken, tokens.RefreshExpiresAt, false)
+
+		// return response
+		response.WriteJson(w, http.StatusCreated, userData)
+		return
+	}
+}
+
 func LoginUser(authService services.AuthService, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -41,14 +94,30 @@ func LoginUser(authService services.AuthService, cfg config.Config) http.Handler
 
 		// call here services
 
-		token, userData, err := authService.LoginUser(&user, cfg)
+		session := clientinfo.NewLoginSession(r, user.DeviceName)
+		tokens, userData, err := authService.LoginUser(&user, session, cfg)
 		if err != nil {
+			if errors.Is(err, services.ErrInvalidCredentials) {
+				response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
+				return
+			}
+
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
-		// seting new access token
-		jwtToken.SetAccessToken(w, r, token, false)
+		// password was right, the client must now send a code to /api/auth/2fa
+		if tokens.Challenge != "" {
+			response.WriteJson(w, http.StatusAccepted, map[string]interface{}{
+				"twoFactorRequired": true,
+				"challenge":         tokens.Challenge,
+			})
+			return
+		}
+
+		// seting new access and refresh token
+		jwtToken.SetAccessToken(w, r, tokens.AccessToken, false)
+		jwtToken.SetRefreshToken(w, r, tokens.RefreshToken, tokens.RefreshExpiresAt, false)
 
 		// return response
 		response.WriteJson(w, http.StatusCreated, userData)
@@ -60,14 +129,21 @@ func LoginWithoutAuth(authService services.AuthService, cfg config.Config) http.
 	return func(w http.ResponseWriter, r *http.Request) {
 		// call here services
 
-		token, userData, err := authService.LoginWithoutAuth(cfg)
+		session := clientinfo.NewLoginSession(r, "")
+		tokens, userData, err := authService.LoginWithoutAuth(session, cfg)
 		if err != nil {
+			if errors.Is(err, services.ErrRegistrationDisabled) {
+				response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+				return
+			}
+
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
-		// seting new access token
-		jwtToken.SetAccessToken(w, r, token, false)
+		// seting new access and refresh token
+		jwtToken.SetAccessToken(w, r, tokens.AccessToken, false)
+		jwtToken.SetRefreshToken(w, r, tokens.RefreshToken, tokens.RefreshExpiresAt, false)
 
 		// return response
 		response.WriteJson(w, http.StatusCreated, userData)
@@ -75,7 +151,89 @@ func LoginWithoutAuth(authService services.AuthService, cfg config.Config) http.
 	}
 }
 
-func LogoutUser(authService services.AuthService) http.HandlerFunc {
+func UpgradeGuest(authService services.AuthService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.LoginRequest
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		err = validator.New().Struct(data)
+		if err != nil {
+			validateErrs := err.(validator.ValidationErrors)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateErrs))
+			return
+		}
+
+		token, user, err := authService.UpgradeGuest(userData, &data, cfg)
+		if err != nil {
+			var credentialsErr *credentials.Error
+			switch {
+			case errors.Is(err, services.ErrUsernameTaken):
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+			case errors.Is(err, services.ErrNotGuest), errors.As(err, &credentialsErr):
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			default:
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			}
+			return
+		}
+
+		// access token carries the new username
+		jwtToken.SetAccessToken(w, r, token, false)
+
+		response.WriteJson(w, http.StatusOK, user)
+		return
+	}
+}
+
+func RefreshToken(authService services.AuthService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("refreshToken")
+		if err != nil || cookie.Value == "" {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("refresh token not found")))
+			return
+		}
+
+		tokens, err := authService.RefreshToken(cookie.Value, cfg, wsServer)
+		if err != nil {
+			// other errors keep the cookies, the refresh token still works once the server recovers
+			if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+				jwtToken.RemoveAccessToken(w, r, false)
+				jwtToken.RemoveRefreshToken(w, r, false)
+				response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		// seting rotated access and refresh token
+		jwtToken.SetAccessToken(w, r, tokens.AccessToken, false)
+		jwtToken.SetRefreshToken(w, r, tokens.RefreshToken, tokens.RefreshExpiresAt, false)
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"success": "ok"})
+		return
+	}
+}
+
+func LogoutUser(authService services.AuthService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
 		if userDataRaw == nil {
@@ -90,17 +248,123 @@ func LogoutUser(authService services.AuthService) http.HandlerFunc {
 			return
 		}
 
-		err := authService.LogoutUser(userData.UserId)
+		err := authService.LogoutUser(userData.UserId, userData.SessionId)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
-		// remove access token from client
+		// close sockets opened with this session
+		ws.CloseSessions(wsServer, []int{userData.SessionId}, cfg.WebSocket.WriteWait)
+
+		// remove tokens from client
 		jwtToken.RemoveAccessToken(w, r, false)
+		jwtToken.RemoveRefreshToken(w, r, false)
 
 		// return response
 		response.WriteJson(w, http.StatusOK, map[string]string{"success": "ok"})
 		return
 	}
 }
+
+func GetAllSessions(authService services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, err := authService.GetAllSessions(userData.UserId, userData.SessionId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func RevokeSession(authService services.AuthService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		idInt, err := strconv.Atoi(id)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid session id")))
+			return
+		}
+
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		err = authService.RevokeSession(userData.UserId, idInt, newAuditActor(r, userData))
+		if err != nil {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+			return
+		}
+
+		ws.CloseSessions(wsServer, []int{idInt}, cfg.WebSocket.WriteWait)
+
+		// revoking the current session is the same as logging out
+		if idInt == userData.SessionId {
+			jwtToken.RemoveAccessToken(w, r, false)
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"success": "ok"})
+		return
+	}
+}
+
+func RevokeOtherSessions(authService services.AuthService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		ids, err := authService.RevokeOtherSessions(userData.UserId, userData.SessionId, newAuditActor(r, userData))
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		ws.CloseSessions(wsServer, ids, cfg.WebSocket.WriteWait)
+
+		response.WriteJson(w, http.StatusOK, map[string]int{"revoked": len(ids)})
+		return
+	}
+}
+
+// GetJWKS publishes the public keys tokens are signed with
+func GetJWKS(keys *jwtToken.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response.WriteJson(w, http.StatusOK, keys.JWKS())
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+func GetAllBlocks(blockService services.BlockService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, err := blockService.GetAllBlocks(userData.UserId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func BlockUser(blockService services.BlockService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.BlockRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		err := blockService.BlockUser(userData.UserId, data.UserId)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrBlockSelf):
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			case err.Error() == "user not found":
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+			default:
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			}
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "user blocked"})
+		return
+	}
+}
+
+func UnblockUser(blockService services.BlockService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		idInt, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid user id")))
+			return
+		}
+
+		err = blockService.UnblockUser(userData.UserId, idInt)
+		if err != nil {
+			if err.Error() == "block not found" {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "user unblocked"})
+		return
+	}
+}
@@ -2,23 +2,34 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gauravst/real-time-chat/internal/api/middleware"
 	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/services"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
 	"github.com/gauravst/real-time-chat/internal/utils/response"
 	"github.com/gauravst/real-time-chat/internal/utils/ws"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/websocket"
 )
 
-func LiveChat(chatService services.ChatService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+const (
+	defaultRoomLimit = 50
+	maxRoomLimit     = 100
+)
+
+func LiveChat(chatService services.ChatService, blockService services.BlockService, unfurlService services.UnfurlService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// geting middleware data
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -38,11 +49,11 @@ func LiveChat(chatService services.ChatService, cfg config.Config, wsServer *mod
 		// Store user data in a local variable
 		currentUser := *userData
 
-		roomName := r.PathValue("roomName")
-		if roomName == "" {
-			http.Error(w, "Missing room Name", http.StatusBadRequest)
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
+		roomId := roomData.Id
 
 		// Upgrade HTTP connection to WebSocket
 		conn, err := wsServer.Upgrader.Upgrade(w, r, nil)
@@ -53,7 +64,7 @@ func LiveChat(chatService services.ChatService, cfg config.Config, wsServer *mod
 		defer conn.Close()
 
 		//check user join or not in room
-		isMember, err := chatService.CheckChatRoomMember(currentUser.UserId, roomName)
+		isMember, err := chatService.CheckChatRoomMember(currentUser.UserId, roomId)
 		if err != nil {
 			slog.Error(err.Error())
 			conn.WriteMessage(websocket.TextMessage, []byte("Error: something went worng."))
@@ -65,14 +76,27 @@ func LiveChat(chatService services.ChatService, cfg config.Config, wsServer *mod
 			return
 		}
 
+		// archived rooms are read-only, their history is served by GetOldChats
+		if roomData.ArchivedAt != nil {
+			ws.CloseWithCode(conn, ws.CloseRoomArchived, "room archived", cfg.WebSocket.WriteWait)
+			return
+		}
+
 		// Add connection to the room
 		wsServer.RoomMutex.Lock()
-		wsServer.Rooms[roomName] = append(wsServer.Rooms[roomName], conn)
-		if wsServer.OnlineUser[roomName] == nil {
-			wsServer.OnlineUser[roomName] = make(map[string]bool)
+		wsServer.Rooms[roomId] = append(wsServer.Rooms[roomId], conn)
+		if wsServer.OnlineUser[roomId] == nil {
+			wsServer.OnlineUser[roomId] = make(map[string]bool)
 		}
 
-		wsServer.OnlineUser[roomName][userData.Username] = true
+		wsServer.OnlineUser[roomId][userData.Username] = true
+		// sockets of a personal access token are closed with the token, others with their login session
+		if currentUser.ApiTokenId != 0 {
+			wsServer.ApiTokens[currentUser.ApiTokenId] = append(wsServer.ApiTokens[currentUser.ApiTokenId], conn)
+		} else {
+			wsServer.Sessions[currentUser.SessionId] = append(wsServer.Sessions[currentUser.SessionId], conn)
+		}
+		wsServer.ConnUsers[conn] = currentUser.UserId
 
 		// check user Already in connection so we not get worng online count
 		// if users, ok := wsServer.OnlineUser[roomName]; ok {
@@ -94,19 +118,41 @@ func LiveChat(chatService services.ChatService, cfg config.Config, wsServer *mod
 		// slog.Info(fmt.Sprintf("Online users in room %s: %+v", roomName, users))
 
 		// Broadcast the updated online user count
-		go broadcastOnlineUsers(roomName, wsServer)
+		go broadcastOnlineUsers(roomId, wsServer)
 
 		slog.Info("WebSocket connection established")
 
+		// limit frame size and drop peers that stop answering pings
+		wsCfg := cfg.WebSocket
+		conn.SetReadLimit(wsCfg.MaxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(wsCfg.PongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsCfg.PongWait))
+		})
+
+		stopPing := ws.StartPing(conn, wsCfg.PingInterval, wsCfg.WriteWait)
+		defer close(stopPing)
+
+		// disconnect users who keep the socket open without chatting
+		idleTimer := time.AfterFunc(wsCfg.IdleTimeout, func() {
+			ws.CloseWithCode(conn, ws.CloseIdleTimeout, "idle timeout", wsCfg.WriteWait)
+		})
+		defer idleTimer.Stop()
+
 		// Handle WebSocket messages
 		for {
 			// geting message from client
 			_, message, err := conn.ReadMessage()
 			if err != nil {
 				slog.Error("failed to read WebSocket message", slog.String("error", err.Error()))
+				if code, reason := ws.CloseCodeForReadError(err); code != 0 {
+					ws.CloseWithCode(conn, code, reason, wsCfg.WriteWait)
+				}
 				break
 			}
 
+			idleTimer.Reset(wsCfg.IdleTimeout)
+
 			// decoding message here
 			var msg models.MessageRequest
 			err = json.Unmarshal(message, &msg)
@@ -121,35 +167,43 @@ func LiveChat(chatService services.ChatService, cfg config.Config, wsServer *mod
 				Content: msg.Content,
 				UserId:  currentUser.UserId,
 			}
-			createdMessage, err := chatService.CreateNewMessage(newMessageData, roomName)
+			createdMessage, err := chatService.CreateNewMessage(newMessageData, roomId)
 			if err != nil {
 				slog.Error("failed to save message", slog.String("error", err.Error()))
 				continue
 			}
 
+			// users who blocked the sender must not get the message
+			blockedBy, err := blockService.GetBlockedBy(currentUser.UserId)
+			if err != nil {
+				slog.Error("failed to load blocks", slog.String("error", err.Error()))
+				continue
+			}
+
 			// send message
 			createdMessage.Type = "chat"
-			go ws.BroadcastMessage(wsServer, roomName, conn, createdMessage)
+			go ws.BroadcastMessage(wsServer, roomId, conn, createdMessage, blockedBy)
+			unfurlService.Unfurl(createdMessage, blockedBy, wsServer)
 		}
 
 		// remove connection
-		removeConnection(roomName, conn, wsServer, userData.Username)
+		removeConnection(roomId, conn, wsServer, userData.Username, &currentUser)
 	}
 }
 
-func broadcastOnlineUsers(roomName string, wsServer *models.WsServer) {
+func broadcastOnlineUsers(roomId int, wsServer *models.WsServer) {
 	wsServer.RoomMutex.Lock()
 	defer wsServer.RoomMutex.Unlock()
 
-	clients := wsServer.Rooms[roomName]
-	count := len(wsServer.OnlineUser[roomName])
+	clients := wsServer.Rooms[roomId]
+	count := len(wsServer.OnlineUser[roomId])
 
 	slog.Info(fmt.Sprintf("Number of online users: %d", count))
 	users := []string{}
-	for user := range wsServer.OnlineUser[roomName] {
+	for user := range wsServer.OnlineUser[roomId] {
 		users = append(users, user)
 	}
-	slog.Info(fmt.Sprintf("Online users in room %s: %+v", roomName, users))
+	slog.Info(fmt.Sprintf("Online users in room %d: %+v", roomId, users))
 
 	data := &models.OnlineUserCountRequest{
 		Type:  "onlineUser",
@@ -170,27 +224,98 @@ func broadcastOnlineUsers(roomName string, wsServer *models.WsServer) {
 	}
 }
 
-func removeConnection(roomName string, conn *websocket.Conn, wsServer *models.WsServer, username string) {
+// removeConn drops conn from the connections of id, the caller holds the room lock
+func removeConn(conns map[int][]*websocket.Conn, id int, conn *websocket.Conn) {
+	for i, c := range conns[id] {
+		if c == conn {
+			conns[id] = append(conns[id][:i], conns[id][i+1:]...)
+			break
+		}
+	}
+
+	if len(conns[id]) == 0 {
+		delete(conns, id)
+	}
+}
+
+func removeConnection(roomId int, conn *websocket.Conn, wsServer *models.WsServer, username string, currentUser *models.AccessToken) {
 	wsServer.RoomMutex.Lock()
 	defer wsServer.RoomMutex.Unlock()
 
-	clients := wsServer.Rooms[roomName]
+	clients := wsServer.Rooms[roomId]
 	for i, c := range clients {
 		if c == conn {
-			wsServer.Rooms[roomName] = append(clients[:i], clients[i+1:]...)
+			wsServer.Rooms[roomId] = append(clients[:i], clients[i+1:]...)
 			break
 		}
 	}
 
-	count := len(wsServer.OnlineUser[roomName])
+	if currentUser.ApiTokenId != 0 {
+		removeConn(wsServer.ApiTokens, currentUser.ApiTokenId, conn)
+	} else {
+		removeConn(wsServer.Sessions, currentUser.SessionId, conn)
+	}
+
+	delete(wsServer.ConnUsers, conn)
+
+	count := len(wsServer.OnlineUser[roomId])
 
 	// decrease the online user count
 	if count > 0 {
-		delete(wsServer.OnlineUser[roomName], username)
+		delete(wsServer.OnlineUser[roomId], username)
 	}
 
 	// Broadcast updated online users count
-	go broadcastOnlineUsers(roomName, wsServer)
+	go broadcastOnlineUsers(roomId, wsServer)
+}
+
+// resolveRoom loads the room of the {slug} path value and writes the error response itself.
+// Old slugs of renamed rooms still resolve, plain GET requests are redirected to the current
+// slug instead so links get updated. Tokens limited to other rooms are refused.
+func resolveRoom(w http.ResponseWriter, r *http.Request, chatService services.ChatService, userData *models.AccessToken) (*models.ChatRoom, bool) {
+	slug := r.PathValue("slug")
+	roomData, err := chatService.GetChatRoomBySlug(slug)
+	if err != nil {
+		if errors.Is(err, services.ErrRoomNotFound) {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+			return nil, false
+		}
+
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+		return nil, false
+	}
+
+	if len(userData.Rooms) > 0 && !slices.Contains(userData.Rooms, roomData.Id) {
+		response.WriteJson(w, http.StatusForbidden, response.GeneralError(services.ErrApiTokenRoom))
+		return nil, false
+	}
+
+	if roomData.Slug != slug && r.Method == http.MethodGet && !websocket.IsWebSocketUpgrade(r) {
+		http.Redirect(w, r, roomUrl(r, roomData.Slug), http.StatusPermanentRedirect)
+		return nil, false
+	}
+
+	return roomData, true
+}
+
+// roomUrl is the url of the request with the {slug} segment of its route replaced
+func roomUrl(r *http.Request, slug string) string {
+	pattern := r.Pattern
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		pattern = pattern[i:]
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+	index := slices.Index(strings.Split(pattern, "/"), "{slug}")
+	if index >= 0 && index < len(segments) {
+		segments[index] = url.PathEscape(slug)
+	}
+
+	target := strings.Join(segments, "/")
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	return target
 }
 
 func GetAllChatRoom(chatService services.ChatService) http.HandlerFunc {
@@ -207,31 +332,62 @@ func GetAllChatRoom(chatService services.ChatService) http.HandlerFunc {
 			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
 			return
 		}
-		data, err := chatService.GetAllChatRoom(userData)
+		filter, err := parseRoomFilter(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		data, err := chatService.GetAllChatRoom(userData, filter)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
+		// the body stays a plain list, a full page tells the client where the next one starts
+		if len(data) == filter.Limit {
+			w.Header().Set("X-Next-Cursor", services.RoomCursor(filter.Sort, data[len(data)-1]))
+		}
+
 		response.WriteJson(w, http.StatusOK, data)
 		return
 	}
 }
 
-func GetChatRoomByName(chatService services.ChatService) http.HandlerFunc {
+func GetChatRoomBySlug(chatService services.ChatService, pinService services.PinService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		name := r.PathValue("name")
-		if name == " " {
-			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("name parms not found")))
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
 
-		data, err := chatService.GetChatRoomByName(name)
+		// the topic is public, the pins are only shown to members
+		canRead, err := canReadRoomHistory(chatService, userData, data.Id)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
+		if canRead {
+			data.Pins, err = pinService.GetPinnedMessages(data.Id)
+			if err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+				return
+			}
+		}
+
 		response.WriteJson(w, http.StatusOK, data)
 		return
 	}
@@ -275,7 +431,7 @@ func CreateNewChatRoom(chatService services.ChatService) http.HandlerFunc {
 		// create new chat
 		err = chatService.CreateNewChatRoom(&data)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeSlugError(w, err)
 			return
 		}
 
@@ -284,7 +440,7 @@ func CreateNewChatRoom(chatService services.ChatService) http.HandlerFunc {
 	}
 }
 
-func UpdateChatRoom(chatService services.ChatService) http.HandlerFunc {
+func UpdateChatRoom(chatService services.ChatService, wsServer *models.WsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get value from context
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -308,81 +464,149 @@ func UpdateChatRoom(chatService services.ChatService) http.HandlerFunc {
 			return
 		}
 
-		// get data from parms
-		name := r.PathValue("name")
-		if name == " " {
-			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("name parms not found")))
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
 
-		roomData, err := chatService.GetChatRoomByName(name)
+		// the room from the path is updated, the body may rename it or give it a new slug
+		data.Id = roomData.Id
+		if data.Name == "" {
+			data.Name = roomData.Name
+		}
+
+		err = chatService.UpdateChatRoom(&data, newAuditActor(r, userData))
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeSlugError(w, err)
 			return
 		}
 
-		if userData.Role != "ADMIN" && roomData.UserId != userData.UserId {
-			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("unauthorized user")))
+		// open sockets learn the new name and slug
+		ws.NotifyRoom(wsServer, &models.ChatRoom{Id: data.Id, Name: data.Name, Slug: data.Slug}, "roomUpdated")
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func DeleteChatRoom(chatService services.ChatService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get value from context
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
 			return
 		}
 
-		err = chatService.UpdateChatRoom(&data)
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		err := chatService.DeleteChatRoom(roomData.Id, newAuditActor(r, userData))
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
-		response.WriteJson(w, http.StatusOK, data)
+		ws.CloseRoom(wsServer, roomData, "roomDeleted", ws.CloseRoomDeleted, "room deleted", cfg.WebSocket.WriteWait)
+
+		response.WriteJson(w, http.StatusOK, "Chat Room Deleted")
 		return
 	}
 }
 
-func DeleteChatRoom(chatService services.ChatService) http.HandlerFunc {
+func ArchiveChatRoom(chatService services.ChatService, archived bool, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get value from context
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
 		if userDataRaw == nil {
 			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
 			return
 		}
 
-		// Correct the type assertion to *models.AccessToken
 		userData, ok := userDataRaw.(*models.AccessToken)
 		if !ok {
 			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
 			return
 		}
 
-		// get data from parms
-		name := r.PathValue("name")
-		if name == " " {
-			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("name parms not found")))
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
 
-		roomData, err := chatService.GetChatRoomByName(name)
+		err := chatService.ArchiveChatRoom(roomData.Id, archived, newAuditActor(r, userData))
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
+		if !archived {
+			response.WriteJson(w, http.StatusOK, map[string]string{"message": "room unarchived"})
+			return
+		}
+
+		ws.CloseRoom(wsServer, roomData, "roomArchived", ws.CloseRoomArchived, "room archived", cfg.WebSocket.WriteWait)
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "room archived"})
+		return
+	}
+}
+
+func RestoreChatRoom(chatService services.ChatService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, err := chatService.GetDeletedChatRoom(r.PathValue("slug"))
+		if err != nil {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+			return
+		}
+
+		if len(userData.Rooms) > 0 && !slices.Contains(userData.Rooms, roomData.Id) {
+			response.WriteJson(w, http.StatusForbidden, response.GeneralError(services.ErrApiTokenRoom))
+			return
+		}
+
 		if userData.Role != "ADMIN" && roomData.UserId != userData.UserId {
 			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("unauthorized user")))
 			return
 		}
 
-		err = chatService.DeleteChatRoom(name)
+		err = chatService.RestoreChatRoom(roomData.Id, cfg.Rooms.RestoreWindow, newAuditActor(r, userData))
 		if err != nil {
+			if errors.Is(err, services.ErrRestoreExpired) {
+				response.WriteJson(w, http.StatusGone, response.GeneralError(err))
+				return
+			}
+
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
 		}
 
-		response.WriteJson(w, http.StatusOK, "Chat Room Deleted")
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "room restored"})
 		return
 	}
 }
 
-func JoinRoom(chatService services.ChatService) http.HandlerFunc {
+func JoinRoom(chatService services.ChatService, wsServer *models.WsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get value from context
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -398,14 +622,12 @@ func JoinRoom(chatService services.ChatService) http.HandlerFunc {
 			return
 		}
 
-		// get data from parms
-		name := r.PathValue("name")
-		if name == " " {
-			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("name parms not found")))
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
 
-		member, err := chatService.CheckChatRoomMember(userData.UserId, name)
+		member, err := chatService.CheckChatRoomMember(userData.UserId, roomData.Id)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
@@ -417,12 +639,25 @@ func JoinRoom(chatService services.ChatService) http.HandlerFunc {
 		}
 
 		data := &models.JoinRoomRequest{
-			UserId:   userData.UserId,
-			RoomName: name,
+			UserId: userData.UserId,
+			RoomId: roomData.Id,
 		}
-		err = chatService.JoinRoom(data)
+		request, err := chatService.JoinRoom(data, wsServer)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			switch {
+			case errors.Is(err, services.ErrPrivateRoom), errors.Is(err, services.ErrRoomArchived):
+				response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+			case errors.Is(err, services.ErrJoinRequestPending):
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+			default:
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			}
+			return
+		}
+
+		// the room owner has to approve first
+		if request != nil {
+			response.WriteJson(w, http.StatusAccepted, request)
 			return
 		}
 
@@ -474,14 +709,12 @@ func LeaveRoom(chatService services.ChatService) http.HandlerFunc {
 			return
 		}
 
-		// get data from parms
-		name := r.PathValue("name")
-		if name == " " {
-			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("name parms not found")))
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
 
-		err := chatService.LeaveRoom(userData.UserId, name)
+		err := chatService.LeaveRoom(userData.UserId, roomData.Id)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
@@ -508,10 +741,14 @@ func GetOldChats(chatService services.ChatService) http.HandlerFunc {
 			return
 		}
 
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
 		// get data from parms
-		name := r.PathValue("roomName")
 		limit := r.PathValue("limit")
-		if name == " " || limit == " " {
+		if limit == " " {
 			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("parms not found")))
 			return
 		}
@@ -523,7 +760,7 @@ func GetOldChats(chatService services.ChatService) http.HandlerFunc {
 		}
 
 		//check user join or not in room
-		isMember, err := chatService.CheckChatRoomMember(userData.UserId, name)
+		isMember, err := chatService.CheckChatRoomMember(userData.UserId, roomData.Id)
 		if err != nil {
 			slog.Error(err.Error())
 			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("Error: something went worng.")))
@@ -535,7 +772,7 @@ func GetOldChats(chatService services.ChatService) http.HandlerFunc {
 			return
 		}
 
-		oldMessages, err := chatService.GetOldMessages(name, intLimit)
+		oldMessages, err := chatService.GetOldMessages(roomData.Id, intLimit, userData.UserId)
 		if err != nil {
 			log.Println("Failed to fetch old messages:", err)
 			return
@@ -546,7 +783,7 @@ func GetOldChats(chatService services.ChatService) http.HandlerFunc {
 	}
 }
 
-func GetPrivateChatRoom(chatService services.ChatService) http.HandlerFunc {
+func GetPrivateChatRoom(chatService services.ChatService, inviteService services.InviteService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get value from context
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -569,16 +806,15 @@ func GetPrivateChatRoom(chatService services.ChatService) http.HandlerFunc {
 			return
 		}
 
-		//check private room using room code
-		roomData, err := chatService.GetPrivateChatRoom(code)
+		//check private room using invite or room code
+		roomData, err := inviteService.GetRoomByCode(code, userData.UserId, clientinfo.GetIp(r))
 		if err != nil {
-			slog.Error(err.Error())
-			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("Error: room not found")))
+			writeInviteError(w, err)
 			return
 		}
 
 		//check user join or not in room
-		isMember, err := chatService.CheckChatRoomMember(userData.UserId, roomData.Name)
+		isMember, err := chatService.CheckChatRoomMember(userData.UserId, roomData.Id)
 		if err != nil {
 			slog.Error(err.Error())
 			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("Error: something went worng.")))
@@ -588,6 +824,7 @@ func GetPrivateChatRoom(chatService services.ChatService) http.HandlerFunc {
 		data := &models.PrivateRoomUsingCodeResponse{
 			Id:          roomData.Id,
 			Name:        roomData.Name,
+			Slug:        roomData.Slug,
 			Members:     roomData.Members,
 			Code:        roomData.Code,
 			Description: roomData.Description,
@@ -600,7 +837,7 @@ func GetPrivateChatRoom(chatService services.ChatService) http.HandlerFunc {
 	}
 }
 
-func JoinPrivateRoom(chatService services.ChatService) http.HandlerFunc {
+func JoinPrivateRoom(inviteService services.InviteService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get value from context
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -624,10 +861,9 @@ func JoinPrivateRoom(chatService services.ChatService) http.HandlerFunc {
 		}
 
 		// JoinPrivateRoom
-		err := chatService.JoinPrivateRoom(code, userData)
+		_, err := inviteService.JoinWithCode(code, userData.UserId, clientinfo.GetIp(r))
 		if err != nil {
-			slog.Error(err.Error())
-			response.WriteJson(w, http.StatusInternalServerError, err)
+			writeInviteError(w, err)
 			return
 		}
 
@@ -635,3 +871,51 @@ func JoinPrivateRoom(chatService services.ChatService) http.HandlerFunc {
 		return
 	}
 }
+
+// parseRoomFilter reads ?q=, ?tag=, ?sort=, ?cursor= and ?limit= of the room listing
+func parseRoomFilter(r *http.Request) (*models.RoomFilter, error) {
+	query := r.URL.Query()
+	filter := &models.RoomFilter{
+		Query: strings.TrimSpace(query.Get("q")),
+		Tag:   query.Get("tag"),
+		Sort:  query.Get("sort"),
+		Limit: defaultRoomLimit,
+	}
+
+	switch filter.Sort {
+	case "":
+		filter.Sort = services.RoomSortActivity
+	case services.RoomSortMembers, services.RoomSortActivity, services.RoomSortCreated:
+	default:
+		return nil, fmt.Errorf("invalid sort, use %s, %s or %s", services.RoomSortMembers, services.RoomSortActivity, services.RoomSortCreated)
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		err := services.ParseRoomCursor(value, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = min(limit, maxRoomLimit)
+	}
+
+	return filter, nil
+}
+
+// writeSlugError answers a failed create or update of a room
+func writeSlugError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSlug), errors.Is(err, services.ErrInvalidTags):
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+	case errors.Is(err, services.ErrSlugTaken):
+		response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+	default:
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+	}
+}
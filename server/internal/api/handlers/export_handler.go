@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+	"github.com/go-playground/validator/v10"
+)
+
+// StreamRoomExport writes the history of the room as JSON Lines or CSV while it is read
+func StreamRoomExport(chatService services.ChatService, exportService services.ExportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		data, err := parseExportRequest(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		if data.Format == services.ExportZip {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(services.ErrExportStreamOnly))
+			return
+		}
+
+		if data.From != nil && data.To != nil && !data.From.Before(*data.To) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(services.ErrExportRange))
+			return
+		}
+
+		w.Header().Set("Content-Type", services.ExportContentTypes[data.Format])
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, roomData.Slug, data.Format))
+
+		// the status is sent with the first row, a failure after that can only be logged
+		err = exportService.StreamExport(r.Context(), roomData, data, w, newAuditActor(r, userData))
+		if err != nil {
+			slog.Error("export stream failed", slog.Int("roomId", roomData.Id), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func CreateRoomExport(chatService services.ChatService, exportService services.ExportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.ExportRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		export, err := exportService.CreateExport(roomData, &data, newAuditActor(r, userData))
+		if err != nil {
+			if errors.Is(err, services.ErrExportRange) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/room/%s/exports/%d", roomData.Slug, export.Id))
+		response.WriteJson(w, http.StatusAccepted, export)
+		return
+	}
+}
+
+func GetRoomExport(chatService services.ChatService, exportService services.ExportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		export, ok := getRoomExport(w, r, exportService, roomData)
+		if !ok {
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, export)
+		return
+	}
+}
+
+func DownloadRoomExport(chatService services.ChatService, exportService services.ExportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		export, ok := getRoomExport(w, r, exportService, roomData)
+		if !ok {
+			return
+		}
+
+		if export.Status != services.ExportDone {
+			response.WriteJson(w, http.StatusConflict, response.GeneralError(services.ErrExportNotReady))
+			return
+		}
+
+		file, err := os.Open(export.Path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(services.ErrExportNotFound))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", services.ExportContentTypes[export.Format])
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.%s"`, roomData.Slug, export.Id, export.Format))
+		http.ServeContent(w, r, filepath.Base(export.Path), *export.FinishedAt, file)
+	}
+}
+
+// getRoomExport loads the export from the path and fills in its download link,
+// it writes the error response itself
+func getRoomExport(w http.ResponseWriter, r *http.Request, exportService services.ExportService, roomData *models.ChatRoom) (*models.RoomExport, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid export id")))
+		return nil, false
+	}
+
+	export, err := exportService.GetExport(roomData.Id, id)
+	if err != nil {
+		if errors.Is(err, services.ErrExportNotFound) {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+			return nil, false
+		}
+
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+		return nil, false
+	}
+
+	if export.Status == services.ExportDone {
+		export.DownloadUrl = fmt.Sprintf("/api/room/%s/exports/%d/download", roomData.Slug, export.Id)
+	}
+	return export, true
+}
+
+// parseExportRequest reads format, from and to from the query, the format defaults to jsonl
+func parseExportRequest(r *http.Request) (*models.ExportRequest, error) {
+	query := r.URL.Query()
+	data := &models.ExportRequest{Format: query.Get("format")}
+	if data.Format == "" {
+		data.Format = services.ExportJSONL
+	}
+
+	for name, target := range map[string]**time.Time{"from": &data.From, "to": &data.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, use RFC 3339", name)
+		}
+		*target = &t
+	}
+
+	err := validator.New().Struct(data)
+	if err != nil {
+		return nil, fmt.Errorf("format must be jsonl, csv or zip")
+	}
+
+	return data, nil
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gauravst/real-time-chat/internal/api/middleware"
 	"github.com/gauravst/real-time-chat/internal/config"
@@ -14,7 +19,9 @@ import (
 	"github.com/gauravst/real-time-chat/internal/utils/response"
 )
 
-func UploadFileInRoom(fileService services.FileService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
+var uploadExtensionPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+func UploadFileInRoom(chatService services.ChatService, fileService services.FileService, cfg config.Config, wsServer *models.WsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -30,23 +37,26 @@ func UploadFileInRoom(fileService services.FileService, cfg config.Config, wsSer
 			return
 		}
 
-		roomName := r.PathValue("roomName")
-		if roomName == "" {
-			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("Missing room Name")))
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
 			return
 		}
 
-		err := r.ParseMultipartForm(10 << 20) // Limit upload size to 10 MB
-		fmt.Print(err)
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.Uploads.MaxSize+1<<10)
+		err := r.ParseMultipartForm(cfg.Uploads.MaxSize)
 		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.WriteJson(w, http.StatusRequestEntityTooLarge, response.GeneralError(fmt.Errorf("the file is larger than %d bytes", cfg.Uploads.MaxSize)))
+				return
+			}
+
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("Could not parse multipart form")))
 			return
 		}
 
 		content := r.FormValue("message")
-		fmt.Print("Content --------\n")
-		fmt.Print(content)
-		file, _, err := r.FormFile("file")
+		file, header, err := r.FormFile("file")
 		if err != nil {
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("File missing or invalid")))
 			return
@@ -57,25 +67,36 @@ func UploadFileInRoom(fileService services.FileService, cfg config.Config, wsSer
 		uploadDir := "uploads"              // relative to your project
 		os.MkdirAll(uploadDir, os.ModePerm) // ensure it exists
 
-		tempFile, err := os.CreateTemp(uploadDir, "upload-*.png")
+		// storage tells the type of a file by its extension, so the upload keeps it
+		tempFile, err := os.CreateTemp(uploadDir, "upload-*"+uploadExtension(header.Filename))
 		if err != nil {
 			log.Println("Failed to create temp file:", err)
 			http.Error(w, "Failed to save file", http.StatusInternalServerError)
 			return
 		}
+		defer os.Remove(tempFile.Name())
 		defer tempFile.Close()
 
 		_, err = io.Copy(tempFile, file)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("Cannot save file", err)))
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("Cannot save file: %v", err)))
 			return
 		}
 
 		filePath := tempFile.Name()
-		err = fileService.UploadFileInRoom(cfg, filePath, content, roomName, userData, wsServer)
+		err = fileService.UploadFileInRoom(cfg, filePath, header.Filename, content, roomData.Id, userData, wsServer)
 		if err != nil {
-			fmt.Print(err)
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("Something went worng", err)))
+			if errors.Is(err, services.ErrNotRoomMember) || errors.Is(err, services.ErrRoomArchived) {
+				response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+				return
+			}
+
+			if errors.Is(err, services.ErrInvalidImage) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("Something went worng: %v", err)))
 			return
 		}
 
@@ -83,3 +104,62 @@ func UploadFileInRoom(fileService services.FileService, cfg config.Config, wsSer
 		return
 	}
 }
+
+// uploadExtension is the extension of an uploaded file name, empty unless it is short and plain
+func uploadExtension(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !uploadExtensionPattern.MatchString(ext) {
+		return ""
+	}
+	return ext
+}
+
+// GetFile redirects to a file the user can see, or to its thumbnail named by ?variant=. Images
+// smaller than a configured thumbnail have no such variant and redirect to the file itself.
+func GetFile(fileService services.FileService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			http.Error(w, "unauthorized user", http.StatusUnauthorized)
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			http.Error(w, "unauthorized user", http.StatusUnauthorized)
+			return
+		}
+
+		fileId, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid file id")))
+			return
+		}
+
+		name := r.URL.Query().Get("variant")
+		if _, ok := cfg.Uploads.Thumbnails[name]; name != "" && !ok {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("unknown variant %q", name)))
+			return
+		}
+
+		file, err := fileService.GetFile(userData, fileId)
+		if err != nil {
+			if errors.Is(err, services.ErrFileNotFound) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		target := file.SecureUrl
+		if variant, ok := file.Variants[name]; ok {
+			target = variant.SecureUrl
+		}
+
+		// the target doesn't change, but who may see it can
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
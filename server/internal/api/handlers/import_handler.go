@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+// CreateImport saves an uploaded Slack or Discord export and queues it, the archive is
+// streamed to disk since it can be far larger than a normal upload
+func CreateImport(importService services.ImportService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		userData := r.Context().Value(middleware.UserDataKey).(*models.AccessToken)
+
+		source := r.URL.Query().Get("source")
+		if source != services.ImportSlack && source != services.ImportDiscord {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(services.ErrInvalidImportSource))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.Imports.MaxSize)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("Could not parse multipart form")))
+			return
+		}
+
+		var path string
+		for path == "" {
+			part, err := reader.NextPart()
+			if err != nil {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("File missing or invalid")))
+				return
+			}
+
+			if part.FormName() == "file" {
+				path, err = saveImportFile(cfg.Imports, part)
+				if err != nil {
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						response.WriteJson(w, http.StatusRequestEntityTooLarge, response.GeneralError(fmt.Errorf("the export is larger than %d bytes", cfg.Imports.MaxSize)))
+						return
+					}
+
+					response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+					return
+				}
+			}
+			part.Close()
+		}
+
+		data, err := importService.CreateImport(source, path, newAuditActor(r, userData))
+		if err != nil {
+			os.Remove(path)
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/admin/imports/%d", data.Id))
+		response.WriteJson(w, http.StatusAccepted, data)
+		return
+	}
+}
+
+func GetAllImports(importService services.ImportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		data, err := importService.GetAllImports()
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func GetImport(importService services.ImportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid import id")))
+			return
+		}
+
+		data, err := importService.GetImport(id)
+		if err != nil {
+			if errors.Is(err, services.ErrImportNotFound) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+// RetryImport queues a failed import again, it continues where it stopped
+func RetryImport(importService services.ImportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		userData := r.Context().Value(middleware.UserDataKey).(*models.AccessToken)
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid import id")))
+			return
+		}
+
+		err = importService.RetryImport(id, newAuditActor(r, userData))
+		if err != nil {
+			if errors.Is(err, services.ErrImportNotFound) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusAccepted, map[string]string{"success": "ok"})
+		return
+	}
+}
+
+// saveImportFile copies the uploaded export into the import dir, keeping its extension
+// so the import knows whether it is a zip or a single Discord json file
+func saveImportFile(cfg config.Imports, part *multipart.Part) (string, error) {
+	ext := strings.ToLower(filepath.Ext(part.FileName()))
+	if ext != ".zip" && ext != ".json" {
+		return "", fmt.Errorf("the export must be a .zip or .json file")
+	}
+
+	err := os.MkdirAll(cfg.Dir, 0o700)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(cfg.Dir, "import-*"+ext)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(file, part)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	slog.Info("import uploaded", slog.String("path", file.Name()))
+	return file.Name(), nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+func GetAllInvites(chatService services.ChatService, inviteService services.InviteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		data, err := inviteService.GetAllInvites(roomData.Id)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func CreateInvite(chatService services.ChatService, inviteService services.InviteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		if !roomData.Private {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("public rooms don't need invites")))
+			return
+		}
+
+		var data models.InviteRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		invite, err := inviteService.CreateInvite(roomData.Id, userData.UserId, &data, newAuditActor(r, userData))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusCreated, invite)
+		return
+	}
+}
+
+func RevokeInvite(chatService services.ChatService, inviteService services.InviteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		idInt, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid invite id")))
+			return
+		}
+
+		err = inviteService.RevokeInvite(roomData.Id, idInt, newAuditActor(r, userData))
+		if err != nil {
+			if err.Error() == "invite not found" {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "invite revoked"})
+		return
+	}
+}
+
+// getManagedRoom loads the room of the request, only its owner or an admin may manage it.
+// It writes the error response itself.
+func getManagedRoom(w http.ResponseWriter, r *http.Request, chatService services.ChatService, userData *models.AccessToken) (*models.ChatRoom, bool) {
+	roomData, ok := resolveRoom(w, r, chatService, userData)
+	if !ok {
+		return nil, false
+	}
+
+	if userData.Role != "ADMIN" && roomData.UserId != userData.UserId {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("unauthorized user")))
+		return nil, false
+	}
+
+	return roomData, true
+}
+
+func writeInviteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInvite):
+		response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+	case errors.Is(err, services.ErrAlreadyMember):
+		response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+	case errors.Is(err, services.ErrBlocked), errors.Is(err, services.ErrRoomArchived):
+		response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+	case errors.Is(err, services.ErrTooManyAttempts):
+		response.WriteJson(w, http.StatusTooManyRequests, response.GeneralError(err))
+	default:
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+func GetPendingJoinRequests(chatService services.ChatService, joinRequestService services.JoinRequestService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		if !checkJoinRequestManager(w, joinRequestService, userData, roomData.Id) {
+			return
+		}
+
+		data, err := joinRequestService.GetPendingJoinRequests(roomData.Id)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func DecideJoinRequest(chatService services.ChatService, joinRequestService services.JoinRequestService, approve bool, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		if !checkJoinRequestManager(w, joinRequestService, userData, roomData.Id) {
+			return
+		}
+
+		idInt, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid request id")))
+			return
+		}
+
+		data, err := joinRequestService.DecideJoinRequest(roomData.Id, idInt, approve, userData.UserId, wsServer)
+		if err != nil {
+			if err.Error() == "request not found" {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func GetUserJoinRequests(joinRequestService services.JoinRequestService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, err := joinRequestService.GetUserJoinRequests(userData.UserId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+// checkJoinRequestManager makes sure the user may answer join requests of the room,
+// it writes the error response itself
+func checkJoinRequestManager(w http.ResponseWriter, joinRequestService services.JoinRequestService, userData *models.AccessToken, roomId int) bool {
+	allowed, err := joinRequestService.CanManageJoinRequests(userData, roomId)
+	if err != nil {
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+		return false
+	}
+
+	if !allowed {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("unauthorized user")))
+		return false
+	}
+
+	return true
+}
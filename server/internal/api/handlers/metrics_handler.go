@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// GetMetrics serves the expvar variables, the job counters of the metrics package among them
+func GetMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+
+		expvar.Handler().ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+func GetOIDCProviders(oidcService services.OIDCService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.WriteJson(w, http.StatusOK, map[string][]string{"providers": oidcService.GetProviders()})
+		return
+	}
+}
+
+func OIDCLogin(oidcService services.OIDCService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.PathValue("provider")
+
+		authUrl, stateToken, err := oidcService.AuthCodeURL(r.Context(), provider, 0, cfg)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		jwtToken.SetOIDCState(w, r, stateToken, false)
+		response.RedirectToURL(w, r, authUrl, http.StatusFound)
+	}
+}
+
+func LinkOIDCIdentity(oidcService services.OIDCService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		provider := r.PathValue("provider")
+
+		authUrl, stateToken, err := oidcService.AuthCodeURL(r.Context(), provider, userData.UserId, cfg)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		jwtToken.SetOIDCState(w, r, stateToken, false)
+		response.RedirectToURL(w, r, authUrl, http.StatusFound)
+	}
+}
+
+func OIDCCallback(oidcService services.OIDCService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.PathValue("provider")
+		query := r.URL.Query()
+
+		// login state can only be used once
+		jwtToken.RemoveOIDCState(w, r, false)
+
+		if providerErr := query.Get("error"); providerErr != "" {
+			redirectLoginError(w, r, cfg, providerErr)
+			return
+		}
+
+		cookie, err := r.Cookie("oidcState")
+		if err != nil {
+			redirectLoginError(w, r, cfg, services.ErrInvalidOIDCState.Error())
+			return
+		}
+
+		session := clientinfo.NewLoginSession(r, provider)
+		tokens, _, err := oidcService.Callback(r.Context(), provider, query.Get("code"), query.Get("state"), cookie.Value, session, cfg)
+		if err != nil {
+			slog.Error("oidc login failed", slog.String("provider", provider), slog.String("error", err.Error()))
+			redirectLoginError(w, r, cfg, err.Error())
+			return
+		}
+
+		if tokens.Challenge != "" {
+			response.RedirectToURL(w, r, cfg.ClientUrl+"/login?challenge="+url.QueryEscape(tokens.Challenge), http.StatusFound)
+			return
+		}
+
+		// same cookies as a password login
+		jwtToken.SetAccessToken(w, r, tokens.AccessToken, false)
+		jwtToken.SetRefreshToken(w, r, tokens.RefreshToken, tokens.RefreshExpiresAt, false)
+
+		response.RedirectToURL(w, r, cfg.ClientUrl, http.StatusFound)
+	}
+}
+
+func GetAllIdentities(oidcService services.OIDCService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		// Correct the type assertion to *models.AccessToken
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		data, err := oidcService.GetAllIdentities(userData.UserId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+// redirectLoginError sends the browser back to the client login page with the error
+func redirectLoginError(w http.ResponseWriter, r *http.Request, cfg config.Config, message string) {
+	response.RedirectToURL(w, r, cfg.ClientUrl+"/login?error="+url.QueryEscape(message), http.StatusFound)
+}
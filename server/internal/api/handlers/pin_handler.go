@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+func GetPinnedMessages(chatService services.ChatService, pinService services.PinService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := resolveRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		// pins show message content, like the history they are only for members
+		canRead, err := canReadRoomHistory(chatService, userData, roomData.Id)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		if !canRead {
+			response.WriteJson(w, http.StatusForbidden, response.GeneralError(services.ErrNotRoomMember))
+			return
+		}
+
+		data, err := pinService.GetPinnedMessages(roomData.Id)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, data)
+		return
+	}
+}
+
+func PinMessage(chatService services.ChatService, pinService services.PinService, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getModeratedRoom(w, r, chatService, pinService, userData)
+		if !ok {
+			return
+		}
+
+		messageId, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid message id")))
+			return
+		}
+
+		pin, err := pinService.PinMessage(roomData, messageId, newAuditActor(r, userData), wsServer)
+		if err != nil {
+			writePinError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusCreated, pin)
+		return
+	}
+}
+
+func UnpinMessage(chatService services.ChatService, pinService services.PinService, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		roomData, ok := getModeratedRoom(w, r, chatService, pinService, userData)
+		if !ok {
+			return
+		}
+
+		messageId, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid message id")))
+			return
+		}
+
+		err = pinService.UnpinMessage(roomData, messageId, newAuditActor(r, userData), wsServer)
+		if err != nil {
+			writePinError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "message unpinned"})
+		return
+	}
+}
+
+func SetRoomTopic(chatService services.ChatService, pinService services.PinService, wsServer *models.WsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.TopicRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		roomData, ok := getModeratedRoom(w, r, chatService, pinService, userData)
+		if !ok {
+			return
+		}
+
+		message, err := pinService.SetRoomTopic(roomData, strings.TrimSpace(data.Topic), newAuditActor(r, userData), wsServer)
+		if err != nil {
+			writePinError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, message)
+		return
+	}
+}
+
+// canReadRoomHistory reports whether the user may see the messages of the room
+func canReadRoomHistory(chatService services.ChatService, userData *models.AccessToken, roomId int) (bool, error) {
+	if userData.Role == "ADMIN" {
+		return true, nil
+	}
+
+	return chatService.CheckChatRoomMember(userData.UserId, roomId)
+}
+
+// getModeratedRoom resolves the room from the path and makes sure the user may moderate it,
+// it writes the error response itself
+func getModeratedRoom(w http.ResponseWriter, r *http.Request, chatService services.ChatService, pinService services.PinService, userData *models.AccessToken) (*models.ChatRoom, bool) {
+	roomData, ok := resolveRoom(w, r, chatService, userData)
+	if !ok {
+		return nil, false
+	}
+
+	allowed, err := pinService.CanModerateRoom(userData, roomData.Id)
+	if err != nil {
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+		return nil, false
+	}
+
+	if !allowed {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("unauthorized user")))
+		return nil, false
+	}
+
+	return roomData, true
+}
+
+func writePinError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrMessageNotFound), errors.Is(err, services.ErrPinNotFound):
+		response.WriteJson(w, http.StatusNotFound, response.GeneralError(err))
+	case errors.Is(err, services.ErrAlreadyPinned), errors.Is(err, services.ErrPinLimit):
+		response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+	case errors.Is(err, services.ErrRoomArchived):
+		response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+	default:
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+	}
+}
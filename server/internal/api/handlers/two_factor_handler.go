@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+	"github.com/go-playground/validator/v10"
+)
+
+func VerifyTwoFactor(authService services.AuthService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data models.TwoFactorLoginRequest
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body")))
+			return
+		}
+
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		// Request validation
+		err = validator.New().Struct(data)
+		if err != nil {
+			validateErrs := err.(validator.ValidationErrors)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateErrs))
+			return
+		}
+
+		session := clientinfo.NewLoginSession(r, data.DeviceName)
+		tokens, userData, err := authService.VerifyTwoFactor(&data, session, cfg)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+
+		// seting new access and refresh token
+		jwtToken.SetAccessToken(w, r, tokens.AccessToken, false)
+		jwtToken.SetRefreshToken(w, r, tokens.RefreshToken, tokens.RefreshExpiresAt, false)
+
+		// return response
+		response.WriteJson(w, http.StatusCreated, userData)
+		return
+	}
+}
+
+func EnrollTwoFactor(twoFactorService services.TwoFactorService, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		enrollment, err := twoFactorService.Enroll(userData, cfg)
+		if err != nil {
+			if err.Error() == "2fa already enabled" {
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(err))
+				return
+			}
+
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, enrollment)
+		return
+	}
+}
+
+func ConfirmTwoFactor(twoFactorService services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userData, data, ok := decodeTwoFactorCode(w, r)
+		if !ok {
+			return
+		}
+
+		recoveryCodes, err := twoFactorService.Confirm(userData.UserId, data.Code)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+
+		// recovery codes are only returned here, they are stored hashed
+		response.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"recoveryCodes": recoveryCodes,
+		})
+		return
+	}
+}
+
+func DisableTwoFactor(twoFactorService services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userData, data, ok := decodeTwoFactorCode(w, r)
+		if !ok {
+			return
+		}
+
+		err := twoFactorService.Disable(userData.UserId, data.Code)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "2fa disabled"})
+		return
+	}
+}
+
+// decodeTwoFactorCode reads the current user and the code from the request, it writes the error response itself
+func decodeTwoFactorCode(w http.ResponseWriter, r *http.Request) (*models.AccessToken, *models.TwoFactorCodeRequest, bool) {
+	userDataRaw := r.Context().Value(middleware.UserDataKey)
+	if userDataRaw == nil {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+		return nil, nil, false
+	}
+
+	userData, ok := userDataRaw.(*models.AccessToken)
+	if !ok {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+		return nil, nil, false
+	}
+
+	var data models.TwoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if errors.Is(err, io.EOF) {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body")))
+		return nil, nil, false
+	}
+
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+		return nil, nil, false
+	}
+
+	err = validator.New().Struct(data)
+	if err != nil {
+		validateErrs := err.(validator.ValidationErrors)
+		response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateErrs))
+		return nil, nil, false
+	}
+
+	return userData, &data, true
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrTooManyAttempts):
+		response.WriteJson(w, http.StatusTooManyRequests, response.GeneralError(err))
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrInvalidChallenge):
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+	default:
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+	}
+}
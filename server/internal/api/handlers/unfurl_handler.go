@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gauravst/real-time-chat/internal/api/middleware"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/services"
+	"github.com/gauravst/real-time-chat/internal/utils/response"
+)
+
+func SetRoomUnfurl(chatService services.ChatService, unfurlService services.UnfurlService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDataRaw := r.Context().Value(middleware.UserDataKey)
+		if userDataRaw == nil {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		userData, ok := userDataRaw.(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("Unauthorized")))
+			return
+		}
+
+		var data models.UnfurlRequest
+		if !decodeAndValidate(w, r, &data) {
+			return
+		}
+
+		roomData, ok := getManagedRoom(w, r, chatService, userData)
+		if !ok {
+			return
+		}
+
+		err := unfurlService.SetRoomUnfurl(roomData, *data.Enabled, newAuditActor(r, userData))
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		roomData.UnfurlLinks = *data.Enabled
+		response.WriteJson(w, http.StatusOK, roomData)
+		return
+	}
+}
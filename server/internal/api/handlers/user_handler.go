@@ -44,7 +44,7 @@ func GetAllUsers(userService services.UserService) http.HandlerFunc {
 	}
 }
 
-func GetUser(userService services.UserService) http.HandlerFunc {
+func GetUser(userService services.UserService, profileService services.ProfileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get value from context
 		userDataRaw := r.Context().Value(middleware.UserDataKey)
@@ -60,11 +60,18 @@ func GetUser(userService services.UserService) http.HandlerFunc {
 			return
 		}
 
+		// the avatar can change while the token is alive, read it fresh
+		profile, err := profileService.GetProfile(userData.UserId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
 		data := &models.User{
 			Id:         userData.UserId,
 			Username:   userData.Username,
 			Role:       userData.Role,
-			ProfilePic: userData.ProfilePic,
+			ProfilePic: profile.AvatarUrl,
 		}
 
 		response.WriteJson(w, http.StatusOK, data)
@@ -162,7 +169,9 @@ func UpdateUser(userService services.UserService) http.HandlerFunc {
 			return
 		}
 
-		err = userService.UpdateUser(&data)
+		// the path decides which user is updated
+		data.Id = idInt
+		err = userService.UpdateUser(&data, newAuditActor(r, userData))
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
@@ -206,7 +215,7 @@ func DeleteUser(userService services.UserService) http.HandlerFunc {
 			return
 		}
 
-		err = userService.DeleteUser(idInt)
+		err = userService.DeleteUser(idInt, newAuditActor(r, userData))
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
 			return
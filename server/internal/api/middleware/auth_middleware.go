@@ -4,22 +4,25 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/services"
 	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
 	"github.com/gauravst/real-time-chat/internal/utils/response"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type contextKey string
 
 const UserDataKey contextKey = "userData"
 
-func Auth(cfg *config.Config, authService services.AuthService) func(http.Handler) http.Handler {
+// apiTokenDataKey holds the caller of a personal access token request until
+// RequireScope allows the route, handlers only ever read UserDataKey
+const apiTokenDataKey contextKey = "apiTokenData"
+
+func Auth(cfg *config.Config, authService services.AuthService, apiTokenService services.ApiTokenService, keys *jwtToken.KeySet) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract the token from the request headers
@@ -38,52 +41,47 @@ func Auth(cfg *config.Config, authService services.AuthService) func(http.Handle
 				}
 			}
 
-			// If the token is valid, call the next handler
-			// var userData models.User
-			userData, err := jwtToken.VerifyJwtAndGetData[models.AccessToken](token, cfg.JwtPrivateKey)
-			if err != nil {
-				if err.Error() == "token has expired" {
-					// log.Print("Token has expired. Please reauthenticate.")
-					// accessToken expired, give client next token here
-					refreshToken, err := authService.GetRefreshToken(userData.UserId)
-					if err != nil {
-						//remove accessToken here
-						jwtToken.RemoveAccessToken(w, r, false)
-						response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
-						return
-					}
-
-					//1) get refresh token check it is valid or not
-					_, err = jwtToken.VerifyJwtAndGetData[models.AccessToken](refreshToken, cfg.JwtPrivateKey)
-					if err != nil {
-						// remove accessToken here
-						jwtToken.RemoveAccessToken(w, r, false)
-						response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
-						return
-					}
-
-					//2) if refresh token valid genrete accessToken
-					claims := jwt.MapClaims{
-						"userId":   userData.UserId,
-						"username": userData.Username,
-						"role":     userData.Role,
-						"exp":      time.Now().Add(30 * time.Minute).Unix(),
-					}
-					newAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-					newAccessTokenString, err := newAccessToken.SignedString([]byte(cfg.JwtPrivateKey))
-					if err != nil {
-						jwtToken.RemoveAccessToken(w, r, false)
-						response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
-						return
-					}
-
-					jwtToken.SetAccessToken(w, r, newAccessTokenString, false)
-				} else {
-					//remove accessToken here
-					jwtToken.RemoveAccessToken(w, r, false)
+			// personal access tokens only reach routes wrapped with RequireScope
+			if strings.HasPrefix(token, services.ApiTokenPrefix) {
+				userData, err := apiTokenService.Authenticate(token)
+				if err != nil {
 					response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
 					return
 				}
+
+				// tokens never passed 2FA
+				if slices.Contains(cfg.Auth.Require2FARoles, userData.Role) {
+					userData.Role = "USER"
+				}
+
+				ctx := context.WithValue(r.Context(), apiTokenDataKey, userData)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// expired tokens are rejected, clients exchange their refresh token at /api/auth/refresh
+			userData, err := jwtToken.VerifyJwtAndGetData[models.AccessToken](token, cfg.JWT.Audience, keys)
+			if err == nil && userData.Purpose != "" {
+				// state and challenge tokens are signed with the same key but are not access tokens
+				err = errors.New("invalid access token")
+			}
+			if err != nil {
+				jwtToken.RemoveAccessToken(w, r, false)
+				response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
+				return
+			}
+
+			// session must still exist, revoked devices are logged out here
+			err = authService.TouchSession(userData.UserId, userData.SessionId)
+			if err != nil {
+				jwtToken.RemoveAccessToken(w, r, false)
+				response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err))
+				return
+			}
+
+			// privileged roles only apply to sessions that passed 2FA
+			if !userData.Mfa && slices.Contains(cfg.Auth.Require2FARoles, userData.Role) {
+				userData.Role = "USER"
 			}
 
 			ctx := context.WithValue(r.Context(), UserDataKey, userData)
@@ -92,3 +90,41 @@ func Auth(cfg *config.Config, authService services.AuthService) func(http.Handle
 		})
 	}
 }
+
+// RequireScope opens a route to personal access tokens that have scope. Routes that find a
+// room by {code} are closed to tokens limited to rooms, the room of a {slug} route is checked
+// by the handler once it is resolved. Login sessions are not affected.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return RequireScopes([]string{scope}, next)
+}
+
+// RequireScopes is RequireScope for routes that need every one of scopes
+func RequireScopes(scopes []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(UserDataKey) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userData, ok := r.Context().Value(apiTokenDataKey).(*models.AccessToken)
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(errors.New("Unauthorized")))
+			return
+		}
+
+		for _, scope := range scopes {
+			if !slices.Contains(userData.Scopes, scope) {
+				response.WriteJson(w, http.StatusForbidden, response.GeneralError(services.ErrApiTokenScope))
+				return
+			}
+		}
+
+		if len(userData.Rooms) > 0 && r.PathValue("code") != "" {
+			response.WriteJson(w, http.StatusForbidden, response.GeneralError(services.ErrApiTokenRoom))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserDataKey, userData)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+
+	clientinfo "github.com/gauravst/real-time-chat/internal/utils/clientInfo"
+)
+
+// ClientIp resolves the client address of every request once, X-Forwarded-For is only
+// honoured when the connection comes from one of the trusted proxies
+func ClientIp(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := clientinfo.WithIp(r.Context(), clientinfo.ResolveIp(r, trusted))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -19,7 +19,10 @@ func CORS(cfg *config.Config) func(http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 			// Allowed headers
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-Id")
+
+			// Response headers the client may read
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id, X-Next-Cursor")
 
 			// Handle preflight requests
 			if r.Method == "OPTIONS" {
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+)
+
+const requestIdKey contextKey = "requestId"
+
+// requestIdPattern limits ids taken from the client to something safe to log
+var requestIdPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// RequestId gives every request an id, taken from X-Request-Id when a proxy set one,
+// and returns it in the X-Request-Id response header
+func RequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !requestIdPattern.MatchString(id) {
+			id, _ = securetoken.Generate(12)
+		}
+
+		w.Header().Set("X-Request-Id", id)
+		ctx := context.WithValue(r.Context(), requestIdKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestId returns the id set by RequestId
+func GetRequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey).(string)
+	return id
+}
@@ -4,14 +4,18 @@ import (
 	"flag"
 	"log"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
 )
 
+// HTTPServer is where the server listens. TrustedProxies are the addresses or CIDR ranges of
+// the proxies in front of it, X-Forwarded-For is ignored on requests from anywhere else.
 type HTTPServer struct {
-	Address string `yaml:"address" env-required:"true"`
-	Port    int    `yaml:"port" env-required:"true"`
+	Address        string   `yaml:"address" env-required:"true"`
+	Port           int      `yaml:"port" env-required:"true"`
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
 }
 
 type Cloudinary struct {
@@ -20,14 +24,166 @@ type Cloudinary struct {
 	SecretKey string `env:"CLOUDINARY_API_SECRET" env-required:"true"`
 }
 
+// WebSocket controls liveness checks and limits for chat connections
+type WebSocket struct {
+	PingInterval   time.Duration `yaml:"ping_interval" env:"WS_PING_INTERVAL" env-default:"30s"`
+	PongWait       time.Duration `yaml:"pong_wait" env:"WS_PONG_WAIT" env-default:"60s"`
+	WriteWait      time.Duration `yaml:"write_wait" env:"WS_WRITE_WAIT" env-default:"10s"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout" env:"WS_IDLE_TIMEOUT" env-default:"30m"`
+	MaxMessageSize int64         `yaml:"max_message_size" env:"WS_MAX_MESSAGE_SIZE" env-default:"65536"`
+}
+
+// JWT points to the PEM keys tokens are signed with, see jwtToken.LoadKeySet.
+// Without KeysDir a throwaway key is generated, which is only allowed in dev.
+// Access tokens carry Issuer as iss and Audience as aud, services that verify them with the
+// published keys should check both.
+type JWT struct {
+	KeysDir      string `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+	SigningKeyId string `yaml:"signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+	Issuer       string `yaml:"issuer" env:"JWT_ISSUER" env-default:"real-time-chat"`
+	Audience     string `yaml:"audience" env:"JWT_AUDIENCE" env-default:"real-time-chat-api"`
+}
+
+// PasswordPolicy is checked when an account sets a password
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+}
+
+// Auth controls token lifetimes and who can create accounts.
+// DisableRegistration also turns off guest accounts and new users from OIDC providers, for private
+// deployments. Identities that are already linked still sign in.
+// Users in Require2FARoles only keep their role on sessions that passed two-factor authentication.
+type Auth struct {
+	AccessTokenTTL      time.Duration  `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" env-default:"30m"`
+	RefreshTokenTTL     time.Duration  `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+	DisableRegistration bool           `yaml:"disable_registration" env:"DISABLE_REGISTRATION"`
+	PasswordPolicy      PasswordPolicy `yaml:"password_policy"`
+	TwoFactorIssuer     string         `yaml:"two_factor_issuer" env-default:"Sync Talk"`
+	Require2FARoles     []string       `yaml:"require_2fa_roles"`
+	EmailVerifyTTL      time.Duration  `yaml:"email_verify_ttl" env:"EMAIL_VERIFY_TTL" env-default:"48h"`
+	PasswordResetTTL    time.Duration  `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" env-default:"1h"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" env-default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+}
+
+// Mail picks how emails are delivered.
+// Driver is "smtp", "log" (print to the server log) or "file" (write .eml files into Dir).
+type Mail struct {
+	Driver string `yaml:"driver" env:"MAIL_DRIVER" env-default:"log"`
+	From   string `yaml:"from" env:"MAIL_FROM" env-default:"Sync Talk <no-reply@localhost>"`
+	Dir    string `yaml:"dir" env:"MAIL_DIR" env-default:"mail"`
+	SMTP   SMTP   `yaml:"smtp"`
+}
+
+// Guests controls cleanup of accounts created by loginWithoutAuth.
+// Mode is "delete" or "anonymize", guests owning rooms are always anonymized.
+type Guests struct {
+	TTL             time.Duration `yaml:"ttl" env:"GUEST_TTL" env-default:"720h"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env:"GUEST_CLEANUP_INTERVAL" env-default:"1h"`
+	Mode            string        `yaml:"mode" env:"GUEST_CLEANUP_MODE" env-default:"delete"`
+}
+
+// Rooms controls deleted rooms. They can be restored within RestoreWindow, after that
+// the purge job removes them together with their messages, memberships and files.
+type Rooms struct {
+	RestoreWindow time.Duration `yaml:"restore_window" env:"ROOM_RESTORE_WINDOW" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"ROOM_PURGE_INTERVAL" env-default:"1h"`
+	MaxPins       int           `yaml:"max_pins" env:"ROOM_MAX_PINS" env-default:"50"`
+}
+
+// Retention removes messages older than the retention of their room. DefaultDays applies
+// to rooms without their own setting, 0 keeps messages forever. Mode is "delete" or "redact",
+// redacted messages stay in the history without content. Files only used by them are deleted.
+type Retention struct {
+	DefaultDays int           `yaml:"default_days" env:"RETENTION_DEFAULT_DAYS" env-default:"0"`
+	Interval    time.Duration `yaml:"interval" env:"RETENTION_INTERVAL" env-default:"1h"`
+	BatchSize   int           `yaml:"batch_size" env:"RETENTION_BATCH_SIZE" env-default:"500"`
+	Mode        string        `yaml:"mode" env:"RETENTION_MODE" env-default:"delete"`
+}
+
+// Exports controls room history exports. Background exports are written to Dir, can be
+// downloaded for TTL and are given up on after Timeout.
+type Exports struct {
+	Dir             string        `yaml:"dir" env:"EXPORT_DIR" env-default:"exports"`
+	TTL             time.Duration `yaml:"ttl" env:"EXPORT_TTL" env-default:"24h"`
+	Timeout         time.Duration `yaml:"timeout" env:"EXPORT_TIMEOUT" env-default:"1h"`
+	PollInterval    time.Duration `yaml:"poll_interval" env:"EXPORT_POLL_INTERVAL" env-default:"30s"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env:"EXPORT_CLEANUP_INTERVAL" env-default:"1h"`
+}
+
+// Imports controls imports of Slack and Discord exports. Uploaded archives are kept in Dir
+// until their import worked. SlackToken is sent when downloading the files of a Slack export from
+// the Slack file host.
+type Imports struct {
+	Dir          string        `yaml:"dir" env:"IMPORT_DIR" env-default:"imports"`
+	MaxSize      int64         `yaml:"max_size" env:"IMPORT_MAX_SIZE" env-default:"1073741824"`
+	Timeout      time.Duration `yaml:"timeout" env:"IMPORT_TIMEOUT" env-default:"6h"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"IMPORT_POLL_INTERVAL" env-default:"30s"`
+	SlackToken   string        `yaml:"slack_token" env:"IMPORT_SLACK_TOKEN"`
+}
+
+// Unfurl controls link previews. Workers fetch the pages in the background, at most MaxLinks per
+// message and MaxBytes per page. Previews are cached for CacheTTL, pages without one for FailureTTL.
+type Unfurl struct {
+	Enabled         bool          `yaml:"enabled" env:"UNFURL_ENABLED" env-default:"true"`
+	Workers         int           `yaml:"workers" env:"UNFURL_WORKERS" env-default:"4"`
+	QueueSize       int           `yaml:"queue_size" env:"UNFURL_QUEUE_SIZE" env-default:"256"`
+	MaxLinks        int           `yaml:"max_links" env:"UNFURL_MAX_LINKS" env-default:"3"`
+	MaxBytes        int64         `yaml:"max_bytes" env:"UNFURL_MAX_BYTES" env-default:"524288"`
+	Timeout         time.Duration `yaml:"timeout" env:"UNFURL_TIMEOUT" env-default:"5s"`
+	UserAgent       string        `yaml:"user_agent" env:"UNFURL_USER_AGENT" env-default:"SyncTalkBot/1.0 (link preview)"`
+	CacheTTL        time.Duration `yaml:"cache_ttl" env:"UNFURL_CACHE_TTL" env-default:"24h"`
+	FailureTTL      time.Duration `yaml:"failure_ttl" env:"UNFURL_FAILURE_TTL" env-default:"1h"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env:"UNFURL_CLEANUP_INTERVAL" env-default:"1h"`
+}
+
+// Uploads controls files sent to rooms. Images get a thumbnail for every entry of Thumbnails,
+// name to longest side in pixels, and are encoded with Quality when they need to be.
+type Uploads struct {
+	MaxSize    int64          `yaml:"max_size" env:"UPLOAD_MAX_SIZE" env-default:"10485760"`
+	Thumbnails map[string]int `yaml:"thumbnails" env:"UPLOAD_THUMBNAILS" env-default:"small:160,medium:480,large:1280"`
+	Quality    int            `yaml:"quality" env:"UPLOAD_QUALITY" env-default:"85"`
+}
+
+// OIDCProvider is an OpenID Connect identity provider users can sign in with.
+// ClientSecret may be empty for public clients, PKCE is always used.
+type OIDCProvider struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientId     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectUrl  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+}
+
 type Config struct {
 	Env           string `yaml:"env" env-required:"true" env-default:"production"`
 	DatabaseUri   string `env:"DATABASE_URI" env-required:"true"`
-	JwtPrivateKey string `env:"JWT_PRIVATE_KEY" env-required:"true"`
 	ClientUrl     string `env:"CLIENT_URL" env-required:"true"`
 	EnvPort       int    `env:"PORT"`
 	HTTPServer    `yaml:"http_server"`
 	Cloudinary    Cloudinary
+	JWT           JWT            `yaml:"jwt"`
+	WebSocket     WebSocket      `yaml:"websocket"`
+	Auth          Auth           `yaml:"auth"`
+	Guests        Guests         `yaml:"guests"`
+	Rooms         Rooms          `yaml:"rooms"`
+	Retention     Retention      `yaml:"retention"`
+	Exports       Exports        `yaml:"exports"`
+	Imports       Imports        `yaml:"imports"`
+	Unfurl        Unfurl         `yaml:"unfurl"`
+	Uploads       Uploads        `yaml:"uploads"`
+	Mail          Mail           `yaml:"mail"`
+	OIDCProviders []OIDCProvider `yaml:"oidc_providers"`
 }
 
 func ConfigMustLoad() *Config {
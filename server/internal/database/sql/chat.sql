@@ -1,35 +1,29 @@
--- name: GetAllChatRoom
-SELECT
-  cr.id,
-  cr.name,
-  cr.private,
-  cr.description,
-  cr.userid,
-  COUNT(gm.id) AS members
-FROM
-  chatroom cr
-  LEFT JOIN groupMembers gm ON cr.name = gm.roomName
-WHERE
-  cr.private = false
-  OR cr.userid = $1
-GROUP BY
-  cr.id;
-
 -- name: GetAllJoinRoom
 SELECT
   cr.id,
   cr.name,
+  cr.slug,
   cr.description,
   cr.private,
   cr.userId,
-  COUNT(gm.id) AS members
+  cr.archivedAt,
+  cr.memberCount,
+  ARRAY(
+    SELECT
+      t.tag
+    FROM
+      roomTags t
+    WHERE
+      t.roomId = cr.id
+    ORDER BY
+      t.tag
+  ) AS tags
 FROM
   chatRoom cr
-  LEFT JOIN groupMembers gm ON cr.name = gm.roomName
+  JOIN groupMembers gm ON cr.id = gm.roomId
 WHERE
   gm.userId = $1
-GROUP BY
-  cr.id;
+  AND cr.deletedAt IS NULL;
 
 -- name: GetOldMessages
 SELECT
@@ -38,12 +32,21 @@ FROM
   (
     SELECT
       m.id,
+      m.type,
       m.userId,
       u.username,
+      COALESCE(u.displayName, '') AS displayName,
+      COALESCE(u.profilePic, '') AS profilePic,
+      CASE
+        WHEN u.statusExpiresAt IS NULL OR u.statusExpiresAt > NOW() THEN COALESCE(u.statusText, '')
+        ELSE ''
+      END AS statusText,
       m.content,
-      m.roomName,
+      m.roomId,
+      cr.name AS roomName,
       m.createdAt AS messageCreatedAt,
       m.updatedAt AS messageUpdatedAt,
+      m.redactedAt,
       f.id AS fileId,
       f.publicId,
       f.secureUrl,
@@ -54,13 +57,61 @@ FROM
       f.height,
       f.originalFilename,
       f.createdAt AS fileCreatedAt,
-      f.updatedAt AS fileUpdatedAt
+      f.updatedAt AS fileUpdatedAt,
+      (
+        SELECT
+          json_agg(
+            json_build_object(
+              'url', lp.url,
+              'title', lp.title,
+              'description', lp.description,
+              'siteName', lp.siteName,
+              'imageUrl', lp.imageUrl
+            )
+            ORDER BY
+              mp.position
+          )
+        FROM
+          messagePreviews mp
+          JOIN linkPreviews lp ON lp.url = mp.url
+        WHERE
+          mp.messageId = m.id
+          AND lp.ok
+          AND cr.unfurlLinks
+      ) AS previews,
+      (
+        SELECT
+          json_object_agg(
+            fv.name,
+            json_build_object(
+              'secureUrl', fv.secureUrl,
+              'format', fv.format,
+              'bytes', fv.size,
+              'width', fv.width,
+              'height', fv.height
+            )
+          )
+        FROM
+          fileVariants fv
+        WHERE
+          fv.fileId = f.id
+      ) AS fileVariants
     FROM
       messages m
       JOIN users u ON m.userId = u.id
+      JOIN chatRoom cr ON m.roomId = cr.id
       LEFT JOIN files f ON m.fileId = f.id
     WHERE
-      m.roomName = $1
+      m.roomId = $1
+      AND NOT EXISTS (
+        SELECT
+          1
+        FROM
+          userBlocks b
+        WHERE
+          b.blockerId = $3
+          AND b.blockedId = m.userId
+      )
     ORDER BY
       m.createdAt DESC
     LIMIT
@@ -73,13 +124,14 @@ ORDER BY
 SELECT
   cr.id,
   cr.name,
+  cr.slug,
   cr.private,
   cr.description,
   cr.userid,
   COUNT(gm.id) AS members
 FROM
   chatroom cr
-  LEFT JOIN groupMembers gm ON cr.name = gm.roomName
+  LEFT JOIN groupMembers gm ON cr.id = gm.roomId
 WHERE
   cr.private = true
   AND cr.code = $1
@@ -90,7 +142,7 @@ GROUP BY
 SELECT
   m.id,
   m.userId,
-  m.roomName,
+  m.roomId,
   m.content,
   m.createdAt,
   m.updatedAt,
@@ -101,7 +153,7 @@ FROM
   messages m
   LEFT JOIN files f ON m.fileId = f.id
 WHERE
-  m.roomName = $1
+  m.roomId = $1
 ORDER BY
   m.createdAt DESC
 LIMIT
@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Every runs fn once per interval until ctx is cancelled. Errors are logged
+// and the job keeps running on the next tick.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	if interval <= 0 {
+		slog.Warn("job disabled", slog.String("job", name))
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			err := fn(ctx)
+			if err != nil {
+				slog.Error("job failed", slog.String("job", name), slog.String("error", err.Error()))
+				continue
+			}
+			slog.Info("job finished", slog.String("job", name), slog.Duration("took", time.Since(start)))
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+)
+
+// fileMailer writes every email as a .eml file into dir
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.dir, 0o750)
+	if err != nil {
+		return err
+	}
+
+	suffix, err := securetoken.Generate(6)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), suffix)
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o640)
+}
@@ -0,0 +1,11 @@
+package mailer
+
+import "log/slog"
+
+// logMailer prints emails to the server log instead of sending them
+type logMailer struct{}
+
+func (m *logMailer) Send(msg Message) error {
+	slog.Info("mail", slog.String("to", msg.To), slog.String("subject", msg.Subject), slog.String("body", msg.Body))
+	return nil
+}
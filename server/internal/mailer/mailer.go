@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails, the driver is picked by config so development works offline
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer for cfg.Driver, "smtp", "log" or "file"
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("smtp host not set")
+		}
+		return &smtpMailer{cfg: cfg}, nil
+	case "log", "":
+		return &logMailer{}, nil
+	case "file":
+		return &fileMailer{from: cfg.From, dir: cfg.Dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %s", cfg.Driver)
+	}
+}
+
+// build renders msg as an RFC 5322 message, headers with line breaks are rejected
+func build(from string, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("invalid mail header")
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+)
+
+type smtpMailer struct {
+	cfg config.Mail
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	data, err := build(m.cfg.From, msg)
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp upgrades to TLS with STARTTLS when the server supports it
+	var auth smtp.Auth
+	if m.cfg.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTP.Username, m.cfg.SMTP.Password, m.cfg.SMTP.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.SMTP.Host, strconv.Itoa(m.cfg.SMTP.Port))
+	return smtp.SendMail(addr, auth, from.Address, []string{msg.To}, data)
+}
@@ -0,0 +1,13 @@
+// Package metrics publishes counters of the server through expvar,
+// they are served to admins by GET /api/admin/metrics
+package metrics
+
+import "expvar"
+
+// Retention counts what the message retention job did: runs, failures, messagesDeleted,
+// messagesRedacted, filesDeleted and the lastRunAt and lastRunMillis of the last run
+var Retention = expvar.NewMap("retention")
+
+// Unfurl counts link previews: fetched pages, failed fetches, cached previews that were used
+// and messages dropped because the queue was full
+var Unfurl = expvar.NewMap("unfurl")
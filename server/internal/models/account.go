@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Purposes of an EmailToken
+const (
+	EmailTokenVerify        = "verify_email"
+	EmailTokenResetPassword = "reset_password"
+)
+
+// EmailToken is a single use token sent by email, only its hash is stored
+type EmailToken struct {
+	Id        int
+	UserId    int
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+}
+
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type EmailTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
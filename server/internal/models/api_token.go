@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ApiToken is a personal access token for scripts, only its hash is stored
+type ApiToken struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"userId"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Rooms      []int      `json:"rooms"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ApiTokenRequest creates a token, an empty Rooms list of room ids allows every room
+type ApiTokenRequest struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	Rooms     []int      `json:"rooms"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
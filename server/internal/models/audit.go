@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// AuditActor is who did something and where the request came from,
+// UserId is 0 for actions taken by the server itself
+type AuditActor struct {
+	UserId    int
+	Username  string
+	Ip        string
+	RequestId string
+}
+
+// AuditEvent is one row of the hash chained audit log.
+// Before and After are JSON snapshots of the target, empty when there is none.
+type AuditEvent struct {
+	Id         int64     `json:"id"`
+	ActorId    *int      `json:"actorId"`
+	ActorName  string    `json:"actorName"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType"`
+	TargetId   string    `json:"targetId"`
+	Before     *string   `json:"before"`
+	After      *string   `json:"after"`
+	Ip         string    `json:"ip"`
+	RequestId  string    `json:"requestId"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash"`
+}
+
+// AuditFilter selects audit events, pages go backwards from the Before id
+type AuditFilter struct {
+	ActorId    int
+	Action     string
+	TargetType string
+	TargetId   string
+	From       *time.Time
+	To         *time.Time
+	Before     int64
+	Limit      int
+}
+
+type AuditVerification struct {
+	Valid    bool  `json:"valid"`
+	Checked  int   `json:"checked"`
+	BrokenAt int64 `json:"brokenAt,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Block struct {
+	UserId      int       `json:"userId"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"displayName"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type BlockRequest struct {
+	UserId int `json:"userId" validate:"required"`
+}
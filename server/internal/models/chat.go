@@ -1,11 +1,46 @@
 package models
 
+import "time"
+
 type ChatRoom struct {
-	Id          int    `json:"id"`
-	Name        string `json:"name"`
-	Members     int    `json:"members"`
-	Private     bool   `json:"private"`
-	Code        string `json:"code"`
-	Description string `json:"description"`
-	UserId      int    `json:"userId"`
+	Id             int        `json:"id"`
+	Name           string     `json:"name"`
+	Slug           string     `json:"slug"`
+	Members        int        `json:"members"`
+	Messages       int        `json:"messages"`
+	Private        bool       `json:"private"`
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	Topic          string     `json:"topic"`
+	Tags           []string   `json:"tags"`
+	UserId         int        `json:"userId"`
+	RequestToJoin  bool       `json:"requestToJoin"`
+	RetentionDays  *int       `json:"retentionDays"`
+	UnfurlLinks    bool       `json:"unfurlLinks"`
+	LastActivityAt time.Time  `json:"lastActivityAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ArchivedAt     *time.Time `json:"archivedAt"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+	// Pins are only loaded for the room metadata of GetChatRoomBySlug
+	Pins []*PinnedMessage `json:"pins,omitempty"`
+}
+
+// RoomFilter selects rooms for discovery. Query searches name and description, pages
+// continue after the room with AfterId and the sort value AfterValue.
+type RoomFilter struct {
+	Query      string
+	Tag        string
+	Sort       string
+	AfterValue int64
+	AfterId    int
+	Limit      int
+}
+
+// RoomEvent is pushed over the websocket when a room is renamed or before the server
+// closes the connections of a room
+type RoomEvent struct {
+	Type   string `json:"type"`
+	RoomId int    `json:"roomId"`
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// RoomExport is a transcript of a room written in the background
+type RoomExport struct {
+	Id          int        `json:"id"`
+	RoomId      int        `json:"roomId"`
+	RequestedBy *int       `json:"requestedBy"`
+	Format      string     `json:"format"`
+	From        *time.Time `json:"from"`
+	To          *time.Time `json:"to"`
+	Status      string     `json:"status"`
+	Path        string     `json:"-"`
+	Size        int64      `json:"size"`
+	Error       string     `json:"error,omitempty"`
+	DownloadUrl string     `json:"downloadUrl,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt"`
+}
+
+// ExportRequest selects the format and the time range, From inclusive and To exclusive,
+// of an export. Without a range the whole history is exported.
+type ExportRequest struct {
+	Format string     `json:"format" validate:"required,oneof=jsonl csv zip"`
+	From   *time.Time `json:"from"`
+	To     *time.Time `json:"to"`
+}
@@ -14,4 +14,16 @@ type UploadedFile struct {
 	OriginalFilename string    `json:"originalFilename"`
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+	// Variants are the thumbnails of an image by name, only sizes smaller than the image are made
+	Variants map[string]*FileVariant `json:"variants,omitempty"`
+}
+
+// FileVariant is a smaller copy of an uploaded image
+type FileVariant struct {
+	PublicId  string  `json:"-"`
+	SecureUrl string  `json:"secureUrl"`
+	Format    string  `json:"format"`
+	Size      float64 `json:"bytes"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
 }
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type UserIdentity struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"userId"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState is kept in a signed cookie between the redirect to the provider and the callback
+type OIDCState struct {
+	Purpose    string `json:"purpose"`
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserId int    `json:"linkUserId"`
+	Exp        int64  `json:"exp"`
+}
+
+// OIDCClaims are the ID token claims used to find or provision a user
+type OIDCClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Nonce             string `json:"nonce"`
+}
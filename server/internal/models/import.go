@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ImportStats counts what an import created, Skipped are messages that were already imported
+// or could not be read
+type ImportStats struct {
+	Rooms    int `json:"rooms"`
+	Users    int `json:"users"`
+	Messages int `json:"messages"`
+	Files    int `json:"files"`
+	Skipped  int `json:"skipped"`
+}
+
+// Import is a Slack or Discord export uploaded by an admin and imported in the background
+type Import struct {
+	Id          int    `json:"id"`
+	Source      string `json:"source"`
+	Path        string `json:"-"`
+	RequestedBy *int   `json:"requestedBy"`
+	Status      string `json:"status"`
+	ImportStats
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+// ImportedMessage is a message of an export with its id there
+type ImportedMessage struct {
+	ExternalId string
+	RoomId     int
+	UserId     int
+	Content    string
+	CreatedAt  time.Time
+	File       *UploadedFile
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type RoomInvite struct {
+	Id        int             `json:"id"`
+	RoomId    int             `json:"roomId"`
+	Code      string          `json:"code"`
+	CreatedBy int             `json:"createdBy"`
+	Role      string          `json:"role"`
+	MaxUses   *int            `json:"maxUses"`
+	Uses      int             `json:"uses"`
+	ExpiresAt *time.Time      `json:"expiresAt"`
+	RevokedAt *time.Time      `json:"revokedAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Members   []*InviteMember `json:"members"`
+}
+
+// InviteMember is a user who joined a room with an invite
+type InviteMember struct {
+	UserId   int       `json:"userId"`
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+type InviteRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxUses   *int       `json:"maxUses" validate:"omitempty,min=1"`
+	Role      string     `json:"role" validate:"omitempty,oneof=MEMBER MODERATOR"`
+}
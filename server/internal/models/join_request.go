@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type JoinRequest struct {
+	Id        int        `json:"id"`
+	RoomId    int        `json:"roomId"`
+	RoomName  string     `json:"roomName"`
+	RoomSlug  string     `json:"roomSlug"`
+	UserId    int        `json:"userId"`
+	Username  string     `json:"username"`
+	Status    string     `json:"status"`
+	DecidedBy *int       `json:"decidedBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DecidedAt *time.Time `json:"decidedAt"`
+}
+
+// JoinRequestEvent is pushed over the websocket when a request is created or decided
+type JoinRequestEvent struct {
+	Type    string       `json:"type"`
+	Request *JoinRequest `json:"request"`
+}
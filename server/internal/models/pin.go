@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// PinnedMessage is a message a moderator pinned to the top of its room
+type PinnedMessage struct {
+	Message  *MessageResponse `json:"message"`
+	PinnedBy *int             `json:"pinnedBy"`
+	PinnedAt time.Time        `json:"pinnedAt"`
+}
+
+// PinEvent is pushed over the websocket when a message of the room is pinned or unpinned
+type PinEvent struct {
+	Type      string         `json:"type"`
+	RoomId    int            `json:"roomId"`
+	MessageId int            `json:"messageId"`
+	Pin       *PinnedMessage `json:"pin,omitempty"`
+}
+
+type TopicRequest struct {
+	Topic string `json:"topic" validate:"max=500"`
+}
+
+// TopicEvent is pushed over the websocket when the topic of the room changes,
+// Message is the system message that records the change in the history
+type TopicEvent struct {
+	Type    string           `json:"type"`
+	RoomId  int              `json:"roomId"`
+	Topic   string           `json:"topic"`
+	Message *MessageResponse `json:"message"`
+}
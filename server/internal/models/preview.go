@@ -0,0 +1,26 @@
+package models
+
+// LinkPreview is the card shown under a message for a link in it, read from the
+// OpenGraph and Twitter card tags of the page
+type LinkPreview struct {
+	Url         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	SiteName    string `json:"siteName"`
+	ImageUrl    string `json:"imageUrl"`
+	// Ok is false when the page could not be read or had nothing to show
+	Ok bool `json:"-"`
+}
+
+// PreviewEvent is pushed over the websocket once the links of a message are unfurled
+type PreviewEvent struct {
+	Type      string         `json:"type"`
+	RoomId    int            `json:"roomId"`
+	MessageId int            `json:"messageId"`
+	Previews  []*LinkPreview `json:"previews"`
+}
+
+// UnfurlRequest turns link previews of a room on or off
+type UnfurlRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
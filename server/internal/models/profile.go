@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Profile is the public part of a user. AvatarUrl falls back to a generated identicon,
+// the status is left out once it expired.
+type Profile struct {
+	UserId          int        `json:"userId"`
+	Username        string     `json:"username"`
+	DisplayName     string     `json:"displayName"`
+	Bio             string     `json:"bio"`
+	AvatarUrl       string     `json:"avatarUrl"`
+	StatusText      string     `json:"statusText"`
+	StatusExpiresAt *time.Time `json:"statusExpiresAt"`
+}
+
+// MessageAuthor is the profile sent along with a message
+type MessageAuthor struct {
+	Id          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	AvatarUrl   string `json:"avatarUrl"`
+	StatusText  string `json:"statusText"`
+}
+
+type ProfileRequest struct {
+	DisplayName     string     `json:"displayName" validate:"max=64"`
+	Bio             string     `json:"bio" validate:"max=500"`
+	StatusText      string     `json:"statusText" validate:"max=100"`
+	StatusExpiresAt *time.Time `json:"statusExpiresAt"`
+}
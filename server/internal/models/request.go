@@ -5,7 +5,7 @@ import "time"
 type UserRequest struct {
 	Id       int    `json:"id"`
 	Username string `json:"username" validate:"required"`
-	Password string `json:"password, omitempty" validate:"required"`
+	Password string `json:"password,omitempty" validate:"required"`
 	Role     string `json:"role"`
 }
 
@@ -13,15 +13,20 @@ type LoginRequest struct {
 	Username    string `json:"username" validate:"required"`
 	Password    string `json:"password,omitempty" validate:"required"`
 	AccessToken string `json:"accessToken"`
+	DeviceName  string `json:"deviceName"`
 }
 
+// ChatRoomRequest creates or updates a room, on update nil Tags keeps the tags of the room
 type ChatRoomRequest struct {
-	Id          int    `json:"id"`
-	Name        string `json:"name" validate:"required"`
-	Members     int    `json:"members"`
-	Code        string `json:"code"`
-	Description string `json:"description" validate:"required"`
-	UserId      int    `json:"userId"`
+	Id            int      `json:"id"`
+	Name          string   `json:"name" validate:"required"`
+	Slug          string   `json:"slug" validate:"omitempty,max=64"`
+	Members       int      `json:"members"`
+	Code          string   `json:"code"`
+	Description   string   `json:"description" validate:"required"`
+	Tags          []string `json:"tags"`
+	UserId        int      `json:"userId"`
+	RequestToJoin bool     `json:"requestToJoin"`
 }
 
 type MessageRequest struct {
@@ -37,9 +42,10 @@ type MessageRequest struct {
 }
 
 type JoinRoomRequest struct {
-	Id       int    `json:"id"`
-	UserId   int    `json:"userId" validate:"required"`
-	RoomName string `json:"roomName" validate:"required"`
+	Id     int    `json:"id"`
+	UserId int    `json:"userId" validate:"required"`
+	RoomId int    `json:"roomId" validate:"required"`
+	Role   string `json:"-"`
 }
 
 type OnlineUserCountRequest struct {
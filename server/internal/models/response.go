@@ -5,6 +5,7 @@ import "time"
 type PrivateRoomUsingCodeResponse struct {
 	Id          int    `json:"id"`
 	Name        string `json:"name" validate:"required"`
+	Slug        string `json:"slug"`
 	Members     int    `json:"members"`
 	Code        string `json:"code"`
 	Description string `json:"description" validate:"required"`
@@ -13,14 +14,22 @@ type PrivateRoomUsingCodeResponse struct {
 }
 
 type MessageResponse struct {
-	Id        int           `json:"id"`
-	Type      string        `json:"type"`
-	UserId    int           `json:"userId" validate:"required"`
-	Username  string        `json:"username"`
-	RoomName  string        `json:"roomName" validate:"required"`
-	Content   string        `json:"content" validate:"required"`
-	File      *UploadedFile `json:"file,omitempty"`
-	FileId    *int          `json:"fileId,omitempty"`
-	CreatedAt time.Time     `json:"created_at"`
-	UpdatedAt time.Time     `json:"updated_at"`
+	Id       int            `json:"id"`
+	Type     string         `json:"type"`
+	UserId   int            `json:"userId" validate:"required"`
+	Username string         `json:"username"`
+	Author   *MessageAuthor `json:"author,omitempty"`
+	RoomId   int            `json:"roomId"`
+	RoomName string         `json:"roomName" validate:"required"`
+	Content  string         `json:"content" validate:"required"`
+	// Html is Content rendered from Markdown, it is escaped and safe to insert into a page
+	Html   string        `json:"html"`
+	File   *UploadedFile `json:"file,omitempty"`
+	FileId *int          `json:"fileId,omitempty"`
+	// Previews of the links in Content, new messages get them later in a messagePreviews event
+	Previews  []*LinkPreview `json:"previews,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	// RedactedAt is set when the retention job removed the content and file
+	RedactedAt *time.Time `json:"redactedAt,omitempty"`
 }
@@ -0,0 +1,17 @@
+package models
+
+// RetentionRequest sets how long the messages of a room are kept, nil uses the server default
+// and 0 keeps them forever
+type RetentionRequest struct {
+	Days *int `json:"days" validate:"omitempty,min=0,max=36500"`
+}
+
+// RetentionResult is what the retention job removed
+type RetentionResult struct {
+	// Rooms is the number of expired messages per room
+	Rooms    map[int]int `json:"rooms"`
+	Messages int         `json:"messages"`
+	Files    int         `json:"files"`
+	// PublicIds are the stored objects of the deleted files
+	PublicIds []string `json:"-"`
+}
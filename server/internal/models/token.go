@@ -1,9 +1,39 @@
 package models
 
+import "time"
+
+// AccessToken is the authenticated caller. Requests made with a personal access
+// token have ApiTokenId set and are limited to Scopes and, if not empty, the room ids in Rooms.
 type AccessToken struct {
-	UserId     int    `json:"userId"`
-	Username   string `json:"username"`
-	Role       string `json:"role"`
-	ProfilePic string `json:"profilePic"`
-	Exp        int64  `json:"exp"`
+	UserId     int      `json:"userId"`
+	Username   string   `json:"username"`
+	Role       string   `json:"role"`
+	ProfilePic string   `json:"profilePic"`
+	SessionId  int      `json:"sessionId"`
+	Purpose    string   `json:"purpose"`
+	Mfa        bool     `json:"mfa"`
+	Exp        int64    `json:"exp"`
+	ApiTokenId int      `json:"-"`
+	Scopes     []string `json:"-"`
+	Rooms      []int    `json:"-"`
+}
+
+type RefreshToken struct {
+	Id        int
+	SessionId int
+	UserId    int
+	Username  string
+	Role      string
+	Mfa       bool
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+}
+
+// AuthTokens is the result of a login. When the user has two-factor authentication
+// enabled only Challenge is set until a code is submitted.
+type AuthTokens struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	Challenge        string
 }
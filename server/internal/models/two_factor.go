@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type UserTotp struct {
+	UserId       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	Challenge  string `json:"challenge" validate:"required"`
+	Code       string `json:"code" validate:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+// TwoFactorChallenge is the short lived token returned by a login that still needs a code
+type TwoFactorChallenge struct {
+	Purpose string `json:"purpose"`
+	UserId  int    `json:"userId"`
+	Exp     int64  `json:"exp"`
+}
@@ -3,17 +3,27 @@ package models
 import "time"
 
 type User struct {
-	Id         int       `json:"id"`
-	Username   string    `json:"username" validate:"required"`
-	Password   string    `json:"password"`
-	Role       string    `json:"role"`
-	ProfilePic string    `json:"profilePic"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	Id            int       `json:"id"`
+	Username      string    `json:"username" validate:"required"`
+	Password      string    `json:"password"`
+	Role          string    `json:"role"`
+	ProfilePic    string    `json:"profilePic"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"emailVerified"`
+	IsGuest       bool      `json:"isGuest"`
+	LastSeenAt    time.Time `json:"lastSeenAt"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type LoginSession struct {
-	Id     int    `json:"id"`
-	UserId int    `json:"userId"`
-	Token  string `json:"token"`
+	Id         int       `json:"id"`
+	UserId     int       `json:"userId"`
+	DeviceName string    `json:"deviceName"`
+	UserAgent  string    `json:"userAgent"`
+	Ip         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	Mfa        bool      `json:"mfa"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
 }
@@ -8,7 +8,10 @@ import (
 
 type WsServer struct {
 	RoomMutex  *sync.Mutex
-	Rooms      map[string][]*websocket.Conn
-	OnlineUser map[string]map[string]bool
+	Rooms      map[int][]*websocket.Conn
+	OnlineUser map[int]map[string]bool
+	Sessions   map[int][]*websocket.Conn
+	ApiTokens  map[int][]*websocket.Conn
+	ConnUsers  map[*websocket.Conn]int
 	Upgrader   websocket.Upgrader
 }
@@ -0,0 +1,232 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// AccountRepository stores email addresses and the tokens used to verify them and reset passwords
+type AccountRepository interface {
+	GetEmail(userId int) (*models.User, error)
+	SetEmail(userId int, email string) error
+	VerifyEmail(tokenHash string) error
+	GetUserByEmail(email string) (*models.User, error)
+	CreateEmailToken(data *models.EmailToken, tokenHash string) error
+	ResetPassword(tokenHash string, password string) ([]int, []int, error)
+}
+
+type accountRepository struct {
+	db *sql.DB
+}
+
+// NewAccountRepository creates a new instance of accountRepository
+func NewAccountRepository(db *sql.DB) AccountRepository {
+	return &accountRepository{
+		db: db,
+	}
+}
+
+func (r *accountRepository) GetEmail(userId int) (*models.User, error) {
+	user := &models.User{}
+	query := `SELECT id, username, COALESCE(email, ''), emailVerifiedAt IS NOT NULL FROM users WHERE id = $1`
+	err := r.db.QueryRow(query, userId).Scan(&user.Id, &user.Username, &user.Email, &user.EmailVerified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SetEmail stores a new unverified address, guests have to upgrade first. Links mailed to the
+// old address stop working.
+func (r *accountRepository) SetEmail(userId int, email string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET email = $2, emailVerifiedAt = NULL WHERE id = $1 AND isGuest = FALSE`
+	result, err := tx.Exec(query, userId, email)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	query = `UPDATE emailTokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND usedAt IS NULL`
+	_, err = tx.Exec(query, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifyEmail uses a verify token and marks its address verified if the user did not change
+// it in the meantime. The token stays unused when the address can't be verified.
+func (r *accountRepository) VerifyEmail(tokenHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	token, err := useEmailToken(tx, models.EmailTokenVerify, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET emailVerifiedAt = CURRENT_TIMESTAMP WHERE id = $1 AND email = $2`
+	result, err := tx.Exec(query, token.UserId, token.Email)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("email already in use")
+		}
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("email changed")
+	}
+	return tx.Commit()
+}
+
+// GetUserByEmail only finds verified addresses
+func (r *accountRepository) GetUserByEmail(email string) (*models.User, error) {
+	user := &models.User{}
+	query := `SELECT id, username, email FROM users WHERE LOWER(email) = LOWER($1) AND emailVerifiedAt IS NOT NULL`
+	err := r.db.QueryRow(query, email).Scan(&user.Id, &user.Username, &user.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+
+	user.EmailVerified = true
+	return user, nil
+}
+
+// CreateEmailToken stores a new token, older unused tokens of the same purpose stop working
+func (r *accountRepository) CreateEmailToken(data *models.EmailToken, tokenHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE emailTokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND purpose = $2 AND usedAt IS NULL`
+	_, err = tx.Exec(query, data.UserId, data.Purpose)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO emailTokens (userId, purpose, email, tokenHash, expiresAt) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	err = tx.QueryRow(query, data.UserId, data.Purpose, data.Email, tokenHash, data.ExpiresAt).Scan(&data.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// useEmailToken marks a token used and returns it, a token works only once and only before it
+// expires. It runs in the transaction of the change the token allows, so a failed change keeps it.
+func useEmailToken(tx *sql.Tx, purpose string, tokenHash string) (*models.EmailToken, error) {
+	data := &models.EmailToken{}
+	query := `UPDATE emailTokens SET usedAt = CURRENT_TIMESTAMP
+		WHERE tokenHash = $1 AND purpose = $2 AND usedAt IS NULL AND expiresAt > $3
+		RETURNING id, userId, purpose, email, expiresAt`
+	err := tx.QueryRow(query, tokenHash, purpose, time.Now()).Scan(&data.Id, &data.UserId, &data.Purpose, &data.Email, &data.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invalid token")
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// ResetPassword uses a reset token, sets a new password and deletes every login session and
+// personal access token of the user. The token only works while the user still has the address
+// it was sent to. It returns the removed session and api token ids so their websockets can be closed.
+func (r *accountRepository) ResetPassword(tokenHash string, password string) ([]int, []int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	token, err := useEmailToken(tx, models.EmailTokenResetPassword, tokenHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	userId := token.UserId
+
+	result, err := tx.Exec(`UPDATE users SET password = $2 WHERE id = $1 AND email = $3`, userId, password, token.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if count == 0 {
+		return nil, nil, fmt.Errorf("email changed")
+	}
+
+	sessionIds, err := deleteReturningIds(tx, `DELETE FROM loginSession WHERE userId = $1 RETURNING id`, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	apiTokenIds, err := deleteReturningIds(tx, `DELETE FROM apiTokens WHERE userId = $1 RETURNING id`, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sessionIds, apiTokenIds, tx.Commit()
+}
+
+// deleteReturningIds runs a DELETE ... RETURNING id and collects the ids
+func deleteReturningIds(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
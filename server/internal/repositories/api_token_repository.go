@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
+)
+
+// ApiTokenRepository stores personal access tokens
+type ApiTokenRepository interface {
+	CreateApiToken(data *models.ApiToken, tokenHash string) error
+	GetAllApiTokens(userId int) ([]*models.ApiToken, error)
+	DeleteApiToken(userId int, id int) error
+	UseApiToken(tokenHash string) (*models.ApiToken, *models.User, error)
+}
+
+type apiTokenRepository struct {
+	db *sql.DB
+}
+
+// NewApiTokenRepository creates a new instance of apiTokenRepository
+func NewApiTokenRepository(db *sql.DB) ApiTokenRepository {
+	return &apiTokenRepository{
+		db: db,
+	}
+}
+
+func (r *apiTokenRepository) CreateApiToken(data *models.ApiToken, tokenHash string) error {
+	query := `INSERT INTO apiTokens (userId, name, tokenHash, scopes, roomIds, expiresAt) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, createdAt`
+	err := r.db.QueryRow(query, data.UserId, data.Name, tokenHash, pq.Array(data.Scopes), pq.Array(data.Rooms), data.ExpiresAt).Scan(&data.Id, &data.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *apiTokenRepository) GetAllApiTokens(userId int) ([]*models.ApiToken, error) {
+	query := `SELECT id, userId, name, scopes, roomIds, expiresAt, lastUsedAt, createdAt FROM apiTokens WHERE userId = $1 ORDER BY createdAt DESC`
+	rows, err := r.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []*models.ApiToken
+	for rows.Next() {
+		token := &models.ApiToken{}
+		var roomIds pq.Int64Array
+		err := rows.Scan(&token.Id, &token.UserId, &token.Name, pq.Array(&token.Scopes), &roomIds, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		token.Rooms = toInts(roomIds)
+		data = append(data, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *apiTokenRepository) DeleteApiToken(userId int, id int) error {
+	query := `DELETE FROM apiTokens WHERE id = $1 AND userId = $2`
+	result, err := r.db.Exec(query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// UseApiToken returns an unexpired token with its owner and records that it was used
+func (r *apiTokenRepository) UseApiToken(tokenHash string) (*models.ApiToken, *models.User, error) {
+	token := &models.ApiToken{}
+	user := &models.User{}
+	query := `WITH token AS (
+			UPDATE apiTokens SET lastUsedAt = CURRENT_TIMESTAMP
+			WHERE tokenHash = $1 AND (expiresAt IS NULL OR expiresAt > $2)
+			RETURNING id, userId, name, scopes, roomIds, expiresAt
+		)
+		SELECT t.id, t.userId, t.name, t.scopes, t.roomIds, t.expiresAt, u.username, COALESCE(u.role, 'USER'), COALESCE(u.profilePic, '')
+		FROM token t
+		JOIN users u ON t.userId = u.id`
+	var roomIds pq.Int64Array
+	err := r.db.QueryRow(query, tokenHash, time.Now()).Scan(&token.Id, &token.UserId, &token.Name, pq.Array(&token.Scopes), &roomIds, &token.ExpiresAt, &user.Username, &user.Role, &user.ProfilePic)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("token not found")
+		}
+		return nil, nil, err
+	}
+
+	token.Rooms = toInts(roomIds)
+	user.Id = token.UserId
+	return token, user, nil
+}
+
+// toInts converts a scanned INTEGER[], pq can only scan it into int64 values
+func toInts(values pq.Int64Array) []int {
+	data := make([]int, len(values))
+	for i, value := range values {
+		data[i] = int(value)
+	}
+	return data
+}
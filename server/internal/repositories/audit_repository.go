@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	auditchain "github.com/gauravst/real-time-chat/internal/utils/auditChain"
+)
+
+// auditLockKey serializes writers so every event chains to the one before it
+const auditLockKey = 7301
+
+// AuditRepository appends to and reads the audit log
+type AuditRepository interface {
+	CreateAuditEvent(data *models.AuditEvent) error
+	GetAuditEvents(filter *models.AuditFilter) ([]*models.AuditEvent, error)
+	GetAuditEventsAfter(afterId int64, limit int) ([]*models.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+// NewAuditRepository creates a new instance of auditRepository
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{
+		db: db,
+	}
+}
+
+// CreateAuditEvent links the event to the last one and stores it
+func (r *auditRepository) CreateAuditEvent(data *models.AuditEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, auditLockKey)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&data.PrevHash)
+	if err == sql.ErrNoRows {
+		data.PrevHash = auditchain.Genesis
+	} else if err != nil {
+		return err
+	}
+
+	data.Hash = auditchain.Hash(data)
+	query := `INSERT INTO audit_events (actorId, actorName, action, targetType, targetId, beforeData, afterData, ip, requestId, createdAt, prevHash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+	err = tx.QueryRow(query, data.ActorId, data.ActorName, data.Action, data.TargetType, data.TargetId, data.Before, data.After,
+		data.Ip, data.RequestId, data.CreatedAt, data.PrevHash, data.Hash).Scan(&data.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAuditEvents returns the newest events matching filter
+func (r *auditRepository) GetAuditEvents(filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorId != 0 {
+		add("actorId = $%d", filter.ActorId)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add("targetType = $%d", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		add("targetId = $%d", filter.TargetId)
+	}
+	if filter.From != nil {
+		add("createdAt >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("createdAt < $%d", *filter.To)
+	}
+	if filter.Before != 0 {
+		add("id < $%d", filter.Before)
+	}
+
+	query := `SELECT id, actorId, actorName, action, targetType, targetId, beforeData, afterData, ip, requestId, createdAt, prevHash, hash FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	return r.queryAuditEvents(query, args...)
+}
+
+// GetAuditEventsAfter returns events in chain order, used to verify the log
+func (r *auditRepository) GetAuditEventsAfter(afterId int64, limit int) ([]*models.AuditEvent, error) {
+	query := `SELECT id, actorId, actorName, action, targetType, targetId, beforeData, afterData, ip, requestId, createdAt, prevHash, hash
+		FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2`
+	return r.queryAuditEvents(query, afterId, limit)
+}
+
+func (r *auditRepository) queryAuditEvents(query string, args ...interface{}) ([]*models.AuditEvent, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []*models.AuditEvent{}
+	for rows.Next() {
+		event := &models.AuditEvent{}
+		err := rows.Scan(&event.Id, &event.ActorId, &event.ActorName, &event.Action, &event.TargetType, &event.TargetId, &event.Before, &event.After,
+			&event.Ip, &event.RequestId, &event.CreatedAt, &event.PrevHash, &event.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -2,20 +2,28 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
 )
 
 // AuthRepository defines the interface for user-related database operations
 type AuthRepository interface {
-	RemoveOtherLogin(userId int) error
+	RemoveOtherLogin(userId int, keepSessionId int) ([]int, error)
 	LoginUser(data *models.LoginSession) error
-	CreateNewUser(data *models.LoginRequest) (*models.User, error)
+	TouchSession(userId int, sessionId int) error
+	GetAllSessions(userId int) ([]*models.LoginSession, error)
+	RemoveSession(userId int, sessionId int) error
+	CreateNewUser(data *models.LoginRequest, isGuest bool) (*models.User, error)
+	UpgradeGuest(userId int, username string, password string) (*models.User, error)
 	CheckUserByUsername(username string) (models.User, error)
-	// RefreshToken(userId int, token string) error
-	GetRefreshToken(userId int) (string, error)
-	LogoutUser(userId int) error
+	GetUserById(userId int) (*models.User, error)
+	CreateRefreshToken(sessionId int, tokenHash string, expiresAt time.Time) error
+	GetRefreshToken(tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(id int, sessionId int, tokenHash string, expiresAt time.Time) error
 }
 
 // userRepository implements the AuthRepository interface
@@ -30,30 +38,134 @@ func NewAuthRepository(db *sql.DB) AuthRepository {
 	}
 }
 
-func (r *authRepository) RemoveOtherLogin(userId int) error {
-	query := `DELETE FROM loginSession WHERE userId = $1`
-	_, err := r.db.Exec(query, userId)
+func (r *authRepository) RemoveOtherLogin(userId int, keepSessionId int) ([]int, error) {
+	query := `DELETE FROM loginSession WHERE userId = $1 AND id <> $2 RETURNING id`
+	rows, err := r.db.Query(query, userId, keepSessionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (r *authRepository) LoginUser(data *models.LoginSession) error {
+	query := `INSERT INTO loginSession (userId, deviceName, userAgent, ip, mfa) VALUES ($1, $2, $3, $4, $5) RETURNING id, createdAt, lastUsedAt`
+	err := r.db.QueryRow(query, data.UserId, data.DeviceName, data.UserAgent, data.Ip, data.Mfa).Scan(&data.Id, &data.CreatedAt, &data.LastUsedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *authRepository) TouchSession(userId int, sessionId int) error {
+	query := `WITH session AS (
+			UPDATE loginSession SET lastUsedAt = CURRENT_TIMESTAMP WHERE id = $1 AND userId = $2 RETURNING userId
+		)
+		UPDATE users SET lastSeenAt = CURRENT_TIMESTAMP WHERE id IN (SELECT userId FROM session)`
+	result, err := r.db.Exec(query, sessionId, userId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if count == 0 {
+		return fmt.Errorf("session not found")
+	}
 	return nil
 }
 
-func (r *authRepository) LoginUser(data *models.LoginSession) error {
-	query := `INSERT INTO loginSession (userId, token) VALUES ($1, $2)`
-	_, err := r.db.Exec(query, data.UserId, data.Token)
+func (r *authRepository) GetAllSessions(userId int) ([]*models.LoginSession, error) {
+	query := `SELECT id, userId, deviceName, userAgent, ip, mfa, createdAt, lastUsedAt FROM loginSession WHERE userId = $1 ORDER BY lastUsedAt DESC`
+	rows, err := r.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []*models.LoginSession
+	for rows.Next() {
+		session := &models.LoginSession{}
+		err := rows.Scan(&session.Id, &session.UserId, &session.DeviceName, &session.UserAgent, &session.Ip, &session.Mfa, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *authRepository) RemoveSession(userId int, sessionId int) error {
+	query := `DELETE FROM loginSession WHERE id = $1 AND userId = $2`
+	result, err := r.db.Exec(query, sessionId, userId)
 	if err != nil {
 		return err
 	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("session not found")
+	}
 	return nil
 }
 
-func (r *authRepository) CreateNewUser(data *models.LoginRequest) (*models.User, error) {
+func (r *authRepository) CreateNewUser(data *models.LoginRequest, isGuest bool) (*models.User, error) {
 	user := &models.User{}
-	query := `INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id, username, role, createdAt`
-	err := r.db.QueryRow(query, data.Username, data.Password).Scan(&user.Id, &user.Username, &user.Role, &user.CreatedAt)
+	query := `INSERT INTO users (username, password, isGuest) VALUES ($1, $2, $3) RETURNING id, username, role, isGuest, createdAt`
+	err := r.db.QueryRow(query, data.Username, data.Password, isGuest).Scan(&user.Id, &user.Username, &user.Role, &user.IsGuest, &user.CreatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("username already taken")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpgradeGuest turns a guest into a regular account, keeping its id and everything linked to it
+func (r *authRepository) UpgradeGuest(userId int, username string, password string) (*models.User, error) {
+	user := &models.User{}
+	query := `UPDATE users SET username = $1, password = $2, isGuest = FALSE, updatedAt = CURRENT_TIMESTAMP
+		WHERE id = $3 AND isGuest
+		RETURNING id, username, role, isGuest, createdAt`
+	err := r.db.QueryRow(query, username, password, userId).Scan(&user.Id, &user.Username, &user.Role, &user.IsGuest, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user is not a guest")
+		}
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("username already taken")
+		}
 		return nil, err
 	}
 
@@ -62,8 +174,8 @@ func (r *authRepository) CreateNewUser(data *models.LoginRequest) (*models.User,
 
 func (r *authRepository) CheckUserByUsername(username string) (models.User, error) {
 	var user models.User
-	query := `SELECT id, username, password FROM users WHERE username = $1`
-	err := r.db.QueryRow(query, username).Scan(&user.Id, &user.Username, &user.Password)
+	query := `SELECT id, username, password, COALESCE(role, 'USER') FROM users WHERE LOWER(username) = LOWER($1)`
+	err := r.db.QueryRow(query, username).Scan(&user.Id, &user.Username, &user.Password, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return user, fmt.Errorf("user not found")
@@ -73,30 +185,81 @@ func (r *authRepository) CheckUserByUsername(username string) (models.User, erro
 	return user, nil
 }
 
-// func (r *authRepository) RefreshToken(userId int, token string) error {
-// 	query := `UPDATE`
-// 	_, err := r.db.Exec(query, token, userId)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return nil
-// }
-
-func (r *authRepository) GetRefreshToken(userId int) (string, error) {
-	var token string
-	query := `SELECT token FROM loginSession WHERE userId = $1`
-	err := r.db.QueryRow(query, userId).Scan(&token)
+func (r *authRepository) GetUserById(userId int) (*models.User, error) {
+	user := &models.User{}
+	query := `SELECT id, username, COALESCE(role, 'USER'), isGuest, createdAt FROM users WHERE id = $1`
+	err := r.db.QueryRow(query, userId).Scan(&user.Id, &user.Username, &user.Role, &user.IsGuest, &user.CreatedAt)
 	if err != nil {
-		return token, err
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
 	}
-	return token, nil
+
+	return user, nil
 }
 
-func (r *authRepository) LogoutUser(userId int) error {
-	query := `DELETE FROM loginSession WHERE userId = $1`
-	_, err := r.db.Exec(query, userId)
+func (r *authRepository) CreateRefreshToken(sessionId int, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO refreshTokens (sessionId, tokenHash, expiresAt) VALUES ($1, $2, $3)`
+	_, err := r.db.Exec(query, sessionId, tokenHash, expiresAt)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func (r *authRepository) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	data := &models.RefreshToken{}
+	query := `SELECT rt.id, rt.sessionId, ls.userId, u.username, COALESCE(u.role, 'USER'), ls.mfa, rt.expiresAt, rt.rotatedAt
+		FROM refreshTokens rt
+		JOIN loginSession ls ON rt.sessionId = ls.id
+		JOIN users u ON ls.userId = u.id
+		WHERE rt.tokenHash = $1`
+	err := r.db.QueryRow(query, tokenHash).Scan(&data.Id, &data.SessionId, &data.UserId, &data.Username, &data.Role, &data.Mfa, &data.ExpiresAt, &data.RotatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("refresh token not found")
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// RotateRefreshToken marks a token as used and stores the token that replaces it in one
+// transaction, it fails if the token was already rotated
+func (r *authRepository) RotateRefreshToken(id int, sessionId int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE refreshTokens SET rotatedAt = CURRENT_TIMESTAMP WHERE id = $1 AND rotatedAt IS NULL`
+	result, err := tx.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("refresh token already used")
+	}
+
+	query = `INSERT INTO refreshTokens (sessionId, tokenHash, expiresAt) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(query, sessionId, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err is a postgres unique constraint error
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
+)
+
+// BlockRepository stores which users blocked each other
+type BlockRepository interface {
+	CreateBlock(blockerId int, blockedId int) error
+	DeleteBlock(blockerId int, blockedId int) error
+	GetAllBlocks(blockerId int) ([]*models.Block, error)
+	GetBlockerIds(blockedId int) ([]int, error)
+	IsBlocked(userId int, otherId int) (bool, error)
+}
+
+type blockRepository struct {
+	db *sql.DB
+}
+
+// NewBlockRepository creates a new instance of blockRepository
+func NewBlockRepository(db *sql.DB) BlockRepository {
+	return &blockRepository{
+		db: db,
+	}
+}
+
+// CreateBlock blocks a user, blocking twice is not an error
+func (r *blockRepository) CreateBlock(blockerId int, blockedId int) error {
+	query := `INSERT INTO userBlocks (blockerId, blockedId) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := r.db.Exec(query, blockerId, blockedId)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return fmt.Errorf("user not found")
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *blockRepository) DeleteBlock(blockerId int, blockedId int) error {
+	query := `DELETE FROM userBlocks WHERE blockerId = $1 AND blockedId = $2`
+	result, err := r.db.Exec(query, blockerId, blockedId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("block not found")
+	}
+	return nil
+}
+
+func (r *blockRepository) GetAllBlocks(blockerId int) ([]*models.Block, error) {
+	query := `SELECT u.id, u.username, COALESCE(u.displayName, ''), b.createdAt
+		FROM userBlocks b JOIN users u ON u.id = b.blockedId
+		WHERE b.blockerId = $1 ORDER BY b.createdAt DESC`
+	rows, err := r.db.Query(query, blockerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []*models.Block{}
+	for rows.Next() {
+		block := &models.Block{}
+		err := rows.Scan(&block.UserId, &block.Username, &block.DisplayName, &block.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, block)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetBlockerIds returns the users who blocked blockedId
+func (r *blockRepository) GetBlockerIds(blockedId int) ([]int, error) {
+	query := `SELECT blockerId FROM userBlocks WHERE blockedId = $1`
+	rows, err := r.db.Query(query, blockedId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// IsBlocked reports whether either of the two users blocked the other
+func (r *blockRepository) IsBlocked(userId int, otherId int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (
+			SELECT 1 FROM userBlocks
+			WHERE (blockerId = $1 AND blockedId = $2) OR (blockerId = $2 AND blockedId = $1)
+		)`
+	err := r.db.QueryRow(query, userId, otherId).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
@@ -3,29 +3,42 @@ package repositories
 import (
 	"database/sql"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/gauravst/real-time-chat/internal/database"
 	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/utils/markdown"
+	"github.com/lib/pq"
 )
 
 type ChatRepository interface {
-	GetAllChatRoom(userData *models.AccessToken) ([]*models.ChatRoom, error)
+	GetAllChatRoom(userData *models.AccessToken, filter *models.RoomFilter) ([]*models.ChatRoom, error)
+	SetRoomTags(roomId int, tags []string) error
 	GetPrivateChatRoom(code string) (*models.ChatRoom, error)
-	GetChatRoomByName(name string) (*models.ChatRoom, error)
-	UpdateChatRoom(data *models.ChatRoomRequest) error
-	DeleteChatRoom(name string) error
+	GetChatRoomBySlug(slug string) (*models.ChatRoom, error)
+	GetChatRoomById(id int) (*models.ChatRoom, error)
+	SlugTaken(slug string, roomId int) (bool, error)
+	UpdateChatRoom(data *models.ChatRoomRequest, oldSlug string) error
+	DeleteChatRoom(id int) error
 	CreateNewChatRoom(data *models.ChatRoomRequest) error
-	CheckChatRoomMember(userId int, roomName string) (bool, error)
-	GetOldMessages(roomName string, limit int) ([]*models.MessageResponse, error)
-	CreateNewMessage(data *models.MessageResponse, roomName string) (*models.MessageResponse, error)
+	CheckChatRoomMember(userId int, roomId int) (bool, error)
+	GetOldMessages(roomId int, limit int, viewerId int) ([]*models.MessageResponse, error)
+	CreateNewMessage(data *models.MessageResponse, roomId int) (*models.MessageResponse, error)
+	SetRoomTopic(roomId int, topic string, content string, userId int) (*models.MessageResponse, error)
 	JoinRoom(data *models.JoinRoomRequest) error
-	JoinPrivateRoom(data *models.JoinRoomRequest) error
 	GetAllJoinRoom(userId int) ([]*models.ChatRoom, error)
-	LeaveRoom(userId int, roomName string) error
+	LeaveRoom(userId int, roomId int) error
 	GetFile(fileId *int) (*models.UploadedFile, error)
+	ArchiveChatRoom(id int, archived bool) error
+	GetDeletedChatRoom(slug string) (*models.ChatRoom, error)
+	RestoreChatRoom(id int, deletedAfter time.Time) error
+	GetPurgeableChatRooms(deletedBefore time.Time) ([]int, error)
+	PurgeChatRoom(id int) ([]string, error)
 }
 
 // userRepository implements the AuthRepository interface
@@ -41,22 +54,49 @@ func NewChatRepository(db *sql.DB, qm *database.QueryManager) ChatRepository {
 	}
 }
 
-func (r *chatRepository) GetAllChatRoom(userData *models.AccessToken) ([]*models.ChatRoom, error) {
-	query, err := r.queries.Get("chat", "GetAllChatRoom")
-	if err != nil {
-		return nil, err
+// GetAllChatRoom lists the rooms userData may discover, sorted and paged by filter
+func (r *chatRepository) GetAllChatRoom(userData *models.AccessToken, filter *models.RoomFilter) ([]*models.ChatRoom, error) {
+	conditions := []string{"archivedAt IS NULL", "deletedAt IS NULL", "(private = false OR requestToJoin = true OR userId = $1)"}
+	args := []interface{}{userData.UserId}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Query != "" {
+		add("(name ILIKE $%[1]d OR description ILIKE $%[1]d)", "%"+likeEscaper.Replace(filter.Query)+"%")
+	}
+	if filter.Tag != "" {
+		add("EXISTS (SELECT 1 FROM roomTags t WHERE t.roomId = chatRoom.id AND t.tag = $%d)", filter.Tag)
+	}
+
+	column, ok := roomSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %s", filter.Sort)
+	}
+
+	if filter.AfterId != 0 {
+		var after interface{} = filter.AfterValue
+		if column != "memberCount" {
+			after = time.UnixMicro(filter.AfterValue).UTC()
+		}
+		args = append(args, after, filter.AfterId)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) < ($%d, $%d)", column, len(args)-1, len(args)))
 	}
 
-	rows, err := r.db.Query(query, userData.UserId)
+	args = append(args, filter.Limit)
+	query := `SELECT ` + roomColumns + ` FROM chatRoom WHERE ` + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(" ORDER BY %s DESC, id DESC LIMIT $%d", column, len(args))
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var data []*models.ChatRoom
+	data := []*models.ChatRoom{}
 	for rows.Next() {
-		room := &models.ChatRoom{}
-		err := rows.Scan(&room.Id, &room.Name, &room.Private, &room.Description, &room.UserId, &room.Members)
+		room, err := scanRoom(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -71,91 +111,267 @@ func (r *chatRepository) GetAllChatRoom(userData *models.AccessToken) ([]*models
 	return data, nil
 }
 
+// roomSortColumns maps the sort orders of the room listing to their indexed column
+var roomSortColumns = map[string]string{
+	"members":  "memberCount",
+	"activity": "lastActivityAt",
+	"created":  "createdAt",
+}
+
+// likeEscaper keeps user input from adding wildcards to an ILIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func (r *chatRepository) GetPrivateChatRoom(code string) (*models.ChatRoom, error) {
-	data := &models.ChatRoom{}
+	query := `SELECT ` + roomColumns + ` FROM chatRoom
+		WHERE private = true AND code = $1 AND archivedAt IS NULL AND deletedAt IS NULL`
+	return scanRoom(r.db.QueryRow(query, code))
+}
 
-	// Load SQL query string
-	// query, err := r.queries.Get("chat", "GetPrivateRoomUsingCode")
-	query := `SELECT
-  cr.id,
-  cr.name,
-  cr.private,
-  cr.description,
-  cr.userid,
-  COUNT(gm.id) AS members
-FROM
-  chatroom cr
-  LEFT JOIN groupMembers gm ON cr.name = gm.roomName
-WHERE
-  cr.private = true
-  AND cr.code = $1
-GROUP BY
-  cr.id;
-`
-	// if err != nil {
-	// 	fmt.Println("Error loading query:", err)
-	// 	return nil, err
-	// }
-	//
-	// Execute the query
-	err := r.db.QueryRow(query, code).Scan(
-		&data.Id,
-		&data.Name,
-		&data.Private,
-		&data.Description,
-		&data.UserId,
-		&data.Members,
-	)
+// SetRoomTags replaces the tags of a room
+func (r *chatRepository) SetRoomTags(roomId int, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM roomTags WHERE roomId = $1`, roomId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO roomTags (roomId, tag) SELECT $1, unnest($2::text[])`, roomId, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// roomColumns are read by scanRoom
+const roomColumns = `id, name, slug, private, description, topic, userId, requestToJoin, retentionDays, unfurlLinks, archivedAt, deletedAt,
+	memberCount, messageCount, lastActivityAt, createdAt, ARRAY(SELECT tag FROM roomTags WHERE roomId = chatRoom.id ORDER BY tag)`
+
+// GetChatRoomBySlug finds a room by its current slug or by one it had before a rename
+func (r *chatRepository) GetChatRoomBySlug(slug string) (*models.ChatRoom, error) {
+	query := `SELECT ` + roomColumns + ` FROM chatRoom
+		WHERE deletedAt IS NULL AND (slug = $1 OR id = (SELECT roomId FROM roomSlugRedirects WHERE slug = $1))
+		ORDER BY slug = $1 DESC LIMIT 1`
+	return scanRoom(r.db.QueryRow(query, slug))
+}
+
+func (r *chatRepository) GetChatRoomById(id int) (*models.ChatRoom, error) {
+	query := `SELECT ` + roomColumns + ` FROM chatRoom WHERE id = $1 AND deletedAt IS NULL`
+	return scanRoom(r.db.QueryRow(query, id))
+}
+
+// SlugTaken reports whether another room than roomId uses the slug now or used it before
+func (r *chatRepository) SlugTaken(slug string, roomId int) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM chatRoom WHERE slug = $1 AND id <> $2)
+		OR EXISTS(SELECT 1 FROM roomSlugRedirects WHERE slug = $1 AND roomId <> $2)`
+	var taken bool
+	err := r.db.QueryRow(query, slug, roomId).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+	return taken, nil
+}
+
+// UpdateChatRoom saves the name, slug and settings of a room. A changed slug leaves a
+// redirect from oldSlug behind, a slug the room had before is taken back from its redirects.
+func (r *chatRepository) UpdateChatRoom(data *models.ChatRoomRequest, oldSlug string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE chatRoom SET name = $1, slug = $2, description = $3, requestToJoin = $4, updatedAt = CURRENT_TIMESTAMP
+		WHERE id = $5 AND deletedAt IS NULL
+		RETURNING id, name, slug, description, userId, requestToJoin`
+	row := tx.QueryRow(query, data.Name, data.Slug, data.Description, data.RequestToJoin, data.Id)
+	err = row.Scan(&data.Id, &data.Name, &data.Slug, &data.Description, &data.UserId, &data.RequestToJoin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("room not found")
+		}
+		return err
+	}
+
+	if data.Slug != oldSlug {
+		_, err = tx.Exec(`DELETE FROM roomSlugRedirects WHERE slug = $1 AND roomId = $2`, data.Slug, data.Id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO roomSlugRedirects (slug, roomId) VALUES ($1, $2)`, oldSlug, data.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteChatRoom marks the room as deleted, it is removed for good by PurgeChatRoom
+func (r *chatRepository) DeleteChatRoom(id int) error {
+	query := `UPDATE chatRoom SET deletedAt = CURRENT_TIMESTAMP WHERE id = $1 AND deletedAt IS NULL`
+	return updateOneRoom(r.db, query, id)
+}
+
+func (r *chatRepository) ArchiveChatRoom(id int, archived bool) error {
+	query := `UPDATE chatRoom SET archivedAt = CASE WHEN $2 THEN COALESCE(archivedAt, CURRENT_TIMESTAMP) ELSE NULL END, updatedAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deletedAt IS NULL`
+	return updateOneRoom(r.db, query, id, archived)
+}
+
+// GetDeletedChatRoom finds a deleted room by its slug or one of its old slugs
+func (r *chatRepository) GetDeletedChatRoom(slug string) (*models.ChatRoom, error) {
+	query := `SELECT ` + roomColumns + ` FROM chatRoom
+		WHERE deletedAt IS NOT NULL AND (slug = $1 OR id = (SELECT roomId FROM roomSlugRedirects WHERE slug = $1))
+		ORDER BY slug = $1 DESC LIMIT 1`
+	return scanRoom(r.db.QueryRow(query, slug))
+}
+
+// RestoreChatRoom undoes a deletion that happened after deletedAfter
+func (r *chatRepository) RestoreChatRoom(id int, deletedAfter time.Time) error {
+	query := `UPDATE chatRoom SET deletedAt = NULL, updatedAt = CURRENT_TIMESTAMP WHERE id = $1 AND deletedAt > $2`
+	return updateOneRoom(r.db, query, id, deletedAfter)
+}
+
+func (r *chatRepository) GetPurgeableChatRooms(deletedBefore time.Time) ([]int, error) {
+	query := `SELECT id FROM chatRoom WHERE deletedAt <= $1`
+	rows, err := r.db.Query(query, deletedBefore)
 	if err != nil {
-		fmt.Println("Query execution error:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, id)
+	}
+
+	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
 
-func (r *chatRepository) GetChatRoomByName(name string) (*models.ChatRoom, error) {
-	data := &models.ChatRoom{}
-	query := `SELECT id, name, private, description, userId FROM chatRoom WHERE name = $1`
-	err := r.db.QueryRow(query, name).Scan(&data.Id, &data.Name, &data.Private, &data.Description, &data.UserId)
+// PurgeChatRoom removes a deleted room with its messages and their files, memberships,
+// invites and join requests go with the room. It returns the storage ids of the removed files
+// and their variants.
+func (r *chatRepository) PurgeChatRoom(id int) ([]string, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return data, err
+		return nil, err
 	}
-	return data, nil
+	defer tx.Rollback()
+
+	query := `WITH deleted AS (
+			DELETE FROM messages WHERE roomId = $1 RETURNING fileId
+		)
+		DELETE FROM files WHERE id IN (SELECT fileId FROM deleted WHERE fileId IS NOT NULL)
+		RETURNING COALESCE(publicId, ''), ARRAY(SELECT publicId FROM fileVariants WHERE fileId = files.id)`
+	rows, err := tx.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var publicIds []string
+	for rows.Next() {
+		var publicId string
+		var variants pq.StringArray
+		err := rows.Scan(&publicId, &variants)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if publicId != "" {
+			publicIds = append(publicIds, publicId)
+		}
+		publicIds = append(publicIds, variants...)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM chatRoom WHERE id = $1 AND deletedAt IS NOT NULL`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicIds, tx.Commit()
 }
 
-func (r *chatRepository) UpdateChatRoom(data *models.ChatRoomRequest) error {
-	query := `UPDATE chatRoom SET name = $1, userId = $2, members = $3, description = $4 WHERE name = $5 RETURNING id, name, members, description, userId`
-	row := r.db.QueryRow(query, data.Name, data.UserId, data.Members, data.Description, data.Name)
-	err := row.Scan(&data.Id, &data.Name, &data.Members, &data.Description, &data.UserId)
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// updateOneRoom runs an update on a single room and reports a missing room
+func updateOneRoom(db execer, query string, args ...interface{}) error {
+	result, err := db.Exec(query, args...)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-func (r *chatRepository) DeleteChatRoom(name string) error {
-	query := `DELETE chatRoom WHERE id = $1`
-	_, err := r.db.Exec(query)
+	count, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+
+	if count == 0 {
+		return fmt.Errorf("room not found")
+	}
 	return nil
 }
 
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRoom reads a row of roomColumns
+func scanRoom(row rowScanner) (*models.ChatRoom, error) {
+	data := &models.ChatRoom{}
+	err := row.Scan(&data.Id, &data.Name, &data.Slug, &data.Private, &data.Description, &data.Topic, &data.UserId,
+		&data.RequestToJoin, &data.RetentionDays, &data.UnfurlLinks, &data.ArchivedAt, &data.DeletedAt, &data.Members, &data.Messages, &data.LastActivityAt, &data.CreatedAt, pq.Array(&data.Tags))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("room not found")
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
 func (r *chatRepository) CreateNewChatRoom(data *models.ChatRoomRequest) error {
-	query := `INSERT INTO chatRoom (name, code, userId, description) VALUES ($1, $2, $3, $4)`
-	_, err := r.db.Exec(query, data.Name, data.Code, data.UserId, data.Description)
+	query := `INSERT INTO chatRoom (name, slug, code, userId, description, requestToJoin) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err := r.db.QueryRow(query, data.Name, data.Slug, data.Code, data.UserId, data.Description, data.RequestToJoin).Scan(&data.Id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *chatRepository) CheckChatRoomMember(userId int, roomName string) (bool, error) {
-	query := `SELECT EXISTS(SELECT 1 FROM groupMembers WHERE userId = $1 AND roomname = $2)`
+func (r *chatRepository) CheckChatRoomMember(userId int, roomId int) (bool, error) {
+	query := `SELECT EXISTS(
+			SELECT 1 FROM groupMembers gm JOIN chatRoom cr ON cr.id = gm.roomId
+			WHERE gm.userId = $1 AND gm.roomId = $2 AND cr.deletedAt IS NULL
+		)`
 	var exists bool
-	err := r.db.QueryRow(query, userId, roomName).Scan(&exists)
+	err := r.db.QueryRow(query, userId, roomId).Scan(&exists)
 	if err != nil {
 		log.Printf("Error checking chat room member: %v", err)
 		return false, err
@@ -163,9 +379,9 @@ func (r *chatRepository) CheckChatRoomMember(userId int, roomName string) (bool,
 	return exists, nil
 }
 
-func (r *chatRepository) GetOldMessages(roomName string, limit int) ([]*models.MessageResponse, error) {
-	if roomName == "" || limit <= 0 {
-		return nil, errors.New("invalid room name or limit")
+func (r *chatRepository) GetOldMessages(roomId int, limit int, viewerId int) ([]*models.MessageResponse, error) {
+	if roomId <= 0 || limit <= 0 {
+		return nil, errors.New("invalid room id or limit")
 	}
 
 	query, err := r.queries.Get("chat", "GetOldMessages")
@@ -173,7 +389,7 @@ func (r *chatRepository) GetOldMessages(roomName string, limit int) ([]*models.M
 		return nil, err
 	}
 
-	rows, err := r.db.Query(query, roomName, limit)
+	rows, err := r.db.Query(query, roomId, limit, viewerId)
 	if err != nil {
 		return nil, err
 	}
@@ -183,23 +399,37 @@ func (r *chatRepository) GetOldMessages(roomName string, limit int) ([]*models.M
 
 	for rows.Next() {
 		msg := &models.MessageResponse{}
+		author := &models.MessageAuthor{}
 		file := &models.UploadedFile{}
 		var fileId sql.NullInt64
 		var publicId, secureUrl, format, resourceType, originalFilename sql.NullString
 		var size sql.NullFloat64
 		var width, height sql.NullInt64
 		var fileCreatedAt, fileUpdatedAt sql.NullTime
+		var previews, variants []byte
 
 		err := rows.Scan(
-			&msg.Id, &msg.UserId, &msg.Username, &msg.Content, &msg.RoomName,
-			&msg.CreatedAt, &msg.UpdatedAt,
+			&msg.Id, &msg.Type, &msg.UserId, &msg.Username, &author.DisplayName, &author.AvatarUrl, &author.StatusText, &msg.Content, &msg.RoomId, &msg.RoomName,
+			&msg.CreatedAt, &msg.UpdatedAt, &msg.RedactedAt,
 			&fileId, &publicId, &secureUrl, &format, &resourceType, &size,
-			&width, &height, &originalFilename, &fileCreatedAt, &fileUpdatedAt,
+			&width, &height, &originalFilename, &fileCreatedAt, &fileUpdatedAt, &previews, &variants,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		if previews != nil {
+			err = json.Unmarshal(previews, &msg.Previews)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		author.Id = msg.UserId
+		author.Username = msg.Username
+		msg.Author = author
+		msg.Html = markdown.Render(msg.Content)
+
 		if fileId.Valid {
 			msg.FileId = intPtr(int(fileId.Int64))
 			file.Id = int(fileId.Int64)
@@ -213,6 +443,12 @@ func (r *chatRepository) GetOldMessages(roomName string, limit int) ([]*models.M
 			file.OriginalFilename = originalFilename.String
 			file.CreatedAt = fileCreatedAt.Time
 			file.UpdatedAt = fileUpdatedAt.Time
+			if variants != nil {
+				err = json.Unmarshal(variants, &file.Variants)
+				if err != nil {
+					return nil, err
+				}
+			}
 			msg.File = file
 		}
 
@@ -230,18 +466,22 @@ func intPtr(i int) *int {
 	return &i
 }
 
-func (r *chatRepository) CreateNewMessage(data *models.MessageResponse, roomName string) (*models.MessageResponse, error) {
+func (r *chatRepository) CreateNewMessage(data *models.MessageResponse, roomId int) (*models.MessageResponse, error) {
 	message := &models.MessageResponse{}
 
 	if data.FileId != nil {
 		query := `
-			INSERT INTO messages (userId, roomName, content, fileId) 
-			VALUES ($1, $2, $3, $4) 
-			RETURNING id, userId, roomName, fileId, content, createdAt, updatedAt
+			WITH m AS (
+				INSERT INTO messages (userId, roomId, content, fileId) 
+				VALUES ($1, $2, $3, $4) 
+				RETURNING id, userId, roomId, fileId, content, createdAt, updatedAt
+			)
+			SELECT m.id, m.userId, m.roomId, cr.name, m.fileId, m.content, m.createdAt, m.updatedAt
+			FROM m JOIN chatRoom cr ON cr.id = m.roomId
 		`
 
-		err := r.db.QueryRow(query, data.UserId, roomName, data.Content, *data.FileId).Scan(
-			&message.Id, &message.UserId, &message.RoomName, &message.FileId,
+		err := r.db.QueryRow(query, data.UserId, roomId, data.Content, *data.FileId).Scan(
+			&message.Id, &message.UserId, &message.RoomId, &message.RoomName, &message.FileId,
 			&message.Content, &message.CreatedAt, &message.UpdatedAt,
 		)
 		if err != nil {
@@ -249,13 +489,17 @@ func (r *chatRepository) CreateNewMessage(data *models.MessageResponse, roomName
 		}
 	} else {
 		query := `
-			INSERT INTO messages (userId, roomName, content) 
-			VALUES ($1, $2, $3) 
-			RETURNING id, userId, roomName, fileId, content, createdAt, updatedAt
+			WITH m AS (
+				INSERT INTO messages (userId, roomId, content) 
+				VALUES ($1, $2, $3) 
+				RETURNING id, userId, roomId, fileId, content, createdAt, updatedAt
+			)
+			SELECT m.id, m.userId, m.roomId, cr.name, m.fileId, m.content, m.createdAt, m.updatedAt
+			FROM m JOIN chatRoom cr ON cr.id = m.roomId
 		`
 
-		err := r.db.QueryRow(query, data.UserId, roomName, data.Content).Scan(
-			&message.Id, &message.UserId, &message.RoomName, &message.FileId,
+		err := r.db.QueryRow(query, data.UserId, roomId, data.Content).Scan(
+			&message.Id, &message.UserId, &message.RoomId, &message.RoomName, &message.FileId,
 			&message.Content, &message.CreatedAt, &message.UpdatedAt,
 		)
 		if err != nil {
@@ -263,21 +507,49 @@ func (r *chatRepository) CreateNewMessage(data *models.MessageResponse, roomName
 		}
 	}
 
+	message.Html = markdown.Render(message.Content)
 	return message, nil
 }
 
-func (r *chatRepository) JoinRoom(data *models.JoinRoomRequest) error {
-	query := `INSERT INTO groupMembers (userId, roomName) VALUES ($1, $2)`
-	_, err := r.db.Exec(query, data.UserId, data.RoomName)
+// SetRoomTopic changes the topic of the room and records the change in its history
+// as a system message of userId, which it returns
+func (r *chatRepository) SetRoomTopic(roomId int, topic string, content string, userId int) (*models.MessageResponse, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer tx.Rollback()
+
+	err = updateOneRoom(tx, `UPDATE chatRoom SET topic = $2 WHERE id = $1 AND deletedAt IS NULL`, roomId, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &models.MessageResponse{}
+	query := `
+		WITH m AS (
+			INSERT INTO messages (userId, roomId, content, type)
+			VALUES ($1, $2, $3, 'system')
+			RETURNING id, type, userId, roomId, content, createdAt, updatedAt
+		)
+		SELECT m.id, m.type, m.userId, u.username, m.roomId, cr.name, m.content, m.createdAt, m.updatedAt
+		FROM m JOIN chatRoom cr ON cr.id = m.roomId JOIN users u ON u.id = m.userId
+	`
+	err = tx.QueryRow(query, userId, roomId, content).Scan(
+		&message.Id, &message.Type, &message.UserId, &message.Username, &message.RoomId, &message.RoomName,
+		&message.Content, &message.CreatedAt, &message.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	message.Html = markdown.Render(message.Content)
+	return message, tx.Commit()
 }
 
-func (r *chatRepository) JoinPrivateRoom(data *models.JoinRoomRequest) error {
-	query := `INSERT INTO groupMembers (userId, roomName) VALUES ($1, $2)`
-	_, err := r.db.Exec(query, data.UserId, data.RoomName)
+func (r *chatRepository) JoinRoom(data *models.JoinRoomRequest) error {
+	query := `INSERT INTO groupMembers (userId, roomId, role) VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'MEMBER'))`
+	_, err := r.db.Exec(query, data.UserId, data.RoomId, data.Role)
 	if err != nil {
 		return err
 	}
@@ -299,7 +571,8 @@ func (r *chatRepository) GetAllJoinRoom(userId int) ([]*models.ChatRoom, error)
 	var data []*models.ChatRoom
 	for rows.Next() {
 		room := &models.ChatRoom{}
-		err := rows.Scan(&room.Id, &room.Name, &room.Description, &room.Private, &room.UserId, &room.Members)
+		err := rows.Scan(&room.Id, &room.Name, &room.Slug, &room.Description, &room.Private, &room.UserId, &room.ArchivedAt, &room.Members,
+			pq.Array(&room.Tags))
 		if err != nil {
 			return nil, err
 		}
@@ -314,9 +587,9 @@ func (r *chatRepository) GetAllJoinRoom(userId int) ([]*models.ChatRoom, error)
 	return data, nil
 }
 
-func (r *chatRepository) LeaveRoom(userId int, roomName string) error {
-	query := `DELETE FROM groupMembers WHERE userId = $1 AND roomName = $2`
-	_, err := r.db.Exec(query, userId, roomName)
+func (r *chatRepository) LeaveRoom(userId int, roomId int) error {
+	query := `DELETE FROM groupMembers WHERE userId = $1 AND roomId = $2`
+	_, err := r.db.Exec(query, userId, roomId)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,194 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/utils/markdown"
+)
+
+// ExportRepository stores room exports and reads the history they are written from
+type ExportRepository interface {
+	CreateExport(data *models.RoomExport) error
+	GetExport(roomId int, id int) (*models.RoomExport, error)
+	ClaimExport(staleBefore time.Time) (*models.RoomExport, error)
+	FinishExport(id int, status string, path string, size int64, errMessage string) error
+	GetExpiredExports(finishedBefore time.Time) ([]*models.RoomExport, error)
+	DeleteExport(id int) error
+	StreamMessages(roomId int, from *time.Time, to *time.Time, fn func(msg *models.MessageResponse) error) error
+}
+
+type exportRepository struct {
+	db *sql.DB
+}
+
+// NewExportRepository creates a new instance of exportRepository
+func NewExportRepository(db *sql.DB) ExportRepository {
+	return &exportRepository{
+		db: db,
+	}
+}
+
+// exportColumns are read by scanExport
+const exportColumns = `id, roomId, requestedBy, format, fromTime, toTime, status, path, size, error, createdAt, startedAt, finishedAt`
+
+func (r *exportRepository) CreateExport(data *models.RoomExport) error {
+	query := `INSERT INTO roomExports (roomId, requestedBy, format, fromTime, toTime) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, createdAt`
+	err := r.db.QueryRow(query, data.RoomId, data.RequestedBy, data.Format, data.From, data.To).Scan(&data.Id, &data.Status, &data.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) GetExport(roomId int, id int) (*models.RoomExport, error) {
+	query := `SELECT ` + exportColumns + ` FROM roomExports WHERE roomId = $1 AND id = $2`
+	return scanExport(r.db.QueryRow(query, roomId, id))
+}
+
+// ClaimExport marks the oldest pending export as running and returns it. Exports left running
+// since before staleBefore, by a server that stopped, are claimed again. It returns nil when
+// there is nothing to do.
+func (r *exportRepository) ClaimExport(staleBefore time.Time) (*models.RoomExport, error) {
+	query := `UPDATE roomExports SET status = 'RUNNING', startedAt = NOW()
+		WHERE id = (
+			SELECT id FROM roomExports
+			WHERE status = 'PENDING' OR (status = 'RUNNING' AND startedAt < $1)
+			ORDER BY createdAt
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportColumns
+	data, err := scanExport(r.db.QueryRow(query, staleBefore))
+	if err != nil {
+		if err.Error() == "export not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *exportRepository) FinishExport(id int, status string, path string, size int64, errMessage string) error {
+	query := `UPDATE roomExports SET status = $2, path = $3, size = $4, error = $5, finishedAt = NOW() WHERE id = $1`
+	_, err := r.db.Exec(query, id, status, path, size, errMessage)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetExpiredExports returns the exports that finished before finishedBefore
+func (r *exportRepository) GetExpiredExports(finishedBefore time.Time) ([]*models.RoomExport, error) {
+	query := `SELECT ` + exportColumns + ` FROM roomExports WHERE finishedAt < $1`
+	rows, err := r.db.Query(query, finishedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []*models.RoomExport
+	for rows.Next() {
+		export, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, export)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *exportRepository) DeleteExport(id int) error {
+	query := `DELETE FROM roomExports WHERE id = $1`
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// StreamMessages calls fn for every message of the room in the range, oldest first.
+// Rows are read one by one so the history is never held in memory.
+func (r *exportRepository) StreamMessages(roomId int, from *time.Time, to *time.Time, fn func(msg *models.MessageResponse) error) error {
+	query := `SELECT m.id, m.type, m.userId, u.username, m.content, m.roomId, cr.name, m.createdAt, m.updatedAt, m.redactedAt,
+			f.id, f.publicId, f.secureUrl, f.format, f.resourceType, f.size, f.originalFilename
+		FROM messages m
+		JOIN users u ON u.id = m.userId
+		JOIN chatRoom cr ON cr.id = m.roomId
+		LEFT JOIN files f ON f.id = m.fileId
+		WHERE m.roomId = $1
+			AND ($2::timestamp IS NULL OR m.createdAt >= $2)
+			AND ($3::timestamp IS NULL OR m.createdAt < $3)
+		ORDER BY m.createdAt, m.id`
+	rows, err := r.db.Query(query, roomId, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg := &models.MessageResponse{}
+		var fileId sql.NullInt64
+		var publicId, secureUrl, format, resourceType, originalFilename sql.NullString
+		var size sql.NullFloat64
+		err := rows.Scan(&msg.Id, &msg.Type, &msg.UserId, &msg.Username, &msg.Content, &msg.RoomId, &msg.RoomName,
+			&msg.CreatedAt, &msg.UpdatedAt, &msg.RedactedAt,
+			&fileId, &publicId, &secureUrl, &format, &resourceType, &size, &originalFilename)
+		if err != nil {
+			return err
+		}
+
+		msg.Html = markdown.Render(msg.Content)
+		if fileId.Valid {
+			msg.FileId = intPtr(int(fileId.Int64))
+			msg.File = &models.UploadedFile{
+				Id:               int(fileId.Int64),
+				PublicId:         publicId.String,
+				SecureUrl:        secureUrl.String,
+				Format:           format.String,
+				ResourceType:     resourceType.String,
+				Size:             size.Float64,
+				OriginalFilename: originalFilename.String,
+			}
+		}
+
+		err = fn(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// scanExport reads a row of exportColumns
+func scanExport(row rowScanner) (*models.RoomExport, error) {
+	data := &models.RoomExport{}
+	var requestedBy sql.NullInt64
+	err := row.Scan(&data.Id, &data.RoomId, &requestedBy, &data.Format, &data.From, &data.To, &data.Status, &data.Path,
+		&data.Size, &data.Error, &data.CreatedAt, &data.StartedAt, &data.FinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("export not found")
+		}
+		return nil, err
+	}
+
+	if requestedBy.Valid {
+		data.RequestedBy = intPtr(int(requestedBy.Int64))
+	}
+	return data, nil
+}
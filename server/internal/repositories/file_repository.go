@@ -2,13 +2,17 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/gauravst/real-time-chat/internal/database"
 	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
 )
 
 type FileRepository interface {
 	UploadFileInRoom(fileData *models.UploadedFile) error
+	GetFile(fileId int) (*models.UploadedFile, error)
+	GetFileUsage(fileId int) ([]int, bool, error)
 }
 
 type fileRepository struct {
@@ -23,16 +27,89 @@ func NewFileRepository(db *sql.DB, qm *database.QueryManager) FileRepository {
 	}
 }
 
+// UploadFileInRoom saves an uploaded file together with its variants
 func (r *fileRepository) UploadFileInRoom(fileData *models.UploadedFile) error {
 	query, err := r.queries.Get("file", "UploadFile")
 	if err != nil {
 		return err
 	}
 
-	err = r.db.QueryRow(query, fileData.PublicId, fileData.SecureUrl, fileData.Format, fileData.ResourceType, fileData.Size, fileData.Width, fileData.Height, fileData.OriginalFilename).Scan(&fileData.Id, &fileData.PublicId, &fileData.SecureUrl, &fileData.Format, &fileData.ResourceType, &fileData.Size, &fileData.Width, &fileData.Height, &fileData.OriginalFilename, &fileData.CreatedAt)
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	err = tx.QueryRow(query, fileData.PublicId, fileData.SecureUrl, fileData.Format, fileData.ResourceType, fileData.Size, fileData.Width, fileData.Height, fileData.OriginalFilename).Scan(&fileData.Id, &fileData.PublicId, &fileData.SecureUrl, &fileData.Format, &fileData.ResourceType, &fileData.Size, &fileData.Width, &fileData.Height, &fileData.OriginalFilename, &fileData.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for name, variant := range fileData.Variants {
+		_, err = tx.Exec(`INSERT INTO fileVariants (fileId, name, publicId, secureUrl, format, size, width, height)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			fileData.Id, name, variant.PublicId, variant.SecureUrl, variant.Format, variant.Size, variant.Width, variant.Height)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetFile returns a file with its variants, without its times
+func (r *fileRepository) GetFile(fileId int) (*models.UploadedFile, error) {
+	query := `SELECT id, COALESCE(publicId, ''), secureUrl, COALESCE(format, ''), COALESCE(resourceType, ''),
+			COALESCE(size, 0), COALESCE(width, 0), COALESCE(height, 0), originalFilename
+		FROM files WHERE id = $1`
+	data := &models.UploadedFile{}
+	err := r.db.QueryRow(query, fileId).Scan(&data.Id, &data.PublicId, &data.SecureUrl, &data.Format, &data.ResourceType,
+		&data.Size, &data.Width, &data.Height, &data.OriginalFilename)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("file not found")
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`SELECT name, publicId, secureUrl, format, size, width, height FROM fileVariants WHERE fileId = $1`, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		variant := &models.FileVariant{}
+		err := rows.Scan(&name, &variant.PublicId, &variant.SecureUrl, &variant.Format, &variant.Size, &variant.Width, &variant.Height)
+		if err != nil {
+			return nil, err
+		}
+
+		if data.Variants == nil {
+			data.Variants = map[string]*models.FileVariant{}
+		}
+		data.Variants[name] = variant
+	}
+
+	return data, rows.Err()
+}
+
+// GetFileUsage returns the rooms whose messages have the file and whether it is an avatar
+func (r *fileRepository) GetFileUsage(fileId int) ([]int, bool, error) {
+	query := `SELECT
+			ARRAY(SELECT DISTINCT roomId FROM messages WHERE fileId = $1),
+			EXISTS (SELECT 1 FROM users WHERE avatarFileId = $1)`
+	var roomIds pq.Int64Array
+	var avatar bool
+	err := r.db.QueryRow(query, fileId).Scan(&roomIds, &avatar)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rooms := make([]int, len(roomIds))
+	for i, id := range roomIds {
+		rooms[i] = int(id)
+	}
+	return rooms, avatar, nil
 }
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// IdentityRepository stores external identities linked to users
+type IdentityRepository interface {
+	GetUserByIdentity(provider string, subject string) (*models.User, error)
+	CreateIdentity(data *models.UserIdentity) error
+	CreateUserWithIdentity(user *models.LoginRequest, identity *models.UserIdentity) (*models.User, error)
+	GetAllIdentities(userId int) ([]*models.UserIdentity, error)
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+// NewIdentityRepository creates a new instance of identityRepository
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{
+		db: db,
+	}
+}
+
+func (r *identityRepository) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	user := &models.User{}
+	query := `SELECT u.id, u.username, COALESCE(u.role, 'USER'), u.isGuest, u.createdAt
+		FROM userIdentities ui
+		JOIN users u ON ui.userId = u.id
+		WHERE ui.provider = $1 AND ui.subject = $2`
+	err := r.db.QueryRow(query, provider, subject).Scan(&user.Id, &user.Username, &user.Role, &user.IsGuest, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("identity not found")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (r *identityRepository) CreateIdentity(data *models.UserIdentity) error {
+	query := `INSERT INTO userIdentities (userId, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, createdAt`
+	err := r.db.QueryRow(query, data.UserId, data.Provider, data.Subject, data.Email).Scan(&data.Id, &data.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("identity already linked")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity creates a user and links the identity to it in one transaction, so a
+// failed link leaves no user behind
+func (r *identityRepository) CreateUserWithIdentity(data *models.LoginRequest, identity *models.UserIdentity) (*models.User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user := &models.User{}
+	query := `INSERT INTO users (username, password, isGuest) VALUES ($1, $2, FALSE) RETURNING id, username, role, isGuest, createdAt`
+	err = tx.QueryRow(query, data.Username, data.Password).Scan(&user.Id, &user.Username, &user.Role, &user.IsGuest, &user.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("username already taken")
+		}
+		return nil, err
+	}
+
+	identity.UserId = user.Id
+	query = `INSERT INTO userIdentities (userId, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, createdAt`
+	err = tx.QueryRow(query, identity.UserId, identity.Provider, identity.Subject, identity.Email).Scan(&identity.Id, &identity.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("identity already linked")
+		}
+		return nil, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (r *identityRepository) GetAllIdentities(userId int) ([]*models.UserIdentity, error) {
+	query := `SELECT id, userId, provider, subject, COALESCE(email, ''), createdAt FROM userIdentities WHERE userId = $1 ORDER BY createdAt`
+	rows, err := r.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []*models.UserIdentity
+	for rows.Next() {
+		identity := &models.UserIdentity{}
+		err := rows.Scan(&identity.Id, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
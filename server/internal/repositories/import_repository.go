@@ -0,0 +1,294 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// ImportRepository stores imports and remembers what they created
+type ImportRepository interface {
+	CreateImport(data *models.Import) error
+	GetImport(id int) (*models.Import, error)
+	GetAllImports() ([]*models.Import, error)
+	ClaimImport(staleBefore time.Time) (*models.Import, error)
+	SaveImportProgress(id int, stats *models.ImportStats) error
+	FinishImport(id int, status string, stats *models.ImportStats, errMessage string) error
+	RetryImport(id int) error
+	CreatePlaceholderUser(username string, displayName string, password string) (*models.User, error)
+	GetImportedRoom(source string, externalId string) (int, error)
+	SaveImportedRoom(source string, externalId string, roomId int, private bool, topic string, createdAt time.Time) error
+	AddRoomMember(roomId int, userId int) error
+	IsMessageImported(source string, externalId string) (bool, error)
+	ImportMessage(source string, data *models.ImportedMessage) error
+}
+
+type importRepository struct {
+	db *sql.DB
+}
+
+// NewImportRepository creates a new instance of importRepository
+func NewImportRepository(db *sql.DB) ImportRepository {
+	return &importRepository{
+		db: db,
+	}
+}
+
+// importColumns are read by scanImport
+const importColumns = `id, source, path, requestedBy, status, rooms, users, messages, files, skipped, error, createdAt, startedAt, finishedAt`
+
+func (r *importRepository) CreateImport(data *models.Import) error {
+	query := `INSERT INTO imports (source, path, requestedBy) VALUES ($1, $2, $3) RETURNING id, status, createdAt`
+	err := r.db.QueryRow(query, data.Source, data.Path, data.RequestedBy).Scan(&data.Id, &data.Status, &data.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importRepository) GetImport(id int) (*models.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM imports WHERE id = $1`
+	return scanImport(r.db.QueryRow(query, id))
+}
+
+func (r *importRepository) GetAllImports() ([]*models.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM imports ORDER BY createdAt DESC`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []*models.Import{}
+	for rows.Next() {
+		item, err := scanImport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// ClaimImport marks the oldest pending import as running and returns it, imports left running
+// since before staleBefore are claimed again. It returns nil when there is nothing to do.
+func (r *importRepository) ClaimImport(staleBefore time.Time) (*models.Import, error) {
+	query := `UPDATE imports SET status = 'RUNNING', startedAt = NOW()
+		WHERE id = (
+			SELECT id FROM imports
+			WHERE status = 'PENDING' OR (status = 'RUNNING' AND startedAt < $1)
+			ORDER BY createdAt
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + importColumns
+	data, err := scanImport(r.db.QueryRow(query, staleBefore))
+	if err != nil {
+		if err.Error() == "import not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *importRepository) SaveImportProgress(id int, stats *models.ImportStats) error {
+	query := `UPDATE imports SET rooms = $2, users = $3, messages = $4, files = $5, skipped = $6 WHERE id = $1`
+	_, err := r.db.Exec(query, id, stats.Rooms, stats.Users, stats.Messages, stats.Files, stats.Skipped)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importRepository) FinishImport(id int, status string, stats *models.ImportStats, errMessage string) error {
+	query := `UPDATE imports SET status = $2, rooms = $3, users = $4, messages = $5, files = $6, skipped = $7, error = $8,
+		finishedAt = NOW() WHERE id = $1`
+	_, err := r.db.Exec(query, id, status, stats.Rooms, stats.Users, stats.Messages, stats.Files, stats.Skipped, errMessage)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RetryImport queues a failed import again, it continues where it stopped
+func (r *importRepository) RetryImport(id int) error {
+	query := `UPDATE imports SET status = 'PENDING', error = '', startedAt = NULL, finishedAt = NULL
+		WHERE id = $1 AND status = 'FAILED'`
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("import not found")
+	}
+	return nil
+}
+
+// CreatePlaceholderUser creates a user who can not sign in, password is a hash nobody knows
+func (r *importRepository) CreatePlaceholderUser(username string, displayName string, password string) (*models.User, error) {
+	user := &models.User{}
+	query := `INSERT INTO users (username, password, displayName, isPlaceholder) VALUES ($1, $2, NULLIF($3, ''), TRUE)
+		RETURNING id, username, role, isGuest, createdAt`
+	err := r.db.QueryRow(query, username, password, displayName).Scan(&user.Id, &user.Username, &user.Role, &user.IsGuest, &user.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("username already taken")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetImportedRoom returns the room created for a channel, 0 when there is none
+// or it was deleted since
+func (r *importRepository) GetImportedRoom(source string, externalId string) (int, error) {
+	query := `SELECT cr.id FROM importedObjects io JOIN chatRoom cr ON cr.id = io.localId
+		WHERE io.source = $1 AND io.kind = 'room' AND io.externalId = $2 AND cr.deletedAt IS NULL`
+	var id int
+	err := r.db.QueryRow(query, source, externalId).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// SaveImportedRoom gives a new room the settings of its channel and remembers it
+func (r *importRepository) SaveImportedRoom(source string, externalId string, roomId int, private bool, topic string, createdAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE chatRoom SET private = $2, topic = $3, createdAt = COALESCE($4, createdAt) WHERE id = $1`
+	var created *time.Time
+	if !createdAt.IsZero() {
+		created = &createdAt
+	}
+	err = updateOneRoom(tx, query, roomId, private, topic, created)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO importedObjects (source, kind, externalId, localId) VALUES ($1, 'room', $2, $3)
+		ON CONFLICT (source, kind, externalId) DO UPDATE SET localId = EXCLUDED.localId`
+	_, err = tx.Exec(query, source, externalId, roomId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *importRepository) AddRoomMember(roomId int, userId int) error {
+	query := `INSERT INTO groupMembers (userId, roomId, role) VALUES ($1, $2, 'MEMBER') ON CONFLICT (userId, roomId) DO NOTHING`
+	_, err := r.db.Exec(query, userId, roomId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *importRepository) IsMessageImported(source string, externalId string) (bool, error) {
+	query := `SELECT EXISTS(
+			SELECT 1 FROM importedObjects io JOIN messages m ON m.id = io.localId
+			WHERE io.source = $1 AND io.kind = 'message' AND io.externalId = $2
+		)`
+	var exists bool
+	err := r.db.QueryRow(query, source, externalId).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// ImportMessage saves a message, with its file, at its original time and remembers it
+func (r *importRepository) ImportMessage(source string, data *models.ImportedMessage) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fileId *int
+	if file := data.File; file != nil {
+		query := `INSERT INTO files (publicId, secureUrl, format, resourceType, size, width, height, originalFilename, createdAt)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+		err = tx.QueryRow(query, file.PublicId, file.SecureUrl, file.Format, file.ResourceType, file.Size, file.Width, file.Height,
+			file.OriginalFilename, data.CreatedAt).Scan(&file.Id)
+		if err != nil {
+			return err
+		}
+		fileId = &file.Id
+
+		for name, variant := range file.Variants {
+			_, err = tx.Exec(`INSERT INTO fileVariants (fileId, name, publicId, secureUrl, format, size, width, height)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				file.Id, name, variant.PublicId, variant.SecureUrl, variant.Format, variant.Size, variant.Width, variant.Height)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var messageId int
+	query := `INSERT INTO messages (userId, roomId, content, fileId, createdAt, updatedAt) VALUES ($1, $2, $3, $4, $5, $5) RETURNING id`
+	err = tx.QueryRow(query, data.UserId, data.RoomId, data.Content, fileId, data.CreatedAt).Scan(&messageId)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO importedObjects (source, kind, externalId, localId) VALUES ($1, 'message', $2, $3)
+		ON CONFLICT (source, kind, externalId) DO UPDATE SET localId = EXCLUDED.localId`
+	_, err = tx.Exec(query, source, data.ExternalId, messageId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanImport reads a row of importColumns
+func scanImport(row rowScanner) (*models.Import, error) {
+	data := &models.Import{}
+	var requestedBy sql.NullInt64
+	err := row.Scan(&data.Id, &data.Source, &data.Path, &requestedBy, &data.Status, &data.Rooms, &data.Users, &data.Messages,
+		&data.Files, &data.Skipped, &data.Error, &data.CreatedAt, &data.StartedAt, &data.FinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("import not found")
+		}
+		return nil, err
+	}
+
+	if requestedBy.Valid {
+		data.RequestedBy = intPtr(int(requestedBy.Int64))
+	}
+	return data, nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// InviteRepository stores invite links of private rooms
+type InviteRepository interface {
+	CreateInvite(data *models.RoomInvite) error
+	GetAllInvites(roomId int) ([]*models.RoomInvite, error)
+	RevokeInvite(roomId int, id int) error
+	GetActiveInvite(code string) (*models.RoomInvite, error)
+	UseInvite(id int, userId int) error
+}
+
+type inviteRepository struct {
+	db *sql.DB
+}
+
+// NewInviteRepository creates a new instance of inviteRepository
+func NewInviteRepository(db *sql.DB) InviteRepository {
+	return &inviteRepository{
+		db: db,
+	}
+}
+
+func (r *inviteRepository) CreateInvite(data *models.RoomInvite) error {
+	query := `INSERT INTO roomInvites (roomId, code, createdBy, role, maxUses, expiresAt) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, createdAt`
+	err := r.db.QueryRow(query, data.RoomId, data.Code, data.CreatedBy, data.Role, data.MaxUses, data.ExpiresAt).Scan(&data.Id, &data.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAllInvites returns the invites of a room together with the users who joined with them
+func (r *inviteRepository) GetAllInvites(roomId int) ([]*models.RoomInvite, error) {
+	query := `SELECT id, roomId, code, createdBy, role, maxUses, uses, expiresAt, revokedAt, createdAt
+		FROM roomInvites WHERE roomId = $1 ORDER BY createdAt DESC`
+	rows, err := r.db.Query(query, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []*models.RoomInvite{}
+	invites := make(map[int]*models.RoomInvite)
+	for rows.Next() {
+		invite := &models.RoomInvite{Members: []*models.InviteMember{}}
+		err := rows.Scan(&invite.Id, &invite.RoomId, &invite.Code, &invite.CreatedBy, &invite.Role, &invite.MaxUses, &invite.Uses,
+			&invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, invite)
+		invites[invite.Id] = invite
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT gm.inviteId, u.id, u.username, gm.joinedAt
+		FROM groupMembers gm JOIN users u ON u.id = gm.userId
+		WHERE gm.roomId = $1 AND gm.inviteId IS NOT NULL ORDER BY gm.joinedAt`
+	memberRows, err := r.db.Query(query, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+
+	for memberRows.Next() {
+		var inviteId int
+		member := &models.InviteMember{}
+		err := memberRows.Scan(&inviteId, &member.UserId, &member.Username, &member.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if invite, ok := invites[inviteId]; ok {
+			invite.Members = append(invite.Members, member)
+		}
+	}
+
+	if err = memberRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *inviteRepository) RevokeInvite(roomId int, id int) error {
+	query := `UPDATE roomInvites SET revokedAt = CURRENT_TIMESTAMP WHERE id = $1 AND roomId = $2 AND revokedAt IS NULL`
+	result, err := r.db.Exec(query, id, roomId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("invite not found")
+	}
+	return nil
+}
+
+// GetActiveInvite returns an invite that is not revoked, expired or used up
+func (r *inviteRepository) GetActiveInvite(code string) (*models.RoomInvite, error) {
+	invite := &models.RoomInvite{}
+	query := `SELECT id, roomId, code, createdBy, role, maxUses, uses, expiresAt, createdAt FROM roomInvites
+		WHERE code = $1 AND revokedAt IS NULL AND (expiresAt IS NULL OR expiresAt > $2) AND (maxUses IS NULL OR uses < maxUses)`
+	err := r.db.QueryRow(query, code, time.Now()).Scan(&invite.Id, &invite.RoomId, &invite.Code, &invite.CreatedBy, &invite.Role,
+		&invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invite not found")
+		}
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// UseInvite adds the user to the room of the invite and counts the use. The invite is
+// checked again under lock so concurrent joins can not exceed maxUses.
+func (r *inviteRepository) UseInvite(id int, userId int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var roomId int
+	var role string
+	query := `UPDATE roomInvites SET uses = uses + 1
+		WHERE id = $1 AND revokedAt IS NULL AND (expiresAt IS NULL OR expiresAt > $2) AND (maxUses IS NULL OR uses < maxUses)
+		RETURNING roomId, role`
+	err = tx.QueryRow(query, id, time.Now()).Scan(&roomId, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("invite not found")
+		}
+		return err
+	}
+
+	query = `INSERT INTO groupMembers (userId, roomId, role, inviteId) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
+	result, err := tx.Exec(query, userId, roomId, role, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// members don't use up the invite
+	if count == 0 {
+		return fmt.Errorf("already a member")
+	}
+
+	return tx.Commit()
+}
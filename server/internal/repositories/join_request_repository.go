@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// JoinRequestRepository stores requests to join rooms that need approval
+type JoinRequestRepository interface {
+	CreateJoinRequest(roomId int, userId int) (*models.JoinRequest, error)
+	GetPendingJoinRequests(roomId int) ([]*models.JoinRequest, error)
+	GetUserJoinRequests(userId int) ([]*models.JoinRequest, error)
+	DecideJoinRequest(roomId int, id int, status string, decidedBy int, approve bool) (*models.JoinRequest, error)
+	GetRoomManagerIds(roomId int) ([]int, error)
+}
+
+type joinRequestRepository struct {
+	db *sql.DB
+}
+
+// NewJoinRequestRepository creates a new instance of joinRequestRepository
+func NewJoinRequestRepository(db *sql.DB) JoinRequestRepository {
+	return &joinRequestRepository{
+		db: db,
+	}
+}
+
+func (r *joinRequestRepository) CreateJoinRequest(roomId int, userId int) (*models.JoinRequest, error) {
+	data := &models.JoinRequest{}
+	query := `WITH request AS (
+			INSERT INTO joinRequests (roomId, userId) VALUES ($1, $2)
+			ON CONFLICT (roomId, userId) WHERE status = 'PENDING' DO NOTHING
+			RETURNING id, roomId, userId, status, createdAt
+		)
+		SELECT request.id, request.roomId, cr.name, cr.slug, request.userId, u.username, request.status, request.createdAt
+		FROM request JOIN users u ON u.id = request.userId JOIN chatRoom cr ON cr.id = request.roomId`
+	err := r.db.QueryRow(query, roomId, userId).Scan(&data.Id, &data.RoomId, &data.RoomName, &data.RoomSlug, &data.UserId, &data.Username,
+		&data.Status, &data.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("request already pending")
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *joinRequestRepository) GetPendingJoinRequests(roomId int) ([]*models.JoinRequest, error) {
+	query := `SELECT jr.id, jr.roomId, cr.name, cr.slug, jr.userId, u.username, jr.status, jr.decidedBy, jr.createdAt, jr.decidedAt
+		FROM joinRequests jr JOIN users u ON u.id = jr.userId JOIN chatRoom cr ON cr.id = jr.roomId
+		WHERE jr.roomId = $1 AND jr.status = 'PENDING' ORDER BY jr.createdAt`
+	return r.queryJoinRequests(query, roomId)
+}
+
+func (r *joinRequestRepository) GetUserJoinRequests(userId int) ([]*models.JoinRequest, error) {
+	query := `SELECT jr.id, jr.roomId, cr.name, cr.slug, jr.userId, u.username, jr.status, jr.decidedBy, jr.createdAt, jr.decidedAt
+		FROM joinRequests jr JOIN users u ON u.id = jr.userId JOIN chatRoom cr ON cr.id = jr.roomId
+		WHERE jr.userId = $1 ORDER BY jr.createdAt DESC`
+	return r.queryJoinRequests(query, userId)
+}
+
+// DecideJoinRequest answers a pending request, an approved requester becomes a member
+func (r *joinRequestRepository) DecideJoinRequest(roomId int, id int, status string, decidedBy int, approve bool) (*models.JoinRequest, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	data := &models.JoinRequest{}
+	query := `UPDATE joinRequests SET status = $3, decidedBy = $4, decidedAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND roomId = $2 AND status = 'PENDING'
+		RETURNING id, roomId, userId, status, decidedBy, createdAt, decidedAt`
+	err = tx.QueryRow(query, id, roomId, status, decidedBy).Scan(&data.Id, &data.RoomId, &data.UserId, &data.Status, &data.DecidedBy,
+		&data.CreatedAt, &data.DecidedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("request not found")
+		}
+		return nil, err
+	}
+
+	query = `SELECT u.username, cr.name, cr.slug FROM users u, chatRoom cr WHERE u.id = $1 AND cr.id = $2`
+	err = tx.QueryRow(query, data.UserId, data.RoomId).Scan(&data.Username, &data.RoomName, &data.RoomSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	if approve {
+		query = `INSERT INTO groupMembers (userId, roomId) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		_, err = tx.Exec(query, data.UserId, roomId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, tx.Commit()
+}
+
+// GetRoomManagerIds returns the owner and the moderators of a room
+func (r *joinRequestRepository) GetRoomManagerIds(roomId int) ([]int, error) {
+	query := `SELECT userId FROM chatRoom WHERE id = $1
+		UNION
+		SELECT userId FROM groupMembers WHERE roomId = $1 AND role IN ('OWNER', 'MODERATOR')`
+	rows, err := r.db.Query(query, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *joinRequestRepository) queryJoinRequests(query string, args ...interface{}) ([]*models.JoinRequest, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []*models.JoinRequest{}
+	for rows.Next() {
+		request := &models.JoinRequest{}
+		err := rows.Scan(&request.Id, &request.RoomId, &request.RoomName, &request.RoomSlug, &request.UserId, &request.Username, &request.Status, &request.DecidedBy,
+			&request.CreatedAt, &request.DecidedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, request)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
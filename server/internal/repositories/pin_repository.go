@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/utils/markdown"
+)
+
+// PinRepository stores the pinned messages of rooms
+type PinRepository interface {
+	GetPinnedMessages(roomId int) ([]*models.PinnedMessage, error)
+	PinMessage(roomId int, messageId int, userId int, maxPins int) (*models.PinnedMessage, error)
+	UnpinMessage(roomId int, messageId int) error
+}
+
+type pinRepository struct {
+	db *sql.DB
+}
+
+// NewPinRepository creates a new instance of pinRepository
+func NewPinRepository(db *sql.DB) PinRepository {
+	return &pinRepository{
+		db: db,
+	}
+}
+
+// pinColumns are read by scanPin
+const pinColumns = `m.id, m.type, m.userId, u.username, m.content, m.roomId, cr.name, m.fileId,
+	m.createdAt, m.updatedAt, p.pinnedBy, p.pinnedAt
+	FROM roomPins p
+	JOIN messages m ON m.id = p.messageId
+	JOIN users u ON u.id = m.userId
+	JOIN chatRoom cr ON cr.id = p.roomId`
+
+func (r *pinRepository) GetPinnedMessages(roomId int) ([]*models.PinnedMessage, error) {
+	query := `SELECT ` + pinColumns + ` WHERE p.roomId = $1 ORDER BY p.pinnedAt DESC`
+	rows, err := r.db.Query(query, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []*models.PinnedMessage{}
+	for rows.Next() {
+		pin, err := scanPin(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, pin)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// PinMessage pins a message of the room as long as the room has less than maxPins pins.
+// The room row is locked so concurrent pins can not go past the limit, the pins are counted
+// by a later statement so its snapshot has the pins of the transactions that held the lock.
+func (r *pinRepository) PinMessage(roomId int, messageId int, userId int, maxPins int) (*models.PinnedMessage, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id FROM chatRoom WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, roomId).Scan(&roomId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("room not found")
+		}
+		return nil, err
+	}
+
+	var count int
+	var exists, pinned bool
+	query = `SELECT (SELECT COUNT(*) FROM roomPins WHERE roomId = $1),
+		EXISTS(SELECT 1 FROM messages WHERE id = $2 AND roomId = $1),
+		EXISTS(SELECT 1 FROM roomPins WHERE roomId = $1 AND messageId = $2)`
+	err = tx.QueryRow(query, roomId, messageId).Scan(&count, &exists, &pinned)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	if pinned {
+		return nil, fmt.Errorf("message already pinned")
+	}
+
+	if count >= maxPins {
+		return nil, fmt.Errorf("pin limit reached")
+	}
+
+	_, err = tx.Exec(`INSERT INTO roomPins (roomId, messageId, pinnedBy) VALUES ($1, $2, $3)`, roomId, messageId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	pin, err := scanPin(tx.QueryRow(`SELECT `+pinColumns+` WHERE p.roomId = $1 AND p.messageId = $2`, roomId, messageId))
+	if err != nil {
+		return nil, err
+	}
+
+	return pin, tx.Commit()
+}
+
+func (r *pinRepository) UnpinMessage(roomId int, messageId int) error {
+	query := `DELETE FROM roomPins WHERE roomId = $1 AND messageId = $2`
+	result, err := r.db.Exec(query, roomId, messageId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("pin not found")
+	}
+	return nil
+}
+
+// scanPin reads a row of pinColumns
+func scanPin(row rowScanner) (*models.PinnedMessage, error) {
+	msg := &models.MessageResponse{}
+	pin := &models.PinnedMessage{Message: msg}
+	var fileId, pinnedBy sql.NullInt64
+	err := row.Scan(&msg.Id, &msg.Type, &msg.UserId, &msg.Username, &msg.Content, &msg.RoomId, &msg.RoomName, &fileId,
+		&msg.CreatedAt, &msg.UpdatedAt, &pinnedBy, &pin.PinnedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Html = markdown.Render(msg.Content)
+	if fileId.Valid {
+		msg.FileId = intPtr(int(fileId.Int64))
+	}
+	if pinnedBy.Valid {
+		pin.PinnedBy = intPtr(int(pinnedBy.Int64))
+	}
+	return pin, nil
+}
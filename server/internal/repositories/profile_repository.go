@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// ProfileRepository reads and updates the profile columns of users
+type ProfileRepository interface {
+	GetProfile(userId int) (*models.Profile, error)
+	UpdateProfile(userId int, data *models.ProfileRequest) error
+	SetAvatar(userId int, file *models.UploadedFile) (*models.UploadedFile, error)
+	RemoveAvatar(userId int) (*models.UploadedFile, error)
+}
+
+type profileRepository struct {
+	db *sql.DB
+}
+
+// NewProfileRepository creates a new instance of profileRepository
+func NewProfileRepository(db *sql.DB) ProfileRepository {
+	return &profileRepository{
+		db: db,
+	}
+}
+
+func (r *profileRepository) GetProfile(userId int) (*models.Profile, error) {
+	data := &models.Profile{}
+	query := `SELECT id, username, COALESCE(displayName, ''), COALESCE(bio, ''), COALESCE(profilePic, ''),
+			CASE WHEN statusExpiresAt IS NULL OR statusExpiresAt > NOW() THEN COALESCE(statusText, '') ELSE '' END,
+			CASE WHEN statusExpiresAt > NOW() THEN statusExpiresAt END
+		FROM users WHERE id = $1`
+	err := r.db.QueryRow(query, userId).Scan(&data.UserId, &data.Username, &data.DisplayName, &data.Bio, &data.AvatarUrl, &data.StatusText, &data.StatusExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *profileRepository) UpdateProfile(userId int, data *models.ProfileRequest) error {
+	query := `UPDATE users SET displayName = NULLIF($2, ''), bio = NULLIF($3, ''), statusText = NULLIF($4, ''), statusExpiresAt = $5, updatedAt = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := r.db.Exec(query, userId, data.DisplayName, data.Bio, data.StatusText, data.StatusExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetAvatar points the user at a new avatar file and returns the previous one, if any
+func (r *profileRepository) SetAvatar(userId int, file *models.UploadedFile) (*models.UploadedFile, error) {
+	return r.replaceAvatar(userId, &file.Id, file.SecureUrl)
+}
+
+// RemoveAvatar clears the avatar and returns the removed file, if any
+func (r *profileRepository) RemoveAvatar(userId int) (*models.UploadedFile, error) {
+	return r.replaceAvatar(userId, nil, "")
+}
+
+func (r *profileRepository) replaceAvatar(userId int, fileId *int, url string) (*models.UploadedFile, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldFileId sql.NullInt64
+	err = tx.QueryRow(`SELECT avatarFileId FROM users WHERE id = $1 FOR UPDATE`, userId).Scan(&oldFileId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET avatarFileId = $2, profilePic = NULLIF($3, ''), updatedAt = CURRENT_TIMESTAMP WHERE id = $1`, userId, fileId, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var old *models.UploadedFile
+	if oldFileId.Valid {
+		old = &models.UploadedFile{}
+		err = tx.QueryRow(`DELETE FROM files WHERE id = $1 RETURNING id, COALESCE(publicId, '')`, oldFileId.Int64).Scan(&old.Id, &old.PublicId)
+		if err == sql.ErrNoRows {
+			old = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return old, tx.Commit()
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
+)
+
+// RetentionRepository removes messages that are older than the retention of their room
+type RetentionRepository interface {
+	SetRoomRetention(roomId int, days *int) error
+	PurgeExpiredMessages(defaultDays int, limit int, redact bool) (*models.RetentionResult, error)
+}
+
+type retentionRepository struct {
+	db *sql.DB
+}
+
+// NewRetentionRepository creates a new instance of retentionRepository
+func NewRetentionRepository(db *sql.DB) RetentionRepository {
+	return &retentionRepository{
+		db: db,
+	}
+}
+
+func (r *retentionRepository) SetRoomRetention(roomId int, days *int) error {
+	return updateOneRoom(r.db, `UPDATE chatRoom SET retentionDays = $2 WHERE id = $1 AND deletedAt IS NULL`, roomId, days)
+}
+
+// expiredMessages selects up to $2 messages older than the retention of their room,
+// rooms without their own retention keep messages for $1 days
+const expiredMessages = `WITH expired AS (
+		SELECT m.id, m.fileId FROM messages m JOIN chatRoom cr ON cr.id = m.roomId
+		WHERE m.redactedAt IS NULL
+			AND COALESCE(cr.retentionDays, $1) > 0
+			AND m.createdAt < NOW() - make_interval(days => COALESCE(cr.retentionDays, $1))
+		ORDER BY m.id
+		LIMIT $2
+		FOR UPDATE OF m SKIP LOCKED
+	)`
+
+// PurgeExpiredMessages deletes or redacts one batch of expired messages, then deletes the
+// files only they used. The caller removes the returned objects from storage.
+func (r *retentionRepository) PurgeExpiredMessages(defaultDays int, limit int, redact bool) (*models.RetentionResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := expiredMessages + `
+		DELETE FROM messages m USING expired e WHERE m.id = e.id RETURNING m.roomId, e.fileId`
+	if redact {
+		// the link previews went with the content
+		query = expiredMessages + `, previews AS (
+				DELETE FROM messagePreviews mp USING expired e WHERE mp.messageId = e.id
+			)
+			UPDATE messages m SET content = '', fileId = NULL, redactedAt = NOW(), updatedAt = NOW()
+			FROM expired e WHERE m.id = e.id RETURNING m.roomId, e.fileId`
+	}
+
+	rows, err := tx.Query(query, defaultDays, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.RetentionResult{Rooms: make(map[int]int)}
+	var fileIds []int64
+	for rows.Next() {
+		var roomId int
+		var fileId sql.NullInt64
+		err := rows.Scan(&roomId, &fileId)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		result.Rooms[roomId]++
+		result.Messages++
+		if fileId.Valid {
+			fileIds = append(fileIds, fileId.Int64)
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(fileIds) > 0 {
+		query = `DELETE FROM files f WHERE f.id = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM messages WHERE fileId = f.id)
+			AND NOT EXISTS (SELECT 1 FROM users WHERE avatarFileId = f.id)
+			RETURNING COALESCE(publicId, ''), ARRAY(SELECT publicId FROM fileVariants WHERE fileId = f.id)`
+		rows, err = tx.Query(query, pq.Int64Array(fileIds))
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var publicId string
+			var variants pq.StringArray
+			err := rows.Scan(&publicId, &variants)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			result.Files++
+			if publicId != "" {
+				result.PublicIds = append(result.PublicIds, publicId)
+			}
+			result.PublicIds = append(result.PublicIds, variants...)
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit()
+}
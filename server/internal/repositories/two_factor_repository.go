@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// TwoFactorRepository stores TOTP secrets and recovery codes
+type TwoFactorRepository interface {
+	GetTotp(userId int) (*models.UserTotp, error)
+	SaveTotpSecret(userId int, secret string) error
+	ConfirmTotp(userId int, step int64) error
+	UseTotpStep(userId int, step int64) error
+	DeleteTotp(userId int) error
+	CreateRecoveryCodes(userId int, codeHashes []string) error
+	UseRecoveryCode(userId int, codeHash string) error
+}
+
+type twoFactorRepository struct {
+	db *sql.DB
+}
+
+// NewTwoFactorRepository creates a new instance of twoFactorRepository
+func NewTwoFactorRepository(db *sql.DB) TwoFactorRepository {
+	return &twoFactorRepository{
+		db: db,
+	}
+}
+
+func (r *twoFactorRepository) GetTotp(userId int) (*models.UserTotp, error) {
+	data := &models.UserTotp{}
+	query := `SELECT userId, secret, confirmedAt, lastUsedStep FROM userTotp WHERE userId = $1`
+	err := r.db.QueryRow(query, userId).Scan(&data.UserId, &data.Secret, &data.ConfirmedAt, &data.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("2fa not enrolled")
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// SaveTotpSecret starts or restarts an enrollment, a confirmed secret is never replaced
+func (r *twoFactorRepository) SaveTotpSecret(userId int, secret string) error {
+	query := `INSERT INTO userTotp (userId, secret) VALUES ($1, $2)
+		ON CONFLICT (userId) DO UPDATE SET secret = EXCLUDED.secret, createdAt = CURRENT_TIMESTAMP
+		WHERE userTotp.confirmedAt IS NULL`
+	result, err := r.db.Exec(query, userId, secret)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("2fa already enabled")
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ConfirmTotp(userId int, step int64) error {
+	query := `UPDATE userTotp SET confirmedAt = CURRENT_TIMESTAMP, lastUsedStep = $2 WHERE userId = $1 AND confirmedAt IS NULL`
+	result, err := r.db.Exec(query, userId, step)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("2fa already enabled")
+	}
+	return nil
+}
+
+// UseTotpStep records the step of an accepted code, a code can only be used once
+func (r *twoFactorRepository) UseTotpStep(userId int, step int64) error {
+	query := `UPDATE userTotp SET lastUsedStep = $2 WHERE userId = $1 AND lastUsedStep < $2`
+	result, err := r.db.Exec(query, userId, step)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("code already used")
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) DeleteTotp(userId int) error {
+	query := `DELETE FROM recoveryCodes WHERE userId = $1`
+	_, err := r.db.Exec(query, userId)
+	if err != nil {
+		return err
+	}
+
+	query = `DELETE FROM userTotp WHERE userId = $1`
+	_, err = r.db.Exec(query, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateRecoveryCodes replaces all recovery codes of the user
+func (r *twoFactorRepository) CreateRecoveryCodes(userId int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM recoveryCodes WHERE userId = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err = tx.Exec(`INSERT INTO recoveryCodes (userId, codeHash) VALUES ($1, $2)`, userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(userId int, codeHash string) error {
+	query := `UPDATE recoveryCodes SET usedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND codeHash = $2 AND usedAt IS NULL`
+	result, err := r.db.Exec(query, userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("invalid recovery code")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
+)
+
+// UnfurlRepository caches link previews by url and stores which messages show them
+type UnfurlRepository interface {
+	SetRoomUnfurl(roomId int, enabled bool) error
+	IsRoomUnfurled(roomId int) (bool, error)
+	GetLinkPreview(url string, okAfter time.Time, failedAfter time.Time) (*models.LinkPreview, error)
+	SaveLinkPreview(preview *models.LinkPreview) error
+	AddMessagePreviews(messageId int, urls []string) error
+	DeleteStalePreviews(before time.Time) (int64, error)
+}
+
+type unfurlRepository struct {
+	db *sql.DB
+}
+
+// NewUnfurlRepository creates a new instance of unfurlRepository
+func NewUnfurlRepository(db *sql.DB) UnfurlRepository {
+	return &unfurlRepository{
+		db: db,
+	}
+}
+
+func (r *unfurlRepository) SetRoomUnfurl(roomId int, enabled bool) error {
+	return updateOneRoom(r.db, `UPDATE chatRoom SET unfurlLinks = $2 WHERE id = $1 AND deletedAt IS NULL`, roomId, enabled)
+}
+
+// IsRoomUnfurled is false for rooms that turned previews off and for archived or deleted rooms
+func (r *unfurlRepository) IsRoomUnfurled(roomId int) (bool, error) {
+	query := `SELECT unfurlLinks FROM chatRoom WHERE id = $1 AND archivedAt IS NULL AND deletedAt IS NULL`
+	var enabled bool
+	err := r.db.QueryRow(query, roomId).Scan(&enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return enabled, nil
+}
+
+// GetLinkPreview returns the cached preview of url, or nil when there is none fetched after
+// okAfter, or after failedAfter for a page without a preview
+func (r *unfurlRepository) GetLinkPreview(url string, okAfter time.Time, failedAfter time.Time) (*models.LinkPreview, error) {
+	query := `SELECT url, ok, title, description, siteName, imageUrl FROM linkPreviews
+		WHERE url = $1 AND fetchedAt > CASE WHEN ok THEN $2 ELSE $3 END`
+	data := &models.LinkPreview{}
+	err := r.db.QueryRow(query, url, okAfter, failedAfter).Scan(&data.Url, &data.Ok, &data.Title, &data.Description, &data.SiteName, &data.ImageUrl)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// SaveLinkPreview caches a fetched preview. A failed fetch doesn't replace a preview that
+// messages may already show.
+func (r *unfurlRepository) SaveLinkPreview(preview *models.LinkPreview) error {
+	query := `INSERT INTO linkPreviews (url, ok, title, description, siteName, imageUrl)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (url) DO UPDATE SET ok = EXCLUDED.ok, title = EXCLUDED.title, description = EXCLUDED.description,
+			siteName = EXCLUDED.siteName, imageUrl = EXCLUDED.imageUrl, fetchedAt = CURRENT_TIMESTAMP
+		WHERE EXCLUDED.ok OR NOT linkPreviews.ok`
+	_, err := r.db.Exec(query, preview.Url, preview.Ok, preview.Title, preview.Description, preview.SiteName, preview.ImageUrl)
+	return err
+}
+
+// AddMessagePreviews shows the cached previews of urls under the message, in the given order
+func (r *unfurlRepository) AddMessagePreviews(messageId int, urls []string) error {
+	query := `INSERT INTO messagePreviews (messageId, url, position)
+		SELECT $1, u.url, u.position FROM unnest($2::text[]) WITH ORDINALITY AS u(url, position)
+		ON CONFLICT DO NOTHING`
+	_, err := r.db.Exec(query, messageId, pq.Array(urls))
+	return err
+}
+
+// DeleteStalePreviews removes cached previews fetched before the given time that no message shows
+func (r *unfurlRepository) DeleteStalePreviews(before time.Time) (int64, error) {
+	query := `DELETE FROM linkPreviews lp WHERE lp.fetchedAt < $1
+		AND NOT EXISTS (SELECT 1 FROM messagePreviews mp WHERE mp.url = lp.url)`
+	result, err := r.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
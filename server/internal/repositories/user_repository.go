@@ -2,8 +2,10 @@ package repositories
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/lib/pq"
 )
 
 // UserRepository defines the interface for user-related database operations
@@ -13,6 +15,8 @@ type UserRepository interface {
 	GetUserByID(id int) (*models.User, error)
 	UpdateUser(user *models.UserRequest) error
 	DeleteUser(id int) error
+	DeleteInactiveGuests(cutoff time.Time) (int64, []string, error)
+	AnonymizeInactiveGuests(cutoff time.Time) (int64, error)
 }
 
 // userRepository implements the UserRepository interface
@@ -99,3 +103,89 @@ func (r *userRepository) DeleteUser(id int) error {
 
 	return nil
 }
+
+// DeleteInactiveGuests removes guests not seen since cutoff together with their messages, uploads
+// and avatars. Guests that own a room are skipped. It returns the number of guests and the
+// publicIds of the removed files and their variants.
+func (r *userRepository) DeleteInactiveGuests(cutoff time.Time) (int64, []string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `WITH guests AS (
+			DELETE FROM users u
+			WHERE u.isGuest AND u.anonymizedAt IS NULL AND u.lastSeenAt < $1
+			AND NOT EXISTS (SELECT 1 FROM chatRoom cr WHERE cr.userId = u.id)
+			RETURNING u.id, u.avatarFileId
+		), removed AS (
+			DELETE FROM messages WHERE userId IN (SELECT id FROM guests) RETURNING fileId
+		)
+		SELECT (SELECT COUNT(*) FROM guests),
+			ARRAY(SELECT fileId FROM removed WHERE fileId IS NOT NULL
+				UNION SELECT avatarFileId FROM guests WHERE avatarFileId IS NOT NULL)`
+	var count int64
+	var fileIds pq.Int64Array
+	err = tx.QueryRow(query, cutoff).Scan(&count, &fileIds)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var publicIds []string
+	if len(fileIds) > 0 {
+		query = `DELETE FROM files WHERE id = ANY($1)
+			RETURNING COALESCE(publicId, ''), ARRAY(SELECT publicId FROM fileVariants WHERE fileId = files.id)`
+		rows, err := tx.Query(query, fileIds)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		for rows.Next() {
+			var publicId string
+			var variants pq.StringArray
+			err := rows.Scan(&publicId, &variants)
+			if err != nil {
+				rows.Close()
+				return 0, nil, err
+			}
+
+			if publicId != "" {
+				publicIds = append(publicIds, publicId)
+			}
+			publicIds = append(publicIds, variants...)
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return count, publicIds, tx.Commit()
+}
+
+// AnonymizeInactiveGuests strips the name and credentials of guests not seen since cutoff,
+// their messages and rooms stay in place
+func (r *userRepository) AnonymizeInactiveGuests(cutoff time.Time) (int64, error) {
+	query := `UPDATE users
+		SET username = 'deleted_' || id, password = '', profilePic = NULL, anonymizedAt = CURRENT_TIMESTAMP
+		WHERE isGuest AND anonymizedAt IS NULL AND lastSeenAt < $1`
+	result, err := r.db.Exec(query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	query = `DELETE FROM loginSession ls USING users u WHERE ls.userId = u.id AND u.anonymizedAt IS NOT NULL`
+	_, err = r.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
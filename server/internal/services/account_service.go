@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/mailer"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/utils/credentials"
+	"github.com/gauravst/real-time-chat/internal/utils/hashing"
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+	"github.com/gauravst/real-time-chat/internal/utils/throttle"
+)
+
+var (
+	ErrInvalidEmailToken = errors.New("invalid or expired token")
+	ErrEmailInUse        = errors.New("email already in use")
+	ErrGuestEmail        = errors.New("guest accounts can not add an email, upgrade the account first")
+)
+
+type AccountService interface {
+	GetEmail(userId int) (*models.User, error)
+	ChangeEmail(userData *models.AccessToken, email string, cfg config.Config) error
+	VerifyEmail(token string) error
+	RequestPasswordReset(email string, clientIp string, cfg config.Config) error
+	ResetPassword(data *models.ResetPasswordRequest, cfg config.Config) ([]int, []int, error)
+}
+
+type accountService struct {
+	accountRepo repositories.AccountRepository
+	mailer      mailer.Mailer
+	resets      *throttle.Limiter
+	resetIps    *throttle.Limiter
+}
+
+func NewAccountService(accountRepo repositories.AccountRepository, mailer mailer.Mailer) AccountService {
+	return &accountService{
+		accountRepo: accountRepo,
+		mailer:      mailer,
+		resets:      throttle.New(3, time.Hour),
+		resetIps:    throttle.New(20, time.Hour),
+	}
+}
+
+func (s *accountService) GetEmail(userId int) (*models.User, error) {
+	return s.accountRepo.GetEmail(userId)
+}
+
+// ChangeEmail stores the address unverified and sends a verification link to it
+func (s *accountService) ChangeEmail(userData *models.AccessToken, email string, cfg config.Config) error {
+	err := s.accountRepo.SetEmail(userData.UserId, email)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return ErrGuestEmail
+		}
+		return err
+	}
+
+	token, err := s.createEmailToken(userData.UserId, models.EmailTokenVerify, email, cfg.Auth.EmailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nopen this link to verify your email address:\n%s\n\nThe link expires in %s.\n",
+			userData.Username, clientLink(cfg, "/verify-email", token), cfg.Auth.EmailVerifyTTL),
+	})
+}
+
+func (s *accountService) VerifyEmail(token string) error {
+	err := s.accountRepo.VerifyEmail(securetoken.Hash(token))
+	if err != nil {
+		switch err.Error() {
+		case "invalid token", "email changed":
+			return ErrInvalidEmailToken
+		case "email already in use":
+			return ErrEmailInUse
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RequestPasswordReset mails a reset link to a verified address.
+// Unknown addresses are not reported so the endpoint can not be used to find accounts.
+// Requests are limited per client and address, so others can't use up the resets of an
+// address, and per client.
+func (s *accountService) RequestPasswordReset(email string, clientIp string, cfg config.Config) error {
+	key := clientIp + " " + strings.ToLower(email)
+	if !s.resetIps.Allowed(clientIp) || !s.resets.Allowed(key) {
+		return ErrTooManyAttempts
+	}
+	s.resetIps.Fail(clientIp)
+	s.resets.Fail(key)
+
+	user, err := s.accountRepo.GetUserByEmail(email)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.createEmailToken(user.Id, models.EmailTokenResetPassword, user.Email, cfg.Auth.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nopen this link to choose a new password:\n%s\n\nThe link expires in %s. If you did not ask for this, ignore this email.\n",
+			user.Username, clientLink(cfg, "/reset-password", token), cfg.Auth.PasswordResetTTL),
+	})
+	if err != nil {
+		// the caller always gets the same answer, the failure is only logged
+		slog.Error("failed to send password reset mail", slog.Int("userId", user.Id), slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password, logs the user out everywhere and revokes their personal
+// access tokens. It returns the revoked session and api token ids.
+func (s *accountService) ResetPassword(data *models.ResetPasswordRequest, cfg config.Config) ([]int, []int, error) {
+	// check the policy first so a weak password does not use up the token
+	err := credentials.ValidatePassword(data.Password, cfg.Auth.PasswordPolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashPassword, err := hashing.GenerateHashString(data.Password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionIds, apiTokenIds, err := s.accountRepo.ResetPassword(securetoken.Hash(data.Token), hashPassword)
+	if err != nil {
+		switch err.Error() {
+		case "invalid token", "email changed":
+			return nil, nil, ErrInvalidEmailToken
+		}
+		return nil, nil, err
+	}
+
+	return sessionIds, apiTokenIds, nil
+}
+
+func (s *accountService) createEmailToken(userId int, purpose string, email string, ttl time.Duration) (string, error) {
+	token, err := securetoken.Generate(32)
+	if err != nil {
+		return "", err
+	}
+
+	data := &models.EmailToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	err = s.accountRepo.CreateEmailToken(data, securetoken.Hash(token))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// clientLink builds a link to a client page carrying the token
+func clientLink(cfg config.Config, path string, token string) string {
+	return cfg.ClientUrl + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+)
+
+// scopes a personal access token can be given
+const (
+	ScopeUserRead      = "user:read"
+	ScopeRoomsRead     = "rooms:read"
+	ScopeRoomsWrite    = "rooms:write"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeFilesWrite    = "files:write"
+)
+
+var Scopes = []string{ScopeUserRead, ScopeRoomsRead, ScopeRoomsWrite, ScopeMessagesRead, ScopeMessagesWrite, ScopeFilesWrite}
+
+// ApiTokenPrefix marks personal access tokens so they can be told apart from JWTs
+// and found by secret scanners
+const ApiTokenPrefix = "stk_"
+
+var (
+	ErrInvalidApiToken = errors.New("invalid or expired api token")
+	ErrApiTokenScope   = errors.New("api token is missing the required scope")
+	ErrApiTokenRoom    = errors.New("api token is not allowed to access this room")
+)
+
+type ApiTokenService interface {
+	CreateApiToken(userId int, data *models.ApiTokenRequest) (*models.ApiToken, string, error)
+	GetAllApiTokens(userId int) ([]*models.ApiToken, error)
+	DeleteApiToken(userId int, id int) error
+	Authenticate(token string) (*models.AccessToken, error)
+}
+
+type apiTokenService struct {
+	apiTokenRepo repositories.ApiTokenRepository
+}
+
+func NewApiTokenService(apiTokenRepo repositories.ApiTokenRepository) ApiTokenService {
+	return &apiTokenService{
+		apiTokenRepo: apiTokenRepo,
+	}
+}
+
+// CreateApiToken stores a new token and returns it, the plain token is only available here
+func (s *apiTokenService) CreateApiToken(userId int, data *models.ApiTokenRequest) (*models.ApiToken, string, error) {
+	for _, scope := range data.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, "", fmt.Errorf("unknown scope %s, allowed: %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expiresAt must be in the future")
+	}
+
+	secret, err := securetoken.Generate(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := ApiTokenPrefix + secret
+
+	apiToken := &models.ApiToken{
+		UserId:    userId,
+		Name:      data.Name,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(data.Scopes))),
+		Rooms:     data.Rooms,
+		ExpiresAt: data.ExpiresAt,
+	}
+	if apiToken.Rooms == nil {
+		apiToken.Rooms = []int{}
+	}
+
+	err = s.apiTokenRepo.CreateApiToken(apiToken, securetoken.Hash(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return apiToken, token, nil
+}
+
+func (s *apiTokenService) GetAllApiTokens(userId int) ([]*models.ApiToken, error) {
+	return s.apiTokenRepo.GetAllApiTokens(userId)
+}
+
+func (s *apiTokenService) DeleteApiToken(userId int, id int) error {
+	return s.apiTokenRepo.DeleteApiToken(userId, id)
+}
+
+// Authenticate turns a personal access token into the caller of the request
+func (s *apiTokenService) Authenticate(token string) (*models.AccessToken, error) {
+	apiToken, user, err := s.apiTokenRepo.UseApiToken(securetoken.Hash(token))
+	if err != nil {
+		if err.Error() == "token not found" {
+			return nil, ErrInvalidApiToken
+		}
+		return nil, err
+	}
+
+	return &models.AccessToken{
+		UserId:     user.Id,
+		Username:   user.Username,
+		Role:       user.Role,
+		ProfilePic: user.ProfilePic,
+		ApiTokenId: apiToken.Id,
+		Scopes:     apiToken.Scopes,
+		Rooms:      apiToken.Rooms,
+	}, nil
+}
@@ -1,145 +1,161 @@
 package services
 
 import (
+	"errors"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/utils/credentials"
 	"github.com/gauravst/real-time-chat/internal/utils/hashing"
+	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
 	withoutauth "github.com/gauravst/real-time-chat/internal/utils/withoutAuth"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrRegistrationDisabled = errors.New("registration is disabled")
+	ErrUsernameTaken        = errors.New("username already taken")
+	ErrNotGuest             = errors.New("user is not a guest")
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reused, session revoked")
+	ErrInvalidChallenge     = errors.New("invalid or expired 2fa challenge")
+)
+
+// twoFactorChallengeTTL is how long a user has to enter a code after the password
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// dummyHash is compared against when the username is unknown so both cases take as long
+const dummyHash = "$2a$10$DKZBkBmuLuJSy0XFq5SoyOqJgPEiOukV7hO8H5WcLrRT1JUdTJuHK"
+
 type AuthService interface {
-	LoginUser(data *models.LoginRequest, cfg config.Config) (string, *models.User, error)
-	LoginWithoutAuth(cfg config.Config) (string, *models.User, error)
-	// RefreshToken(userId int, token string) error
-	GetRefreshToken(userId int) (string, error)
-	LogoutUser(userId int) error
+	RegisterUser(data *models.LoginRequest, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error)
+	LoginUser(data *models.LoginRequest, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error)
+	LoginWithoutAuth(session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error)
+	CreateSession(user *models.User, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, error)
+	VerifyTwoFactor(data *models.TwoFactorLoginRequest, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error)
+	UpgradeGuest(userData *models.AccessToken, data *models.LoginRequest, cfg config.Config) (string, *models.User, error)
+	RefreshToken(token string, cfg config.Config, wsServer *models.WsServer) (*models.AuthTokens, error)
+	TouchSession(userId int, sessionId int) error
+	GetAllSessions(userId int, currentSessionId int) ([]*models.LoginSession, error)
+	RevokeSession(userId int, sessionId int, actor *models.AuditActor) error
+	RevokeOtherSessions(userId int, currentSessionId int, actor *models.AuditActor) ([]int, error)
+	LogoutUser(userId int, sessionId int) error
 }
 
 type authService struct {
-	authRepo repositories.AuthRepository
+	authRepo         repositories.AuthRepository
+	twoFactorService TwoFactorService
+	auditService     AuditService
+	keys             *jwtToken.KeySet
 }
 
-func NewAuthService(authRepo repositories.AuthRepository) AuthService {
+func NewAuthService(authRepo repositories.AuthRepository, twoFactorService TwoFactorService, auditService AuditService, keys *jwtToken.KeySet) AuthService {
 	return &authService{
-		authRepo: authRepo,
+		authRepo:         authRepo,
+		twoFactorService: twoFactorService,
+		auditService:     auditService,
+		keys:             keys,
 	}
 }
 
-func (s *authService) LoginUser(data *models.LoginRequest, cfg config.Config) (string, *models.User, error) {
-	// check user exsit
-	userData, err := s.authRepo.CheckUserByUsername(data.Username)
-	var userId int
-	var returnUserData *models.User
-
-	// some err so return error
-	if err != nil && err.Error() != "user not found" {
-		return "", nil, err
+func (s *authService) RegisterUser(data *models.LoginRequest, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error) {
+	if cfg.Auth.DisableRegistration {
+		return nil, nil, ErrRegistrationDisabled
 	}
 
-	// user not found create new user
+	err := credentials.ValidateUsername(data.Username)
 	if err != nil {
-		hashedPassword, err := hashing.GenerateHashString(data.Password)
-		if err != nil {
-			return "", nil, err
-		}
-
-		data.Password = hashedPassword
-		// create new user
-		createdUserData, err := s.authRepo.CreateNewUser(data)
-		if err != nil {
-			return "", nil, err
-		}
-
-		// seting userid from newUser
-		userId = createdUserData.Id
-		returnUserData = createdUserData
+		return nil, nil, err
 	}
 
-	returnUserData = &userData
-
-	// if user exist than
-	if userData.Password != "" {
-		// check user password and data password is same or not
-		err = hashing.CompareHashString(userData.Password, data.Password)
-		if err != nil {
-			return "", nil, err
-		}
-
-		// seting userId here from userData
-		userId = userData.Id
+	err = credentials.ValidatePassword(data.Password, cfg.Auth.PasswordPolicy)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	role := userData.Role
-	if role == "" {
-		role = "USER"
+	hashedPassword, err := hashing.GenerateHashString(data.Password)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// RefreshToken
-	claims2 := jwt.MapClaims{
-		"userId":   userId,
-		"username": data.Username,
-		"role":     role,
-		"exp":      time.Now().Add(24 * 30 * time.Hour).Unix(),
-	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims2)
-	refreshTokenString, err := refreshToken.SignedString([]byte(cfg.JwtPrivateKey))
+	// create new user
+	createdUserData, err := s.authRepo.CreateNewUser(&models.LoginRequest{
+		Username: data.Username,
+		Password: hashedPassword,
+	}, false)
 	if err != nil {
-		return "", returnUserData, err
+		if err.Error() == "username already taken" {
+			return nil, nil, ErrUsernameTaken
+		}
+		return nil, nil, err
 	}
 
-	// remove all login here first
-	err = s.authRepo.RemoveOtherLogin(userId)
+	tokens, err := s.createLoginSession(createdUserData, session, cfg)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	var loginData models.LoginSession
-	loginData.Token = refreshTokenString
-	loginData.UserId = userId
+	return tokens, createdUserData, nil
+}
 
-	// user exist create login
-	err = s.authRepo.LoginUser(&loginData)
+func (s *authService) LoginUser(data *models.LoginRequest, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error) {
+	// check user exsit
+	userData, err := s.authRepo.CheckUserByUsername(data.Username)
 	if err != nil {
-		return "", nil, err
+		if err.Error() != "user not found" {
+			return nil, nil, err
+		}
+
+		hashing.CompareHashString(dummyHash, data.Password)
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	// new accessToken for new user and login user
-	claims1 := jwt.MapClaims{
-		"userId":   userId,
-		"username": data.Username,
-		"role":     role,
-		"exp":      time.Now().Add(30 * time.Minute).Unix(),
+	// check user password and data password is same or not
+	err = hashing.CompareHashString(userData.Password, data.Password)
+	if err != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	userData.Password = ""
+	if userData.Role == "" {
+		userData.Role = "USER"
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims1)
-	accessTokenString, err := accessToken.SignedString([]byte(cfg.JwtPrivateKey))
+
+	tokens, err := s.startSession(&userData, session, cfg)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	return accessTokenString, returnUserData, nil
+	return tokens, &userData, nil
 }
 
-func (s *authService) LoginWithoutAuth(cfg config.Config) (string, *models.User, error) {
+func (s *authService) LoginWithoutAuth(session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error) {
+	if cfg.Auth.DisableRegistration {
+		return nil, nil, ErrRegistrationDisabled
+	}
+
 	// create new username
-	var returnUserData *models.User
 	username, err := withoutauth.GenerateUsername("user_", 6)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	// create new password and hash
 	password, err := withoutauth.GeneratePassword(12)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	hashedPassword, err := hashing.GenerateHashString(password)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	// create user here
@@ -147,65 +163,284 @@ func (s *authService) LoginWithoutAuth(cfg config.Config) (string, *models.User,
 		Username: username,
 		Password: hashedPassword,
 	}
-	createdUserData, err := s.authRepo.CreateNewUser(data)
+	createdUserData, err := s.authRepo.CreateNewUser(data, true)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	// create accessToken & refreshToken here
-	claims2 := jwt.MapClaims{
-		"userId":   createdUserData.Id,
-		"username": createdUserData.Username,
-		"role":     createdUserData.Role,
-		"exp":      time.Now().Add(24 * 30 * time.Hour).Unix(),
+	// create a login here with user info
+	tokens, err := s.createLoginSession(createdUserData, session, cfg)
+	if err != nil {
+		return nil, nil, err
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims2)
-	refreshTokenString, err := refreshToken.SignedString([]byte(cfg.JwtPrivateKey))
+
+	// send back tokens
+	return tokens, createdUserData, nil
+}
+
+// UpgradeGuest sets a real username and password on a guest account, the user id and
+// everything attached to it stay the same. It returns a new access token with the new username.
+func (s *authService) UpgradeGuest(userData *models.AccessToken, data *models.LoginRequest, cfg config.Config) (string, *models.User, error) {
+	err := credentials.ValidateUsername(data.Username)
 	if err != nil {
 		return "", nil, err
 	}
 
-	returnUserData = createdUserData
-	claims1 := jwt.MapClaims{
-		"userId":   createdUserData.Id,
-		"username": createdUserData.Username,
-		"role":     createdUserData.Role,
-		"exp":      time.Now().Add(30 * time.Minute).Unix(),
+	err = credentials.ValidatePassword(data.Password, cfg.Auth.PasswordPolicy)
+	if err != nil {
+		return "", nil, err
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims1)
-	accessTokenString, err := accessToken.SignedString([]byte(cfg.JwtPrivateKey))
+
+	hashedPassword, err := hashing.GenerateHashString(data.Password)
 	if err != nil {
 		return "", nil, err
 	}
 
-	// create a login here with user info
-	var loginData models.LoginSession
-	loginData.Token = refreshTokenString
-	loginData.UserId = createdUserData.Id
+	user, err := s.authRepo.UpgradeGuest(userData.UserId, data.Username, hashedPassword)
+	if err != nil {
+		switch err.Error() {
+		case "username already taken":
+			return "", nil, ErrUsernameTaken
+		case "user is not a guest":
+			return "", nil, ErrNotGuest
+		}
+		return "", nil, err
+	}
 
-	err = s.authRepo.LoginUser(&loginData)
+	accessToken, err := s.createAccessToken(user.Id, user.Username, user.Role, userData.SessionId, userData.Mfa, cfg)
 	if err != nil {
 		return "", nil, err
 	}
 
-	// send back accessToken
-	return accessTokenString, returnUserData, nil
+	return accessToken, user, nil
+}
+
+// CreateSession logs in a user that was authenticated elsewhere, e.g. by an identity provider
+func (s *authService) CreateSession(user *models.User, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, error) {
+	return s.startSession(user, session, cfg)
+}
+
+// startSession logs the user in, or returns a challenge when the user has two-factor authentication enabled
+func (s *authService) startSession(user *models.User, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, error) {
+	enabled, err := s.twoFactorService.IsEnabled(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		return s.createLoginSession(user, session, cfg)
+	}
+
+	claims := jwt.MapClaims{
+		"purpose": "2fa",
+		"userId":  user.Id,
+		"exp":     time.Now().Add(twoFactorChallengeTTL).Unix(),
+	}
+	challengeString, err := jwtToken.CreateNewToken(claims, jwtToken.AudienceTwoFactor, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthTokens{Challenge: challengeString}, nil
+}
+
+// VerifyTwoFactor finishes a login that returned a challenge
+func (s *authService) VerifyTwoFactor(data *models.TwoFactorLoginRequest, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error) {
+	challenge, err := jwtToken.VerifyJwtAndGetData[models.TwoFactorChallenge](data.Challenge, jwtToken.AudienceTwoFactor, s.keys)
+	if err != nil || challenge.Purpose != "2fa" {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	err = s.twoFactorService.VerifyCode(challenge.UserId, data.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.authRepo.GetUserById(challenge.UserId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session.Mfa = true
+	tokens, err := s.createLoginSession(user, session, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// createLoginSession stores a new session for the user and issues the first token pair of it
+func (s *authService) createLoginSession(user *models.User, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, error) {
+	session.UserId = user.Id
+	err := s.authRepo.LoginUser(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user.Id, user.Username, user.Role, session.Id, session.Mfa, cfg)
 }
 
-// func (s *authService) RefreshToken(userId int, token string) error {
-// }
+// issueTokens creates an access token bound to the session and a new opaque refresh token for it
+func (s *authService) issueTokens(userId int, username string, role string, sessionId int, mfa bool, cfg config.Config) (*models.AuthTokens, error) {
+	refreshToken, err := securetoken.Generate(32)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *authService) GetRefreshToken(userId int) (string, error) {
-	token, err := s.authRepo.GetRefreshToken(userId)
+	refreshExpiresAt := time.Now().Add(cfg.Auth.RefreshTokenTTL)
+	err = s.authRepo.CreateRefreshToken(sessionId, securetoken.Hash(refreshToken), refreshExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenString, err := s.createAccessToken(userId, username, role, sessionId, mfa, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthTokens{
+		AccessToken:      accessTokenString,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// createAccessToken signs an access token bound to the session so revoking it logs the device out
+func (s *authService) createAccessToken(userId int, username string, role string, sessionId int, mfa bool, cfg config.Config) (string, error) {
+	claims := jwt.MapClaims{
+		"userId":    userId,
+		"username":  username,
+		"role":      role,
+		"sessionId": sessionId,
+		"mfa":       mfa,
+		"exp":       time.Now().Add(cfg.Auth.AccessTokenTTL).Unix(),
+	}
+	accessTokenString, err := jwtToken.CreateNewToken(claims, cfg.JWT.Audience, s.keys)
 	if err != nil {
 		return "", err
 	}
 
-	return token, nil
+	return accessTokenString, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Presenting a token
+// that was already rotated revokes the whole session, since it was likely stolen.
+// The token is only rotated once the new pair is ready, so a failure leaves it usable.
+func (s *authService) RefreshToken(token string, cfg config.Config, wsServer *models.WsServer) (*models.AuthTokens, error) {
+	data, err := s.authRepo.GetRefreshToken(securetoken.Hash(token))
+	if err != nil {
+		if err.Error() == "refresh token not found" {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if data.RotatedAt != nil {
+		return nil, s.revokeReusedSession(data, cfg, wsServer)
+	}
+
+	if time.Now().After(data.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	err = s.authRepo.TouchSession(data.UserId, data.SessionId)
+	if err != nil {
+		if err.Error() == "session not found" {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	refreshToken, err := securetoken.Generate(32)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenString, err := s.createAccessToken(data.UserId, data.Username, data.Role, data.SessionId, data.Mfa, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// a concurrent request may have rotated the token in the meantime
+	refreshExpiresAt := time.Now().Add(cfg.Auth.RefreshTokenTTL)
+	err = s.authRepo.RotateRefreshToken(data.Id, data.SessionId, securetoken.Hash(refreshToken), refreshExpiresAt)
+	if err != nil {
+		if err.Error() == "refresh token already used" {
+			return nil, s.revokeReusedSession(data, cfg, wsServer)
+		}
+		return nil, err
+	}
+
+	return &models.AuthTokens{
+		AccessToken:      accessTokenString,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+func (s *authService) revokeReusedSession(data *models.RefreshToken, cfg config.Config, wsServer *models.WsServer) error {
+	slog.Warn("refresh token reuse detected", slog.Int("userId", data.UserId), slog.Int("sessionId", data.SessionId))
+
+	err := s.authRepo.RemoveSession(data.UserId, data.SessionId)
+	if err != nil && err.Error() != "session not found" {
+		return err
+	}
+
+	ws.CloseSessions(wsServer, []int{data.SessionId}, cfg.WebSocket.WriteWait)
+	s.auditService.Record(nil, AuditRefreshTokenReuse, "session", strconv.Itoa(data.SessionId), nil, map[string]interface{}{
+		"userId":   data.UserId,
+		"username": data.Username,
+	})
+	return ErrRefreshTokenReused
+}
+
+func (s *authService) TouchSession(userId int, sessionId int) error {
+	err := s.authRepo.TouchSession(userId, sessionId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *authService) GetAllSessions(userId int, currentSessionId int) ([]*models.LoginSession, error) {
+	data, err := s.authRepo.GetAllSessions(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range data {
+		session.Current = session.Id == currentSessionId
+	}
+
+	return data, nil
+}
+
+func (s *authService) RevokeSession(userId int, sessionId int, actor *models.AuditActor) error {
+	err := s.authRepo.RemoveSession(userId, sessionId)
+	if err != nil {
+		return err
+	}
+
+	s.auditService.Record(actor, AuditSessionRevoke, "session", strconv.Itoa(sessionId), nil, nil)
+	return nil
+}
+
+func (s *authService) RevokeOtherSessions(userId int, currentSessionId int, actor *models.AuditActor) ([]int, error) {
+	ids, err := s.authRepo.RemoveOtherLogin(userId, currentSessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(actor, AuditSessionRevokeOther, "user", strconv.Itoa(userId), nil, map[string]interface{}{
+		"revokedSessionIds": ids,
+	})
+	return ids, nil
 }
 
-func (s *authService) LogoutUser(userId int) error {
-	err := s.authRepo.LogoutUser(userId)
+func (s *authService) LogoutUser(userId int, sessionId int) error {
+	err := s.authRepo.RemoveSession(userId, sessionId)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+)
+
+var (
+	ErrBlockSelf = errors.New("you can not block yourself")
+	ErrBlocked   = errors.New("one of the users has blocked the other")
+)
+
+type BlockService interface {
+	BlockUser(userId int, blockedId int) error
+	UnblockUser(userId int, blockedId int) error
+	GetAllBlocks(userId int) ([]*models.Block, error)
+	GetBlockedBy(userId int) (map[int]bool, error)
+	CheckNotBlocked(userId int, otherId int) error
+}
+
+type blockService struct {
+	blockRepo repositories.BlockRepository
+}
+
+func NewBlockService(blockRepo repositories.BlockRepository) BlockService {
+	return &blockService{
+		blockRepo: blockRepo,
+	}
+}
+
+func (s *blockService) BlockUser(userId int, blockedId int) error {
+	if userId == blockedId {
+		return ErrBlockSelf
+	}
+
+	return s.blockRepo.CreateBlock(userId, blockedId)
+}
+
+func (s *blockService) UnblockUser(userId int, blockedId int) error {
+	return s.blockRepo.DeleteBlock(userId, blockedId)
+}
+
+func (s *blockService) GetAllBlocks(userId int) ([]*models.Block, error) {
+	return s.blockRepo.GetAllBlocks(userId)
+}
+
+// GetBlockedBy returns the users who should not see what userId sends
+func (s *blockService) GetBlockedBy(userId int) (map[int]bool, error) {
+	ids, err := s.blockRepo.GetBlockerIds(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedBy := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		blockedBy[id] = true
+	}
+	return blockedBy, nil
+}
+
+// CheckNotBlocked returns ErrBlocked when either user blocked the other, used before
+// one user can reach the other directly
+func (s *blockService) CheckNotBlocked(userId int, otherId int) error {
+	blocked, err := s.blockRepo.IsBlocked(userId, otherId)
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
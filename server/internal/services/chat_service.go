@@ -1,43 +1,93 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
 	randomstring "github.com/gauravst/real-time-chat/internal/utils/randomString"
+	"github.com/gauravst/real-time-chat/internal/utils/slug"
+)
+
+const (
+	// roomCodeLength is the length of the permanent code of a private room
+	roomCodeLength = 12
+	// slugSuffixLength is appended to a generated slug that is already taken
+	slugSuffixLength = 6
+	// maxRoomTags and maxTagLength keep tags usable as categories
+	maxRoomTags  = 10
+	maxTagLength = 32
+)
+
+// sort orders of the room listing
+const (
+	RoomSortMembers  = "members"
+	RoomSortActivity = "activity"
+	RoomSortCreated  = "created"
+)
+
+var (
+	ErrPrivateRoom    = errors.New("this room is private, you need an invite to join")
+	ErrRoomArchived   = errors.New("this room is archived and read-only")
+	ErrRestoreExpired = errors.New("the room was deleted too long ago to be restored")
+	ErrNotRoomMember  = errors.New("you are not a member of this room")
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrInvalidSlug    = errors.New("slug may only contain lowercase letters, digits and single dashes")
+	ErrSlugTaken      = errors.New("this slug is already used by another room")
+	ErrInvalidTags    = fmt.Errorf("a room can have up to %d tags of at most %d letters or digits", maxRoomTags, maxTagLength)
+	ErrInvalidCursor  = errors.New("invalid cursor")
 )
 
 type ChatService interface {
-	GetAllChatRoom(userData *models.AccessToken) ([]*models.ChatRoom, error)
-	GetPrivateChatRoom(code string) (*models.ChatRoom, error)
-	GetChatRoomByName(name string) (*models.ChatRoom, error)
-	UpdateChatRoom(data *models.ChatRoomRequest) error
-	DeleteChatRoom(name string) error
+	GetAllChatRoom(userData *models.AccessToken, filter *models.RoomFilter) ([]*models.ChatRoom, error)
+	GetChatRoomBySlug(slug string) (*models.ChatRoom, error)
+	UpdateChatRoom(data *models.ChatRoomRequest, actor *models.AuditActor) error
+	DeleteChatRoom(id int, actor *models.AuditActor) error
 	CreateNewChatRoom(data *models.ChatRoomRequest) error
-	CheckChatRoomMember(userId int, roomName string) (bool, error)
-	GetOldMessages(roomName string, limit int) ([]*models.MessageResponse, error)
-	CreateNewMessage(data *models.MessageResponse, roomName string) (*models.MessageResponse, error)
-	JoinRoom(data *models.JoinRoomRequest) error
-	JoinPrivateRoom(code string, userData *models.AccessToken) error
+	CheckChatRoomMember(userId int, roomId int) (bool, error)
+	GetOldMessages(roomId int, limit int, viewerId int) ([]*models.MessageResponse, error)
+	CreateNewMessage(data *models.MessageResponse, roomId int) (*models.MessageResponse, error)
+	JoinRoom(data *models.JoinRoomRequest, wsServer *models.WsServer) (*models.JoinRequest, error)
 	GetAllJoinRoom(userId int) ([]*models.ChatRoom, error)
-	LeaveRoom(userId int, roomName string) error
+	LeaveRoom(userId int, roomId int) error
+	ArchiveChatRoom(id int, archived bool, actor *models.AuditActor) error
+	GetDeletedChatRoom(slug string) (*models.ChatRoom, error)
+	RestoreChatRoom(id int, restoreWindow time.Duration, actor *models.AuditActor) error
+	PurgeDeletedRooms(restoreWindow time.Duration) (int, error)
 }
 
 type chatService struct {
-	chatRepo repositories.ChatRepository
+	chatRepo        repositories.ChatRepository
+	joinRequestRepo repositories.JoinRequestRepository
+	auditService    AuditService
+	storage         storage.Storage
 }
 
-func NewChatService(chatRepo repositories.ChatRepository) ChatService {
+func NewChatService(chatRepo repositories.ChatRepository, joinRequestRepo repositories.JoinRequestRepository, auditService AuditService, storage storage.Storage) ChatService {
 	return &chatService{
-		chatRepo: chatRepo,
+		chatRepo:        chatRepo,
+		joinRequestRepo: joinRequestRepo,
+		auditService:    auditService,
+		storage:         storage,
 	}
 }
 
-func (s *chatService) GetAllChatRoom(userData *models.AccessToken) ([]*models.ChatRoom, error) {
+func (s *chatService) GetAllChatRoom(userData *models.AccessToken, filter *models.RoomFilter) ([]*models.ChatRoom, error) {
+	if filter.Tag != "" {
+		filter.Tag = slug.Make(filter.Tag)
+	}
+
 	var data []*models.ChatRoom
-	data, err := s.chatRepo.GetAllChatRoom(userData)
+	data, err := s.chatRepo.GetAllChatRoom(userData, filter)
 	if err != nil {
 		return data, err
 	}
@@ -45,53 +95,248 @@ func (s *chatService) GetAllChatRoom(userData *models.AccessToken) ([]*models.Ch
 	return data, nil
 }
 
-func (s *chatService) GetPrivateChatRoom(code string) (*models.ChatRoom, error) {
-	var data *models.ChatRoom
-	data, err := s.chatRepo.GetPrivateChatRoom(code)
+// RoomCursor is the cursor of the page that follows room when listing by sort
+func RoomCursor(sort string, room *models.ChatRoom) string {
+	value := int64(room.Members)
+	switch sort {
+	case RoomSortActivity:
+		value = room.LastActivityAt.UnixMicro()
+	case RoomSortCreated:
+		value = room.CreatedAt.UnixMicro()
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", value, room.Id)))
+}
+
+// ParseRoomCursor reads a cursor made by RoomCursor into filter
+func ParseRoomCursor(cursor string, filter *models.RoomFilter) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return data, err
+		return ErrInvalidCursor
 	}
 
+	value, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+
+	filter.AfterValue, err = strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	filter.AfterId, err = strconv.Atoi(id)
+	if err != nil || filter.AfterId < 1 {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+// normalizeTags turns tags into unique slugs
+func normalizeTags(tags []string) ([]string, error) {
+	data := []string{}
+	for _, tag := range tags {
+		tag = slug.Make(tag)
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, ErrInvalidTags
+		}
+
+		if !slices.Contains(data, tag) {
+			data = append(data, tag)
+		}
+	}
+
+	if len(data) > maxRoomTags {
+		return nil, ErrInvalidTags
+	}
 	return data, nil
 }
 
-func (s *chatService) GetChatRoomByName(name string) (*models.ChatRoom, error) {
-	var data *models.ChatRoom
-	data, err := s.chatRepo.GetChatRoomByName(name)
+// GetChatRoomBySlug finds a room by its slug, old slugs of renamed rooms still work
+func (s *chatService) GetChatRoomBySlug(slug string) (*models.ChatRoom, error) {
+	data, err := s.chatRepo.GetChatRoomBySlug(slug)
 	if err != nil {
-		return data, err
+		if err.Error() == "room not found" {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
 	}
 
 	return data, nil
 }
 
-func (s *chatService) UpdateChatRoom(data *models.ChatRoomRequest) error {
-	err := s.chatRepo.UpdateChatRoom(data)
+// UpdateChatRoom saves the room data.Id. The room keeps its slug unless data.Slug asks for a
+// new one, the old slug then redirects to the room.
+func (s *chatService) UpdateChatRoom(data *models.ChatRoomRequest, actor *models.AuditActor) error {
+	before, err := s.chatRepo.GetChatRoomById(data.Id)
+	if err != nil {
+		return err
+	}
+
+	if data.Slug == "" {
+		data.Slug = before.Slug
+	}
+
+	if data.Slug != before.Slug {
+		err = s.checkSlug(data.Slug, before.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if data.Tags == nil {
+		data.Tags = before.Tags
+	}
+
+	data.Tags, err = normalizeTags(data.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = s.chatRepo.UpdateChatRoom(data, before.Slug)
+	if err != nil {
+		return err
+	}
+
+	err = s.chatRepo.SetRoomTags(data.Id, data.Tags)
+	if err != nil {
+		return err
+	}
+
+	after := &models.ChatRoom{Id: data.Id, Name: data.Name, Slug: data.Slug, Private: before.Private, Description: data.Description, Tags: data.Tags, UserId: data.UserId, RequestToJoin: data.RequestToJoin}
+	s.auditService.Record(actor, AuditRoomUpdate, "room", strconv.Itoa(before.Id), roomSnapshot(before), roomSnapshot(after))
+	return nil
+}
+
+// DeleteChatRoom hides the room, it can be restored until the purge job removes it
+func (s *chatService) DeleteChatRoom(id int, actor *models.AuditActor) error {
+	before, err := s.chatRepo.GetChatRoomById(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.chatRepo.DeleteChatRoom(id)
 	if err != nil {
 		return err
 	}
+
+	s.auditService.Record(actor, AuditRoomDelete, "room", strconv.Itoa(id), roomSnapshot(before), nil)
 	return nil
 }
 
-func (s *chatService) DeleteChatRoom(name string) error {
-	err := s.chatRepo.DeleteChatRoom(name)
+// ArchiveChatRoom makes a room read-only and hides it from discovery, or undoes that
+func (s *chatService) ArchiveChatRoom(id int, archived bool, actor *models.AuditActor) error {
+	err := s.chatRepo.ArchiveChatRoom(id, archived)
 	if err != nil {
 		return err
 	}
+
+	action := AuditRoomArchive
+	if !archived {
+		action = AuditRoomUnarchive
+	}
+	s.auditService.Record(actor, action, "room", strconv.Itoa(id), nil, nil)
 	return nil
 }
 
+func (s *chatService) GetDeletedChatRoom(slug string) (*models.ChatRoom, error) {
+	return s.chatRepo.GetDeletedChatRoom(slug)
+}
+
+func (s *chatService) RestoreChatRoom(id int, restoreWindow time.Duration, actor *models.AuditActor) error {
+	err := s.chatRepo.RestoreChatRoom(id, time.Now().Add(-restoreWindow))
+	if err != nil {
+		if err.Error() == "room not found" {
+			return ErrRestoreExpired
+		}
+		return err
+	}
+
+	s.auditService.Record(actor, AuditRoomRestore, "room", strconv.Itoa(id), nil, nil)
+	return nil
+}
+
+// PurgeDeletedRooms removes rooms deleted longer than restoreWindow ago for good
+func (s *chatService) PurgeDeletedRooms(restoreWindow time.Duration) (int, error) {
+	ids, err := s.chatRepo.GetPurgeableChatRooms(time.Now().Add(-restoreWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		publicIds, err := s.chatRepo.PurgeChatRoom(id)
+		if err != nil {
+			return count, err
+		}
+
+		// the rows are gone, a file left in storage is only an orphan
+		for _, publicId := range publicIds {
+			err := s.storage.Delete(context.Background(), publicId)
+			if err != nil {
+				slog.Warn("failed to delete file of purged room", slog.String("publicId", publicId), slog.String("error", err.Error()))
+			}
+		}
+
+		s.auditService.Record(nil, AuditRoomPurge, "room", strconv.Itoa(id), nil, map[string]interface{}{"files": len(publicIds)})
+		count++
+	}
+
+	return count, nil
+}
+
+// roomSnapshot keeps the audited fields of a room, the invite code is left out
+func roomSnapshot(room *models.ChatRoom) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            room.Id,
+		"name":          room.Name,
+		"slug":          room.Slug,
+		"private":       room.Private,
+		"description":   room.Description,
+		"tags":          room.Tags,
+		"userId":        room.UserId,
+		"requestToJoin": room.RequestToJoin,
+	}
+}
+
+// CreateNewChatRoom creates the room with the slug asked for, or one made from its name
 func (s *chatService) CreateNewChatRoom(data *models.ChatRoomRequest) error {
-	code := randomstring.GenerateRandomString(5)
+	var err error
+	if data.Slug != "" {
+		err = s.checkSlug(data.Slug, 0)
+	} else {
+		data.Slug, err = s.newSlug(data.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	data.Tags, err = normalizeTags(data.Tags)
+	if err != nil {
+		return err
+	}
+
+	code, err := randomstring.GenerateRandomString(roomCodeLength)
+	if err != nil {
+		return err
+	}
+
 	data.Code = code
-	err := s.chatRepo.CreateNewChatRoom(data)
+	err = s.chatRepo.CreateNewChatRoom(data)
+	if err != nil {
+		return err
+	}
+
+	err = s.chatRepo.SetRoomTags(data.Id, data.Tags)
 	if err != nil {
 		return err
 	}
 
 	joinRoomData := &models.JoinRoomRequest{
-		UserId:   data.UserId,
-		RoomName: data.Name,
+		UserId: data.UserId,
+		RoomId: data.Id,
+		Role:   RoomRoleOwner,
 	}
 	err = s.chatRepo.JoinRoom(joinRoomData)
 	if err != nil {
@@ -101,26 +346,75 @@ func (s *chatService) CreateNewChatRoom(data *models.ChatRoomRequest) error {
 	return nil
 }
 
-func (s *chatService) CheckChatRoomMember(userId int, roomName string) (bool, error) {
+// checkSlug makes sure slug is well formed and not used by a room other than roomId
+func (s *chatService) checkSlug(value string, roomId int) error {
+	if !slug.Valid(value) {
+		return ErrInvalidSlug
+	}
+
+	taken, err := s.chatRepo.SlugTaken(value, roomId)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrSlugTaken
+	}
+	return nil
+}
+
+// newSlug makes a free slug from a room name, a random suffix is added when it is taken
+func (s *chatService) newSlug(name string) (string, error) {
+	base := slug.Make(name)
+	if base == "" {
+		base = "room"
+	}
+
+	candidate := base
+	for {
+		taken, err := s.chatRepo.SlugTaken(candidate, 0)
+		if err != nil {
+			return "", err
+		}
+
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix, err := randomstring.GenerateRandomString(slugSuffixLength)
+		if err != nil {
+			return "", err
+		}
+
+		candidate = slug.Make(base[:min(len(base), slug.MaxLength-slugSuffixLength-1)] + "-" + strings.ToLower(suffix))
+	}
+}
+
+func (s *chatService) CheckChatRoomMember(userId int, roomId int) (bool, error) {
 	var exists bool
-	exists, err := s.chatRepo.CheckChatRoomMember(userId, roomName)
+	exists, err := s.chatRepo.CheckChatRoomMember(userId, roomId)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-func (s *chatService) GetOldMessages(roomName string, limit int) ([]*models.MessageResponse, error) {
+// GetOldMessages returns the latest messages of a room, leaving out authors viewerId has blocked
+func (s *chatService) GetOldMessages(roomId int, limit int, viewerId int) ([]*models.MessageResponse, error) {
 	var data []*models.MessageResponse
-	data, err := s.chatRepo.GetOldMessages(roomName, limit)
+	data, err := s.chatRepo.GetOldMessages(roomId, limit, viewerId)
 	if err != nil {
 		return nil, err
 	}
+
+	for _, msg := range data {
+		msg.Author.AvatarUrl = avatarUrl(msg.Author.AvatarUrl, msg.UserId)
+	}
 	return data, nil
 }
 
-func (s *chatService) CreateNewMessage(data *models.MessageResponse, roomName string) (*models.MessageResponse, error) {
-	messageData, err := s.chatRepo.CreateNewMessage(data, roomName)
+func (s *chatService) CreateNewMessage(data *models.MessageResponse, roomId int) (*models.MessageResponse, error) {
+	messageData, err := s.chatRepo.CreateNewMessage(data, roomId)
 	if err != nil {
 		return nil, err
 	}
@@ -129,41 +423,40 @@ func (s *chatService) CreateNewMessage(data *models.MessageResponse, roomName st
 	return messageData, nil
 }
 
-func (s *chatService) JoinRoom(data *models.JoinRoomRequest) error {
-	err := s.chatRepo.JoinRoom(data)
+// JoinRoom adds a user to a public room. Private rooms need an invite, unless they take
+// join requests, then a pending request is returned instead and the room managers are told.
+func (s *chatService) JoinRoom(data *models.JoinRoomRequest, wsServer *models.WsServer) (*models.JoinRequest, error) {
+	room, err := s.chatRepo.GetChatRoomById(data.RoomId)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
-}
 
-func (s *chatService) JoinPrivateRoom(code string, userData *models.AccessToken) error {
-	//check private room using room code
-	roomData, err := s.chatRepo.GetPrivateChatRoom(code)
-	if err != nil {
-		slog.Error(err.Error())
-		return err
+	if room.ArchivedAt != nil {
+		return nil, ErrRoomArchived
 	}
 
-	member, err := s.chatRepo.CheckChatRoomMember(userData.UserId, roomData.Name)
-	if err != nil {
-		return err
-	}
+	if room.Private && room.RequestToJoin {
+		request, err := s.joinRequestRepo.CreateJoinRequest(room.Id, data.UserId)
+		if err != nil {
+			if err.Error() == "request already pending" {
+				return nil, ErrJoinRequestPending
+			}
+			return nil, err
+		}
 
-	if member {
-		return fmt.Errorf("You are already member of this room")
+		notifyRoomManagers(s.joinRequestRepo, wsServer, request)
+		return request, nil
 	}
 
-	data := &models.JoinRoomRequest{
-		UserId:   userData.UserId,
-		RoomName: roomData.Name,
+	if room.Private {
+		return nil, ErrPrivateRoom
 	}
 
 	err = s.chatRepo.JoinRoom(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return nil, nil
 }
 
 func (s *chatService) GetAllJoinRoom(userId int) ([]*models.ChatRoom, error) {
@@ -175,8 +468,8 @@ func (s *chatService) GetAllJoinRoom(userId int) ([]*models.ChatRoom, error) {
 	return data, nil
 }
 
-func (s *chatService) LeaveRoom(userId int, roomName string) error {
-	roomData, err := s.chatRepo.GetChatRoomByName(roomName)
+func (s *chatService) LeaveRoom(userId int, roomId int) error {
+	roomData, err := s.chatRepo.GetChatRoomById(roomId)
 	if err != nil {
 		return err
 	}
@@ -185,7 +478,7 @@ func (s *chatService) LeaveRoom(userId int, roomName string) error {
 		return fmt.Errorf("you can not leave from you room")
 	}
 
-	err = s.chatRepo.LeaveRoom(userId, roomName)
+	err = s.chatRepo.LeaveRoom(userId, roomId)
 	if err != nil {
 		return err
 	}
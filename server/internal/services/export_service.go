@@ -0,0 +1,326 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
+	"github.com/gauravst/real-time-chat/internal/utils/transcript"
+)
+
+// export formats
+const (
+	ExportJSONL = "jsonl"
+	ExportCSV   = "csv"
+	ExportZip   = "zip"
+)
+
+// states of a background export
+const (
+	ExportPending = "PENDING"
+	ExportRunning = "RUNNING"
+	ExportDone    = "DONE"
+	ExportFailed  = "FAILED"
+)
+
+var (
+	ErrExportNotFound   = errors.New("export not found")
+	ErrExportNotReady   = errors.New("export is not finished")
+	ErrExportRange      = errors.New("from must be before to")
+	ErrExportStreamOnly = errors.New("zip exports run in the background, create one with POST")
+)
+
+// ExportContentTypes are the content types of the export formats
+var ExportContentTypes = map[string]string{
+	ExportJSONL: "application/x-ndjson",
+	ExportCSV:   "text/csv; charset=utf-8",
+	ExportZip:   "application/zip",
+}
+
+type ExportService interface {
+	StreamExport(ctx context.Context, room *models.ChatRoom, data *models.ExportRequest, w io.Writer, actor *models.AuditActor) error
+	CreateExport(room *models.ChatRoom, data *models.ExportRequest, actor *models.AuditActor) (*models.RoomExport, error)
+	GetExport(roomId int, id int) (*models.RoomExport, error)
+	RunPendingExports(ctx context.Context, cfg config.Exports) (int, error)
+	DeleteExpiredExports(cfg config.Exports) (int, error)
+}
+
+type exportService struct {
+	exportRepo   repositories.ExportRepository
+	chatRepo     repositories.ChatRepository
+	auditService AuditService
+	storage      storage.Storage
+}
+
+func NewExportService(exportRepo repositories.ExportRepository, chatRepo repositories.ChatRepository, auditService AuditService, storage storage.Storage) ExportService {
+	return &exportService{
+		exportRepo:   exportRepo,
+		chatRepo:     chatRepo,
+		auditService: auditService,
+		storage:      storage,
+	}
+}
+
+// StreamExport writes a JSON Lines or CSV export of the room straight to w
+func (s *exportService) StreamExport(ctx context.Context, room *models.ChatRoom, data *models.ExportRequest, w io.Writer, actor *models.AuditActor) error {
+	if data.Format == ExportZip {
+		return ErrExportStreamOnly
+	}
+
+	if data.From != nil && data.To != nil && !data.From.Before(*data.To) {
+		return ErrExportRange
+	}
+
+	s.auditService.Record(actor, AuditRoomExport, "room", strconv.Itoa(room.Id), nil, exportSnapshot(data))
+	return s.writeExport(ctx, room, data.Format, data.From, data.To, w)
+}
+
+// CreateExport queues an export, RunPendingExports writes it
+func (s *exportService) CreateExport(room *models.ChatRoom, data *models.ExportRequest, actor *models.AuditActor) (*models.RoomExport, error) {
+	if data.From != nil && data.To != nil && !data.From.Before(*data.To) {
+		return nil, ErrExportRange
+	}
+
+	export := &models.RoomExport{
+		RoomId:      room.Id,
+		RequestedBy: &actor.UserId,
+		Format:      data.Format,
+		From:        data.From,
+		To:          data.To,
+	}
+	err := s.exportRepo.CreateExport(export)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(actor, AuditRoomExport, "room", strconv.Itoa(room.Id), nil, exportSnapshot(data))
+	return export, nil
+}
+
+func (s *exportService) GetExport(roomId int, id int) (*models.RoomExport, error) {
+	export, err := s.exportRepo.GetExport(roomId, id)
+	if err != nil {
+		if err.Error() == "export not found" {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// RunPendingExports writes queued exports to cfg.Dir one after another until none are left
+func (s *exportService) RunPendingExports(ctx context.Context, cfg config.Exports) (int, error) {
+	err := os.MkdirAll(cfg.Dir, 0o700)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export dir: %w", err)
+	}
+
+	count := 0
+	for ctx.Err() == nil {
+		export, err := s.exportRepo.ClaimExport(time.Now().Add(-cfg.Timeout))
+		if err != nil {
+			return count, err
+		}
+
+		if export == nil {
+			break
+		}
+
+		s.runExport(ctx, cfg, export)
+		count++
+	}
+
+	return count, nil
+}
+
+// runExport writes one export and records whether it worked
+func (s *exportService) runExport(parent context.Context, cfg config.Exports, export *models.RoomExport) {
+	ctx, cancel := context.WithTimeout(parent, cfg.Timeout)
+	defer cancel()
+
+	path := filepath.Join(cfg.Dir, fmt.Sprintf("export-%d.%s", export.Id, export.Format))
+	size, err := s.writeExportFile(ctx, export, path)
+	if err != nil {
+		os.Remove(path)
+
+		// the server is stopping, the export is claimed again once it is stale
+		if parent.Err() != nil {
+			return
+		}
+
+		slog.Error("export failed", slog.Int("exportId", export.Id), slog.String("error", err.Error()))
+
+		err = s.exportRepo.FinishExport(export.Id, ExportFailed, "", 0, err.Error())
+		if err != nil {
+			slog.Error("failed to save export state", slog.Int("exportId", export.Id), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	err = s.exportRepo.FinishExport(export.Id, ExportDone, path, size, "")
+	if err != nil {
+		slog.Error("failed to save export state", slog.Int("exportId", export.Id), slog.String("error", err.Error()))
+	}
+}
+
+func (s *exportService) writeExportFile(ctx context.Context, export *models.RoomExport, path string) (int64, error) {
+	room, err := s.chatRepo.GetChatRoomById(export.RoomId)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if export.Format == ExportZip {
+		err = s.writeZip(ctx, room, export.From, export.To, file)
+	} else {
+		err = s.writeExport(ctx, room, export.Format, export.From, export.To, file)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), file.Close()
+}
+
+// writeExport streams the messages of the room in a single file format
+func (s *exportService) writeExport(ctx context.Context, room *models.ChatRoom, format string, from *time.Time, to *time.Time, w io.Writer) error {
+	var writer transcript.Writer
+	switch format {
+	case ExportJSONL:
+		writer = transcript.NewJSONL(w)
+	case ExportCSV:
+		writer = transcript.NewCSV(w)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	err := s.exportRepo.StreamMessages(room.Id, from, to, func(msg *models.MessageResponse) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return writer.WriteMessage(msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// writeZip writes transcript.html and, after it, every attachment it links to
+func (s *exportService) writeZip(ctx context.Context, room *models.ChatRoom, from *time.Time, to *time.Time, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	page, err := archive.Create("transcript.html")
+	if err != nil {
+		return err
+	}
+
+	var files []*models.UploadedFile
+	writer := transcript.NewHTML(page, room, transcript.AttachmentName)
+	err = s.exportRepo.StreamMessages(room.Id, from, to, func(msg *models.MessageResponse) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if msg.File != nil {
+			files = append(files, msg.File)
+		}
+		return writer.WriteMessage(msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool, len(files))
+	for _, file := range files {
+		if seen[file.Id] {
+			continue
+		}
+		seen[file.Id] = true
+
+		err := s.writeAttachment(ctx, archive, file)
+		if err != nil {
+			return fmt.Errorf("failed to export file %d: %w", file.Id, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+func (s *exportService) writeAttachment(ctx context.Context, archive *zip.Writer, file *models.UploadedFile) error {
+	body, err := s.storage.Open(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	entry, err := archive.Create(transcript.AttachmentName(file))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, body)
+	return err
+}
+
+// DeleteExpiredExports removes exports, and their files, that finished longer than cfg.TTL ago
+func (s *exportService) DeleteExpiredExports(cfg config.Exports) (int, error) {
+	exports, err := s.exportRepo.GetExpiredExports(time.Now().Add(-cfg.TTL))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, export := range exports {
+		if export.Path != "" {
+			err := os.Remove(export.Path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return count, err
+			}
+		}
+
+		err := s.exportRepo.DeleteExport(export.Id)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func exportSnapshot(data *models.ExportRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"format": data.Format,
+		"from":   data.From,
+		"to":     data.To,
+	}
+}
@@ -2,92 +2,250 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
+	"github.com/gauravst/real-time-chat/internal/utils/imaging"
 	"github.com/gauravst/real-time-chat/internal/utils/ws"
 )
 
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrInvalidImage = errors.New("invalid image")
+)
+
 type FileService interface {
-	UploadFileInRoom(cfg config.Config, filePath string, content string, roomName string, userData *models.AccessToken, wsServer *models.WsServer) error
+	UploadFileInRoom(cfg config.Config, filePath string, filename string, content string, roomId int, userData *models.AccessToken, wsServer *models.WsServer) error
+	UploadAvatar(filePath string) (*models.UploadedFile, error)
+	GetFile(userData *models.AccessToken, fileId int) (*models.UploadedFile, error)
 }
 
+// avatarSize is the width and height avatars are stored with
+const avatarSize = 256
+
 type fileService struct {
-	fileRepo repositories.FileRepository
-	chatRepo repositories.ChatRepository
+	fileRepo      repositories.FileRepository
+	chatRepo      repositories.ChatRepository
+	blockService  BlockService
+	unfurlService UnfurlService
+	storage       storage.Storage
 }
 
-func NewFileService(fileRepo repositories.FileRepository, chatRepo repositories.ChatRepository) FileService {
+func NewFileService(fileRepo repositories.FileRepository, chatRepo repositories.ChatRepository, blockService BlockService, unfurlService UnfurlService, storage storage.Storage) FileService {
 	return &fileService{
-		fileRepo: fileRepo,
-		chatRepo: chatRepo,
+		fileRepo:      fileRepo,
+		chatRepo:      chatRepo,
+		blockService:  blockService,
+		unfurlService: unfurlService,
+		storage:       storage,
 	}
 }
 
-func (s *fileService) UploadFileInRoom(cfg config.Config, filePath string, content string, roomName string, userData *models.AccessToken, wsServer *models.WsServer) error {
-	// Initialize Cloudinary instance
-	cld, err := cloudinary.NewFromParams(cfg.Cloudinary.Name, cfg.Cloudinary.Key, cfg.Cloudinary.SecretKey)
+func (s *fileService) UploadFileInRoom(cfg config.Config, filePath string, filename string, content string, roomId int, userData *models.AccessToken, wsServer *models.WsServer) error {
+	member, err := s.chatRepo.CheckChatRoomMember(userData.UserId, roomId)
 	if err != nil {
-		log.Fatalf("Failed to initialize Cloudinary: %v", err)
-		return fmt.Errorf("Failed to initialize Cloudinary: %v", err)
+		return err
+	}
+
+	if !member {
+		return ErrNotRoomMember
 	}
 
-	// Upload an image
-	uploadResult, err := cld.Upload.Upload(context.Background(), filePath, uploader.UploadParams{})
+	room, err := s.chatRepo.GetChatRoomById(roomId)
 	if err != nil {
-		log.Fatalf("Failed to upload image: %v", err)
-		return fmt.Errorf("Failed to upload image: %v", err)
+		return err
 	}
 
-	fileData := &models.UploadedFile{
-		PublicId:         uploadResult.PublicID,
-		SecureUrl:        uploadResult.SecureURL,
-		Format:           uploadResult.Format,
-		ResourceType:     uploadResult.ResourceType,
-		Size:             float64(uploadResult.Bytes) / 1024,
-		Width:            uploadResult.Width,
-		Height:           uploadResult.Height,
-		OriginalFilename: uploadResult.OriginalFilename,
-		CreatedAt:        uploadResult.CreatedAt,
+	if room.ArchivedAt != nil {
+		return ErrRoomArchived
 	}
 
-	fmt.Print("FILE DATA -----\n")
-	fmt.Print(fileData)
+	fileData, err := storeFile(s.storage, cfg.Uploads, filePath, "")
+	if err != nil {
+		return err
+	}
+	if filename != "" {
+		fileData.OriginalFilename = filename
+	}
 
 	// add data in db
 	err = s.fileRepo.UploadFileInRoom(fileData)
-	fmt.Print("\nerr1-------\n")
-	fmt.Print(err)
 	if err != nil {
-		return fmt.Errorf("something went worng")
+		deleteStored(s.storage, fileData)
+		return fmt.Errorf("something went worng: %v", err)
 	}
 
 	data := &models.MessageResponse{
 		Type:     "Chat",
 		UserId:   userData.UserId,
 		Username: userData.Username,
-		RoomName: roomName,
+		RoomId:   roomId,
+		RoomName: room.Name,
 		Content:  content,
 		FileId:   &fileData.Id,
 	}
 
-	messageData, err := s.chatRepo.CreateNewMessage(data, roomName)
-	fmt.Print("\nerr2--------\n")
-	fmt.Print(err)
+	messageData, err := s.chatRepo.CreateNewMessage(data, roomId)
 	if err != nil {
-		return fmt.Errorf("something went worng", err)
+		return fmt.Errorf("something went worng: %v", err)
 	}
 
 	// adding file data to messageData
 	messageData.File = fileData
 
+	// users who blocked the uploader must not get the message
+	blockedBy, err := s.blockService.GetBlockedBy(userData.UserId)
+	if err != nil {
+		return err
+	}
+
 	// send data in websoket
-	ws.BroadcastMessage(wsServer, roomName, nil, messageData)
+	ws.BroadcastMessage(wsServer, roomId, nil, messageData, blockedBy)
+	s.unfurlService.Unfurl(messageData, blockedBy, wsServer)
 
 	return nil
 }
+
+// storeFile uploads the file at filePath into folder. Images are stored without their metadata, with
+// their size after the exif orientation and with thumbnails, other files are stored as they are.
+func storeFile(store storage.Storage, cfg config.Uploads, filePath string, folder string) (*models.UploadedFile, error) {
+	ctx := context.Background()
+	processed, err := imaging.Process(filePath, filepath.Dir(filePath), cfg.Thumbnails, cfg.Quality)
+	if errors.Is(err, imaging.ErrUnsupported) {
+		return store.Upload(ctx, filePath, folder)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+	defer processed.Remove()
+
+	fileData, err := store.Upload(ctx, processed.Path, folder)
+	if err != nil {
+		return nil, err
+	}
+	fileData.Width = processed.Width
+	fileData.Height = processed.Height
+
+	for _, variant := range processed.Variants {
+		stored, err := store.Upload(ctx, variant.Path, "thumbnails")
+		if err != nil {
+			deleteStored(store, fileData)
+			return nil, err
+		}
+
+		if fileData.Variants == nil {
+			fileData.Variants = map[string]*models.FileVariant{}
+		}
+		fileData.Variants[variant.Name] = &models.FileVariant{
+			PublicId:  stored.PublicId,
+			SecureUrl: stored.SecureUrl,
+			Format:    stored.Format,
+			Size:      stored.Size,
+			Width:     variant.Width,
+			Height:    variant.Height,
+		}
+	}
+
+	return fileData, nil
+}
+
+// deleteStored removes a file and its variants that were not saved, a failure only leaves an orphan behind
+func deleteStored(store storage.Storage, fileData *models.UploadedFile) {
+	publicIds := []string{fileData.PublicId}
+	for _, variant := range fileData.Variants {
+		publicIds = append(publicIds, variant.PublicId)
+	}
+
+	for _, publicId := range publicIds {
+		err := store.Delete(context.Background(), publicId)
+		if err != nil {
+			slog.Warn("failed to delete stored file", slog.String("publicId", publicId), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// GetFile returns a file the user can see: a file sent to a room the user is a member of, or an
+// avatar. Other files are not found, so their ids tell nothing.
+func (s *fileService) GetFile(userData *models.AccessToken, fileId int) (*models.UploadedFile, error) {
+	visible, err := s.canViewFile(userData, fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !visible {
+		return nil, ErrFileNotFound
+	}
+
+	data, err := s.fileRepo.GetFile(fileId)
+	if err != nil {
+		if err.Error() == "file not found" {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// UploadAvatar crops and scales the image at filePath to a square avatar and stores it
+func (s *fileService) UploadAvatar(filePath string) (*models.UploadedFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := imaging.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	avatarPath, err := imaging.WritePNG(filepath.Dir(filePath), "avatar-*.png", imaging.Square(img, avatarSize))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(avatarPath)
+
+	fileData, err := s.storage.Upload(context.Background(), avatarPath, "avatars")
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.fileRepo.UploadFileInRoom(fileData)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileData, nil
+}
+
+func (s *fileService) canViewFile(userData *models.AccessToken, fileId int) (bool, error) {
+	roomIds, avatar, err := s.fileRepo.GetFileUsage(fileId)
+	if err != nil || avatar {
+		return avatar, err
+	}
+
+	for _, roomId := range roomIds {
+		// api tokens only reach the rooms they are limited to
+		if len(userData.Rooms) > 0 && !slices.Contains(userData.Rooms, roomId) {
+			continue
+		}
+
+		if userData.Role == "ADMIN" {
+			return true, nil
+		}
+
+		member, err := s.chatRepo.CheckChatRoomMember(userData.UserId, roomId)
+		if err != nil || member {
+			return member, err
+		}
+	}
+	return false, nil
+}
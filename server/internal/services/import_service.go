@@ -0,0 +1,536 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
+	chatarchive "github.com/gauravst/real-time-chat/internal/utils/chatArchive"
+	"github.com/gauravst/real-time-chat/internal/utils/hashing"
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+)
+
+// import sources
+const (
+	ImportSlack   = "slack"
+	ImportDiscord = "discord"
+)
+
+// states of an import
+const (
+	ImportPending = "PENDING"
+	ImportRunning = "RUNNING"
+	ImportDone    = "DONE"
+	ImportFailed  = "FAILED"
+)
+
+var (
+	ErrImportNotFound      = errors.New("import not found or not failed")
+	ErrInvalidImportSource = errors.New("source must be slack or discord")
+)
+
+type ImportService interface {
+	Import(ctx context.Context, cfg config.Imports, source string, path string, ownerId int, progress func(stats *models.ImportStats)) (*models.ImportStats, error)
+	CreateImport(source string, path string, actor *models.AuditActor) (*models.Import, error)
+	GetImport(id int) (*models.Import, error)
+	GetAllImports() ([]*models.Import, error)
+	RetryImport(id int, actor *models.AuditActor) error
+	RunPendingImports(ctx context.Context, cfg config.Imports) (int, error)
+}
+
+type importService struct {
+	importRepo   repositories.ImportRepository
+	identityRepo repositories.IdentityRepository
+	accountRepo  repositories.AccountRepository
+	chatService  ChatService
+	auditService AuditService
+	storage      storage.Storage
+	uploads      config.Uploads
+}
+
+// NewImportService returns an ImportService, attachments are stored like files sent to a room with uploads
+func NewImportService(importRepo repositories.ImportRepository, identityRepo repositories.IdentityRepository, accountRepo repositories.AccountRepository, chatService ChatService, auditService AuditService, storage storage.Storage, uploads config.Uploads) ImportService {
+	return &importService{
+		importRepo:   importRepo,
+		identityRepo: identityRepo,
+		accountRepo:  accountRepo,
+		chatService:  chatService,
+		auditService: auditService,
+		storage:      storage,
+		uploads:      uploads,
+	}
+}
+
+// importRun is the state of one import, it maps the ids of the export to ours
+type importRun struct {
+	ctx      context.Context
+	service  *importService
+	source   string
+	ownerId  int
+	password string
+	stats    *models.ImportStats
+	users    map[string]int
+	members  map[[2]int]bool
+}
+
+// Import reads a Slack or Discord export and adds its channels as rooms owned by ownerId.
+// Rooms and messages imported before are skipped, so a failed import can simply be run again.
+func (s *importService) Import(ctx context.Context, cfg config.Imports, source string, path string, ownerId int, progress func(stats *models.ImportStats)) (*models.ImportStats, error) {
+	var archive *chatarchive.Archive
+	var err error
+	switch source {
+	case ImportSlack:
+		archive, err = chatarchive.OpenSlack(path, cfg.SlackToken)
+	case ImportDiscord:
+		archive, err = chatarchive.OpenDiscord(path)
+	default:
+		return nil, ErrInvalidImportSource
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	// placeholder users can't sign in, they share one hash of a password nobody knows
+	password, err := securetoken.Generate(32)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashing.GenerateHashString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &importRun{
+		ctx:      ctx,
+		service:  s,
+		source:   archive.Source,
+		ownerId:  ownerId,
+		password: hashedPassword,
+		stats:    &models.ImportStats{},
+		users:    make(map[string]int),
+		members:  make(map[[2]int]bool),
+	}
+
+	users := make(map[string]*chatarchive.User, len(archive.Users))
+	for _, user := range archive.Users {
+		users[user.Id] = user
+	}
+
+	for _, channel := range archive.Channels {
+		err := run.importChannel(channel, users)
+		if err != nil {
+			return run.stats, fmt.Errorf("failed to import channel %s: %w", channel.Name, err)
+		}
+
+		if progress != nil {
+			progress(run.stats)
+		}
+	}
+
+	return run.stats, nil
+}
+
+func (run *importRun) importChannel(channel *chatarchive.Channel, users map[string]*chatarchive.User) error {
+	roomId, err := run.room(channel)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range channel.Members {
+		user := users[id]
+		if user == nil {
+			continue
+		}
+
+		userId, err := run.user(user)
+		if err != nil {
+			return err
+		}
+
+		err = run.join(roomId, userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return channel.Messages(func(msg *chatarchive.Message) error {
+		if run.ctx.Err() != nil {
+			return run.ctx.Err()
+		}
+		return run.importMessage(roomId, msg)
+	})
+}
+
+// room returns the room of the channel, creating it on the first import
+func (run *importRun) room(channel *chatarchive.Channel) (int, error) {
+	repo := run.service.importRepo
+	roomId, err := repo.GetImportedRoom(run.source, channel.Id)
+	if err != nil || roomId != 0 {
+		return roomId, err
+	}
+
+	name := channel.Name
+	if name == "" {
+		name = channel.Id
+	}
+
+	description := channel.Topic
+	if description == "" {
+		description = "Imported from " + strings.SplitN(run.source, ":", 2)[0]
+	}
+
+	data := &models.ChatRoomRequest{Name: name, Description: description, UserId: run.ownerId}
+	err = run.service.chatService.CreateNewChatRoom(data)
+	if err != nil {
+		return 0, err
+	}
+
+	err = repo.SaveImportedRoom(run.source, channel.Id, data.Id, channel.Private, channel.Topic, channel.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	run.stats.Rooms++
+	run.members[[2]int{data.Id, run.ownerId}] = true
+	return data.Id, nil
+}
+
+// user returns our user for an author of the export. Authors are found by an identity linked
+// in an earlier import, then by verified email, else a placeholder user is created for them.
+func (run *importRun) user(author *chatarchive.User) (int, error) {
+	if id, ok := run.users[author.Id]; ok {
+		return id, nil
+	}
+
+	s := run.service
+	user, err := s.identityRepo.GetUserByIdentity(run.source, author.Id)
+	if err != nil && err.Error() != "identity not found" {
+		return 0, err
+	}
+
+	if user == nil && author.Email != "" {
+		user, err = s.accountRepo.GetUserByEmail(author.Email)
+		if err != nil && err.Error() != "user not found" {
+			return 0, err
+		}
+
+		if user != nil {
+			err = s.linkAuthor(run.source, author, user.Id)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if user == nil {
+		user, err = s.createPlaceholder(run.source, author, run.password)
+		if err != nil {
+			return 0, err
+		}
+		run.stats.Users++
+	}
+
+	run.users[author.Id] = user.Id
+	return user.Id, nil
+}
+
+func (s *importService) linkAuthor(source string, author *chatarchive.User, userId int) error {
+	err := s.identityRepo.CreateIdentity(&models.UserIdentity{
+		UserId:   userId,
+		Provider: source,
+		Subject:  author.Id,
+		Email:    author.Email,
+	})
+	if err != nil && err.Error() != "identity already linked" {
+		return err
+	}
+
+	return nil
+}
+
+// createPlaceholder creates a user named after the author, with a random suffix when the name is taken
+func (s *importService) createPlaceholder(source string, author *chatarchive.User, password string) (*models.User, error) {
+	base := strings.Trim(usernameCleaner.ReplaceAllString(author.Username, ""), "_.-")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 || strings.HasPrefix(base, "user_") || strings.HasPrefix(base, "deleted_") {
+		base = "imported_" + base
+	}
+
+	username := base
+	for i := 0; i < 5; i++ {
+		user, err := s.importRepo.CreatePlaceholderUser(username, author.DisplayName, password)
+		if err == nil {
+			return user, s.linkAuthor(source, author, user.Id)
+		}
+
+		if err.Error() != "username already taken" {
+			return nil, err
+		}
+
+		suffix, err := securetoken.Generate(3)
+		if err != nil {
+			return nil, err
+		}
+		username = base + "_" + strings.ToLower(usernameCleaner.ReplaceAllString(suffix, ""))
+	}
+
+	return nil, ErrUsernameTaken
+}
+
+func (run *importRun) join(roomId int, userId int) error {
+	key := [2]int{roomId, userId}
+	if run.members[key] {
+		return nil
+	}
+
+	err := run.service.importRepo.AddRoomMember(roomId, userId)
+	if err != nil {
+		return err
+	}
+
+	run.members[key] = true
+	return nil
+}
+
+// importMessage saves a message of the export. Our messages hold one file, every further
+// attachment becomes a message of its own.
+func (run *importRun) importMessage(roomId int, msg *chatarchive.Message) error {
+	if msg.Text == "" && len(msg.Attachments) == 0 {
+		run.stats.Skipped++
+		return nil
+	}
+
+	parts := len(msg.Attachments)
+	if parts == 0 {
+		parts = 1
+	}
+
+	for i := 0; i < parts; i++ {
+		data := &models.ImportedMessage{
+			ExternalId: msg.Id,
+			RoomId:     roomId,
+			CreatedAt:  msg.Time,
+		}
+		if i == 0 {
+			data.Content = msg.Text
+		} else {
+			data.ExternalId = msg.Id + "#" + strconv.Itoa(i)
+		}
+
+		imported, err := run.service.importRepo.IsMessageImported(run.source, data.ExternalId)
+		if err != nil {
+			return err
+		}
+
+		if imported {
+			run.stats.Skipped++
+			continue
+		}
+
+		data.UserId, err = run.user(msg.Author)
+		if err != nil {
+			return err
+		}
+
+		err = run.join(roomId, data.UserId)
+		if err != nil {
+			return err
+		}
+
+		if i < len(msg.Attachments) {
+			// a file that is gone should not stop the import, the message keeps its text
+			data.File, err = run.service.uploadAttachment(run.ctx, msg.Attachments[i])
+			if err != nil {
+				if run.ctx.Err() != nil {
+					return run.ctx.Err()
+				}
+				slog.Warn("failed to import attachment", slog.String("url", msg.Attachments[i].Url), slog.String("error", err.Error()))
+			}
+		}
+
+		if data.Content == "" && data.File == nil {
+			run.stats.Skipped++
+			continue
+		}
+
+		err = run.service.importRepo.ImportMessage(run.source, data)
+		if err != nil {
+			if data.File != nil {
+				deleteStored(run.service.storage, data.File)
+			}
+			return err
+		}
+
+		run.stats.Messages++
+		if data.File != nil {
+			run.stats.Files++
+		}
+	}
+
+	return nil
+}
+
+// uploadAttachment copies an attachment of the export into our storage, it is processed like a
+// file sent to a room and can't be larger than those
+func (s *importService) uploadAttachment(ctx context.Context, attachment *chatarchive.Attachment) (*models.UploadedFile, error) {
+	body, err := attachment.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "import-*"+filepath.Ext(attachment.Name))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(body, s.uploads.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if size > s.uploads.MaxSize {
+		return nil, fmt.Errorf("attachment is larger than %d bytes", s.uploads.MaxSize)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := storeFile(s.storage, s.uploads, tmp.Name(), "imports")
+	if err != nil {
+		return nil, err
+	}
+
+	file.OriginalFilename = attachment.Name
+	return file, nil
+}
+
+// CreateImport queues an uploaded export, RunPendingImports imports it
+func (s *importService) CreateImport(source string, path string, actor *models.AuditActor) (*models.Import, error) {
+	if source != ImportSlack && source != ImportDiscord {
+		return nil, ErrInvalidImportSource
+	}
+
+	data := &models.Import{Source: source, Path: path, RequestedBy: &actor.UserId}
+	err := s.importRepo.CreateImport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(actor, AuditImportCreate, "import", strconv.Itoa(data.Id), nil, map[string]interface{}{"source": source})
+	return data, nil
+}
+
+func (s *importService) GetImport(id int) (*models.Import, error) {
+	data, err := s.importRepo.GetImport(id)
+	if err != nil {
+		if err.Error() == "import not found" {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *importService) GetAllImports() ([]*models.Import, error) {
+	return s.importRepo.GetAllImports()
+}
+
+func (s *importService) RetryImport(id int, actor *models.AuditActor) error {
+	err := s.importRepo.RetryImport(id)
+	if err != nil {
+		if err.Error() == "import not found" {
+			return ErrImportNotFound
+		}
+		return err
+	}
+
+	s.auditService.Record(actor, AuditImportRetry, "import", strconv.Itoa(id), nil, nil)
+	return nil
+}
+
+// RunPendingImports imports queued exports one after another until none are left
+func (s *importService) RunPendingImports(ctx context.Context, cfg config.Imports) (int, error) {
+	count := 0
+	for ctx.Err() == nil {
+		item, err := s.importRepo.ClaimImport(time.Now().Add(-cfg.Timeout))
+		if err != nil {
+			return count, err
+		}
+
+		if item == nil {
+			break
+		}
+
+		s.runImport(ctx, cfg, item)
+		count++
+	}
+
+	return count, nil
+}
+
+// runImport imports one export and records how it went, the archive is kept until it worked
+func (s *importService) runImport(parent context.Context, cfg config.Imports, item *models.Import) {
+	ctx, cancel := context.WithTimeout(parent, cfg.Timeout)
+	defer cancel()
+
+	var stats *models.ImportStats
+	var err error
+	if item.RequestedBy == nil {
+		err = fmt.Errorf("the admin who started the import was deleted")
+	} else {
+		stats, err = s.Import(ctx, cfg, item.Source, item.Path, *item.RequestedBy, func(stats *models.ImportStats) {
+			err := s.importRepo.SaveImportProgress(item.Id, stats)
+			if err != nil {
+				slog.Error("failed to save import progress", slog.Int("importId", item.Id), slog.String("error", err.Error()))
+			}
+		})
+	}
+	if stats == nil {
+		stats = &models.ImportStats{}
+	}
+
+	// the server is stopping, the import is claimed again once it is stale
+	if err != nil && parent.Err() != nil {
+		return
+	}
+
+	status := ImportDone
+	message := ""
+	if err != nil {
+		slog.Error("import failed", slog.Int("importId", item.Id), slog.String("error", err.Error()))
+		status = ImportFailed
+		message = err.Error()
+	}
+
+	finishErr := s.importRepo.FinishImport(item.Id, status, stats, message)
+	if finishErr != nil {
+		slog.Error("failed to save import state", slog.Int("importId", item.Id), slog.String("error", finishErr.Error()))
+		return
+	}
+
+	if err == nil {
+		os.Remove(item.Path)
+		s.auditService.Record(nil, AuditImportDone, "import", strconv.Itoa(item.Id), nil, stats)
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	randomstring "github.com/gauravst/real-time-chat/internal/utils/randomString"
+	"github.com/gauravst/real-time-chat/internal/utils/throttle"
+)
+
+// roles a member can have inside a room
+const (
+	RoomRoleOwner     = "OWNER"
+	RoomRoleModerator = "MODERATOR"
+	RoomRoleMember    = "MEMBER"
+)
+
+const (
+	// inviteCodeLength gives about 95 bits, too many to guess
+	inviteCodeLength = 16
+	// inviteDefaultTTL is used when an invite is created without expiry
+	inviteDefaultTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidInvite = errors.New("invalid or expired invite")
+	ErrAlreadyMember = errors.New("you are already member of this room")
+)
+
+type InviteService interface {
+	CreateInvite(roomId int, userId int, data *models.InviteRequest, actor *models.AuditActor) (*models.RoomInvite, error)
+	GetAllInvites(roomId int) ([]*models.RoomInvite, error)
+	RevokeInvite(roomId int, id int, actor *models.AuditActor) error
+	GetRoomByCode(code string, userId int, clientIp string) (*models.ChatRoom, error)
+	JoinWithCode(code string, userId int, clientIp string) (*models.ChatRoom, error)
+}
+
+type inviteService struct {
+	inviteRepo   repositories.InviteRepository
+	chatRepo     repositories.ChatRepository
+	blockService BlockService
+	auditService AuditService
+	lookups      *throttle.Limiter
+}
+
+func NewInviteService(inviteRepo repositories.InviteRepository, chatRepo repositories.ChatRepository, blockService BlockService, auditService AuditService) InviteService {
+	return &inviteService{
+		inviteRepo:   inviteRepo,
+		chatRepo:     chatRepo,
+		blockService: blockService,
+		auditService: auditService,
+		lookups:      throttle.New(10, 15*time.Minute),
+	}
+}
+
+func (s *inviteService) CreateInvite(roomId int, userId int, data *models.InviteRequest, actor *models.AuditActor) (*models.RoomInvite, error) {
+	expiresAt := time.Now().Add(inviteDefaultTTL)
+	if data.ExpiresAt != nil {
+		if !data.ExpiresAt.After(time.Now()) {
+			return nil, errors.New("expiresAt must be in the future")
+		}
+		expiresAt = *data.ExpiresAt
+	}
+
+	code, err := randomstring.GenerateRandomString(inviteCodeLength)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &models.RoomInvite{
+		RoomId:    roomId,
+		Code:      code,
+		CreatedBy: userId,
+		Role:      data.Role,
+		MaxUses:   data.MaxUses,
+		ExpiresAt: &expiresAt,
+		Members:   []*models.InviteMember{},
+	}
+	if invite.Role == "" {
+		invite.Role = RoomRoleMember
+	}
+
+	err = s.inviteRepo.CreateInvite(invite)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(actor, AuditInviteCreate, "room", strconv.Itoa(roomId), nil, inviteSnapshot(invite))
+	return invite, nil
+}
+
+func (s *inviteService) GetAllInvites(roomId int) ([]*models.RoomInvite, error) {
+	return s.inviteRepo.GetAllInvites(roomId)
+}
+
+func (s *inviteService) RevokeInvite(roomId int, id int, actor *models.AuditActor) error {
+	err := s.inviteRepo.RevokeInvite(roomId, id)
+	if err != nil {
+		return err
+	}
+
+	s.auditService.Record(actor, AuditInviteRevoke, "room", strconv.Itoa(roomId), map[string]interface{}{"inviteId": id}, nil)
+	return nil
+}
+
+// lookupKeys are the throttle keys of a code lookup. Guests are free to create, so the client
+// address is counted as well as the user.
+func lookupKeys(userId int, clientIp string) []string {
+	return []string{"user:" + strconv.Itoa(userId), "ip:" + clientIp}
+}
+
+func (s *inviteService) lookupAllowed(keys []string) bool {
+	for _, key := range keys {
+		if !s.lookups.Allowed(key) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *inviteService) lookupFailed(keys []string) {
+	for _, key := range keys {
+		s.lookups.Fail(key)
+	}
+}
+
+// GetRoomByCode finds the room behind an invite code or the room code of a private room
+func (s *inviteService) GetRoomByCode(code string, userId int, clientIp string) (*models.ChatRoom, error) {
+	keys := lookupKeys(userId, clientIp)
+	if !s.lookupAllowed(keys) {
+		return nil, ErrTooManyAttempts
+	}
+
+	invite, err := s.inviteRepo.GetActiveInvite(code)
+	if err == nil {
+		return s.getInviteRoom(invite)
+	}
+	if err.Error() != "invite not found" {
+		return nil, err
+	}
+
+	room, err := s.chatRepo.GetPrivateChatRoom(code)
+	if err != nil {
+		s.lookupFailed(keys)
+		return nil, ErrInvalidInvite
+	}
+
+	return room, nil
+}
+
+// JoinWithCode adds the user to the room behind an invite code or a room code
+func (s *inviteService) JoinWithCode(code string, userId int, clientIp string) (*models.ChatRoom, error) {
+	keys := lookupKeys(userId, clientIp)
+	if !s.lookupAllowed(keys) {
+		return nil, ErrTooManyAttempts
+	}
+
+	invite, err := s.inviteRepo.GetActiveInvite(code)
+	if err != nil {
+		if err.Error() != "invite not found" {
+			return nil, err
+		}
+		return s.joinWithRoomCode(code, userId, keys)
+	}
+
+	room, err := s.getInviteRoom(invite)
+	if err != nil {
+		return nil, err
+	}
+
+	if room.ArchivedAt != nil {
+		return nil, ErrRoomArchived
+	}
+
+	// whoever shared the link does not want to be reached by users they blocked
+	err = s.blockService.CheckNotBlocked(invite.CreatedBy, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.inviteRepo.UseInvite(invite.Id, userId)
+	if err != nil {
+		switch err.Error() {
+		case "invite not found":
+			return nil, ErrInvalidInvite
+		case "already a member":
+			return nil, ErrAlreadyMember
+		}
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// getInviteRoom returns the room of an invite, invites of deleted rooms are invalid
+func (s *inviteService) getInviteRoom(invite *models.RoomInvite) (*models.ChatRoom, error) {
+	room, err := s.chatRepo.GetChatRoomById(invite.RoomId)
+	if err != nil {
+		if err.Error() == "room not found" {
+			return nil, ErrInvalidInvite
+		}
+		return nil, err
+	}
+
+	return room, nil
+}
+
+func (s *inviteService) joinWithRoomCode(code string, userId int, keys []string) (*models.ChatRoom, error) {
+	room, err := s.chatRepo.GetPrivateChatRoom(code)
+	if err != nil {
+		s.lookupFailed(keys)
+		return nil, ErrInvalidInvite
+	}
+
+	member, err := s.chatRepo.CheckChatRoomMember(userId, room.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if member {
+		return nil, ErrAlreadyMember
+	}
+
+	err = s.chatRepo.JoinRoom(&models.JoinRoomRequest{UserId: userId, RoomId: room.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// inviteSnapshot keeps the audited fields of an invite, the code is left out
+func inviteSnapshot(invite *models.RoomInvite) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        invite.Id,
+		"role":      invite.Role,
+		"maxUses":   invite.MaxUses,
+		"expiresAt": invite.ExpiresAt,
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
+)
+
+// states of a join request
+const (
+	JoinRequestPending  = "PENDING"
+	JoinRequestApproved = "APPROVED"
+	JoinRequestDenied   = "DENIED"
+)
+
+var ErrJoinRequestPending = errors.New("you already asked to join this room")
+
+type JoinRequestService interface {
+	GetPendingJoinRequests(roomId int) ([]*models.JoinRequest, error)
+	GetUserJoinRequests(userId int) ([]*models.JoinRequest, error)
+	DecideJoinRequest(roomId int, id int, approve bool, userId int, wsServer *models.WsServer) (*models.JoinRequest, error)
+	CanManageJoinRequests(userData *models.AccessToken, roomId int) (bool, error)
+}
+
+type joinRequestService struct {
+	joinRequestRepo repositories.JoinRequestRepository
+}
+
+func NewJoinRequestService(joinRequestRepo repositories.JoinRequestRepository) JoinRequestService {
+	return &joinRequestService{
+		joinRequestRepo: joinRequestRepo,
+	}
+}
+
+func (s *joinRequestService) GetPendingJoinRequests(roomId int) ([]*models.JoinRequest, error) {
+	return s.joinRequestRepo.GetPendingJoinRequests(roomId)
+}
+
+func (s *joinRequestService) GetUserJoinRequests(userId int) ([]*models.JoinRequest, error) {
+	return s.joinRequestRepo.GetUserJoinRequests(userId)
+}
+
+// DecideJoinRequest approves or denies a pending request and tells the requester
+func (s *joinRequestService) DecideJoinRequest(roomId int, id int, approve bool, userId int, wsServer *models.WsServer) (*models.JoinRequest, error) {
+	status := JoinRequestDenied
+	if approve {
+		status = JoinRequestApproved
+	}
+
+	request, err := s.joinRequestRepo.DecideJoinRequest(roomId, id, status, userId, approve)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.SendToUsers(wsServer, []int{request.UserId}, &models.JoinRequestEvent{Type: "joinRequestDecided", Request: request})
+	return request, nil
+}
+
+// CanManageJoinRequests reports whether the user is an admin, the owner or a moderator of the room
+func (s *joinRequestService) CanManageJoinRequests(userData *models.AccessToken, roomId int) (bool, error) {
+	if userData.Role == "ADMIN" {
+		return true, nil
+	}
+
+	managerIds, err := s.joinRequestRepo.GetRoomManagerIds(roomId)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(managerIds, userData.UserId), nil
+}
+
+// notifyRoomManagers pushes a new join request to the owner and moderators who are online
+func notifyRoomManagers(joinRequestRepo repositories.JoinRequestRepository, wsServer *models.WsServer, request *models.JoinRequest) {
+	managerIds, err := joinRequestRepo.GetRoomManagerIds(request.RoomId)
+	if err != nil {
+		slog.Error("failed to load room managers", slog.Int("roomId", request.RoomId), slog.String("error", err.Error()))
+		return
+	}
+
+	ws.SendToUsers(wsServer, managerIds, &models.JoinRequestEvent{Type: "joinRequest", Request: request})
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/utils/hashing"
+	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	ErrIdentityLinked   = errors.New("identity is already linked to another user")
+)
+
+// oidcStateTTL is how long a user has to finish signing in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCService interface {
+	GetProviders() []string
+	AuthCodeURL(ctx context.Context, providerName string, linkUserId int, cfg config.Config) (string, string, error)
+	Callback(ctx context.Context, providerName string, code string, state string, stateToken string, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error)
+	GetAllIdentities(userId int) ([]*models.UserIdentity, error)
+}
+
+// oidcProvider is discovered lazily so the server starts even if a provider is down
+type oidcProvider struct {
+	cfg      config.OIDCProvider
+	mutex    sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+type oidcService struct {
+	authService  AuthService
+	identityRepo repositories.IdentityRepository
+	providers    map[string]*oidcProvider
+	providerList []string
+	httpClient   *http.Client
+	keys         *jwtToken.KeySet
+}
+
+// NewOIDCService creates the service for the configured providers. httpClient is used for
+// discovery, JWKS and token requests, nil means http.DefaultClient. keys signs the login state.
+func NewOIDCService(authService AuthService, identityRepo repositories.IdentityRepository, providers []config.OIDCProvider, httpClient *http.Client, keys *jwtToken.KeySet) OIDCService {
+	s := &oidcService{
+		authService:  authService,
+		identityRepo: identityRepo,
+		providers:    make(map[string]*oidcProvider),
+		httpClient:   httpClient,
+		keys:         keys,
+	}
+
+	for _, p := range providers {
+		s.providers[p.Name] = &oidcProvider{cfg: p}
+		s.providerList = append(s.providerList, p.Name)
+	}
+
+	return s
+}
+
+func (s *oidcService) GetProviders() []string {
+	return s.providerList
+}
+
+func (s *oidcService) clientContext(ctx context.Context) context.Context {
+	if s.httpClient == nil {
+		return ctx
+	}
+	return oidc.ClientContext(ctx, s.httpClient)
+}
+
+// getProvider returns the provider, running discovery on first use
+func (s *oidcService) getProvider(ctx context.Context, name string) (*oidcProvider, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.verifier != nil {
+		return p, nil
+	}
+
+	provider, err := oidc.NewProvider(s.clientContext(ctx), p.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover provider %s: %w", name, err)
+	}
+
+	scopes := append([]string{oidc.ScopeOpenID}, p.cfg.Scopes...)
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientId,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectUrl,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	// ID tokens are checked against the provider's JWKS
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientId})
+
+	return p, nil
+}
+
+// AuthCodeURL returns the provider login url and a signed state token to keep in a cookie.
+// A non zero linkUserId links the identity to that user instead of logging in.
+func (s *oidcService) AuthCodeURL(ctx context.Context, providerName string, linkUserId int, cfg config.Config) (string, string, error) {
+	p, err := s.getProvider(ctx, providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := securetoken.Generate(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := securetoken.Generate(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	claims := jwt.MapClaims{
+		"purpose":    "oidc_state",
+		"provider":   providerName,
+		"state":      state,
+		"nonce":      nonce,
+		"verifier":   verifier,
+		"linkUserId": linkUserId,
+		"exp":        time.Now().Add(oidcStateTTL).Unix(),
+	}
+	stateTokenString, err := jwtToken.CreateNewToken(claims, jwtToken.AudienceOIDCState, s.keys)
+	if err != nil {
+		return "", "", err
+	}
+
+	url := p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return url, stateTokenString, nil
+}
+
+// Callback finishes the authorization code flow. Unknown identities get a new user
+// provisioned just in time, or are linked to the user that started the flow.
+func (s *oidcService) Callback(ctx context.Context, providerName string, code string, state string, stateToken string, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, *models.User, error) {
+	savedState, err := jwtToken.VerifyJwtAndGetData[models.OIDCState](stateToken, jwtToken.AudienceOIDCState, s.keys)
+	if err != nil || savedState.Purpose != "oidc_state" || savedState.Provider != providerName || savedState.State != state {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	p, err := s.getProvider(ctx, providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx = s.clientContext(ctx)
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(savedState.Verifier))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("provider did not return an id token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	var claims models.OIDCClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if claims.Nonce != savedState.Nonce {
+		return nil, nil, fmt.Errorf("invalid id token nonce")
+	}
+
+	user, err := s.findOrCreateUser(p.cfg.Issuer, savedState.LinkUserId, &claims, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.authService.CreateSession(user, session, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// findOrCreateUser returns the user of the identity, links it to linkUserId or creates a user
+// for it. New users are only created while registration is open.
+func (s *oidcService) findOrCreateUser(issuer string, linkUserId int, claims *models.OIDCClaims, cfg config.Config) (*models.User, error) {
+	user, err := s.identityRepo.GetUserByIdentity(issuer, claims.Subject)
+	if err == nil {
+		if linkUserId != 0 && user.Id != linkUserId {
+			return nil, ErrIdentityLinked
+		}
+		return user, nil
+	}
+
+	if err.Error() != "identity not found" {
+		return nil, err
+	}
+
+	if linkUserId != 0 {
+		err = s.identityRepo.CreateIdentity(&models.UserIdentity{
+			UserId:   linkUserId,
+			Provider: issuer,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return s.identityRepo.GetUserByIdentity(issuer, claims.Subject)
+	}
+
+	if cfg.Auth.DisableRegistration {
+		return nil, ErrRegistrationDisabled
+	}
+
+	user, err = s.provisionUser(issuer, claims)
+	if err != nil {
+		// a concurrent callback for the same identity created the user first
+		if err.Error() == "identity already linked" {
+			return s.identityRepo.GetUserByIdentity(issuer, claims.Subject)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+var usernameCleaner = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// provisionUser creates a user linked to a new identity. The password is random and never
+// shown, these users sign in through their provider.
+func (s *oidcService) provisionUser(issuer string, claims *models.OIDCClaims) (*models.User, error) {
+	base := claims.PreferredUsername
+	if base == "" && claims.Email != "" {
+		base = strings.Split(claims.Email, "@")[0]
+	}
+	if base == "" {
+		base = claims.Name
+	}
+
+	base = strings.Trim(usernameCleaner.ReplaceAllString(base, ""), "_.-")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 || strings.HasPrefix(base, "user_") || strings.HasPrefix(base, "deleted_") {
+		base = "sso_" + base
+	}
+
+	password, err := securetoken.Generate(32)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashing.GenerateHashString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// add a random suffix until the username is free
+	username := base
+	for i := 0; i < 5; i++ {
+		user, err := s.identityRepo.CreateUserWithIdentity(&models.LoginRequest{
+			Username: username,
+			Password: hashedPassword,
+		}, &models.UserIdentity{
+			Provider: issuer,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		if err == nil {
+			return user, nil
+		}
+
+		if err.Error() != "username already taken" {
+			return nil, err
+		}
+
+		suffix, err := securetoken.Generate(3)
+		if err != nil {
+			return nil, err
+		}
+		username = base + "_" + strings.ToLower(usernameCleaner.ReplaceAllString(suffix, ""))
+	}
+
+	return nil, ErrUsernameTaken
+}
+
+func (s *oidcService) GetAllIdentities(userId int) ([]*models.UserIdentity, error) {
+	data, err := s.identityRepo.GetAllIdentities(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/utils/jwtToken"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientId = "sync-talk"
+	testProvider = "mock"
+)
+
+// mockIssuer is a local OIDC provider with discovery, JWKS and a token endpoint that checks PKCE
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex sync.Mutex
+	codes map[string]*mockGrant
+}
+
+// mockGrant is what the provider remembers about an authorization code
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIssuer{key: key, codes: map[string]*mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", m.token)
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// token answers the code exchange, the code_verifier must match the challenge of the code
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	m.mutex.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// authorize plays the user signing in at the provider for the login url, edit changes the
+// claims of the ID token. It returns the code and state the provider redirects back with.
+func (m *mockIssuer) authorize(t *testing.T, loginUrl string, subject string, edit func(claims jwt.MapClaims)) (string, string) {
+	t.Helper()
+
+	parsed, err := url.Parse(loginUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("login url has no PKCE challenge: %s", loginUrl)
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                m.server.URL,
+		"aud":                testClientId,
+		"sub":                subject,
+		"email":              subject + "@example.com",
+		"preferred_username": subject,
+		"nonce":              query.Get("nonce"),
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+	if edit != nil {
+		edit(claims)
+	}
+
+	code := fmt.Sprintf("code-%s-%d", subject, time.Now().UnixNano())
+	m.mutex.Lock()
+	m.codes[code] = &mockGrant{challenge: query.Get("code_challenge"), claims: claims}
+	m.mutex.Unlock()
+
+	return code, query.Get("state")
+}
+
+type fakeAuthService struct {
+	AuthService
+}
+
+func (f *fakeAuthService) CreateSession(user *models.User, session *models.LoginSession, cfg config.Config) (*models.AuthTokens, error) {
+	return &models.AuthTokens{AccessToken: fmt.Sprintf("access-%d", user.Id)}, nil
+}
+
+// fakeUsers keeps the users and identities of the identity repository in memory
+type fakeUsers struct {
+	users      map[int]*models.User
+	identities map[string]int
+}
+
+func newFakeUsers(users ...*models.User) *fakeUsers {
+	f := &fakeUsers{users: map[int]*models.User{}, identities: map[string]int{}}
+	for _, user := range users {
+		f.users[user.Id] = user
+	}
+	return f
+}
+
+func (f *fakeUsers) CreateUserWithIdentity(data *models.LoginRequest, identity *models.UserIdentity) (*models.User, error) {
+	for _, user := range f.users {
+		if user.Username == data.Username {
+			return nil, errors.New("username already taken")
+		}
+	}
+
+	user := &models.User{Id: 100 + len(f.users), Username: data.Username, Password: data.Password}
+	f.users[user.Id] = user
+	f.identities[identity.Provider+" "+identity.Subject] = user.Id
+	return user, nil
+}
+
+func (f *fakeUsers) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	userId, ok := f.identities[provider+" "+subject]
+	if !ok {
+		return nil, errors.New("identity not found")
+	}
+	return f.users[userId], nil
+}
+
+func (f *fakeUsers) CreateIdentity(data *models.UserIdentity) error {
+	f.identities[data.Provider+" "+data.Subject] = data.UserId
+	return nil
+}
+
+func (f *fakeUsers) GetAllIdentities(userId int) ([]*models.UserIdentity, error) {
+	return nil, nil
+}
+
+func newTestOIDCService(t *testing.T, users *fakeUsers) (OIDCService, *mockIssuer, *jwtToken.KeySet) {
+	t.Helper()
+
+	issuer := newMockIssuer(t)
+	keys, err := jwtToken.GenerateKeySet("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providers := []config.OIDCProvider{{
+		Name:         testProvider,
+		Issuer:       issuer.server.URL,
+		ClientId:     testClientId,
+		ClientSecret: "secret",
+		RedirectUrl:  "http://localhost/api/auth/oidc/mock/callback",
+		Scopes:       []string{"email", "profile"},
+	}}
+
+	service := NewOIDCService(&fakeAuthService{}, users, providers, issuer.server.Client(), keys)
+	return service, issuer, keys
+}
+
+// signIn runs the flow up to the callback for subject, linkUserId links instead of logging in
+func signIn(t *testing.T, service OIDCService, issuer *mockIssuer, subject string, linkUserId int, edit func(claims jwt.MapClaims)) (*models.User, error) {
+	t.Helper()
+	return signInWith(t, service, issuer, subject, linkUserId, edit, config.Config{})
+}
+
+func signInWith(t *testing.T, service OIDCService, issuer *mockIssuer, subject string, linkUserId int, edit func(claims jwt.MapClaims), cfg config.Config) (*models.User, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	loginUrl, stateToken, err := service.AuthCodeURL(ctx, testProvider, linkUserId, config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.authorize(t, loginUrl, subject, edit)
+	_, user, err := service.Callback(ctx, testProvider, code, state, stateToken, &models.LoginSession{}, cfg)
+	return user, err
+}
+
+func TestOIDCProvisionsNewUser(t *testing.T) {
+	users := newFakeUsers()
+	service, issuer, _ := newTestOIDCService(t, users)
+
+	user, err := signIn(t, service, issuer, "alice", 0, nil)
+	if err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+
+	if user.Username != "alice" {
+		t.Errorf("provisioned username = %q, want alice", user.Username)
+	}
+	if users.identities[issuer.server.URL+" alice"] != user.Id {
+		t.Errorf("identity was not stored for the new user")
+	}
+
+	// the next login finds the same user
+	again, err := signIn(t, service, issuer, "alice", 0, nil)
+	if err != nil {
+		t.Fatalf("second callback failed: %v", err)
+	}
+	if again.Id != user.Id || len(users.users) != 1 {
+		t.Errorf("second login created another user")
+	}
+}
+
+func TestOIDCRegistrationDisabled(t *testing.T) {
+	users := newFakeUsers(&models.User{Id: 7, Username: "bob"})
+	service, issuer, _ := newTestOIDCService(t, users)
+	users.identities[issuer.server.URL+" known"] = 7
+
+	var cfg config.Config
+	cfg.Auth.DisableRegistration = true
+
+	_, err := signInWith(t, service, issuer, "alice", 0, nil, cfg)
+	if !errors.Is(err, ErrRegistrationDisabled) {
+		t.Fatalf("err = %v, want ErrRegistrationDisabled", err)
+	}
+	if len(users.users) != 1 {
+		t.Errorf("a user was created while registration is disabled")
+	}
+
+	user, err := signInWith(t, service, issuer, "known", 0, nil, cfg)
+	if err != nil || user.Id != 7 {
+		t.Errorf("login with a linked identity = %v, %v, want user 7", user, err)
+	}
+
+	user, err = signInWith(t, service, issuer, "alice", 7, nil, cfg)
+	if err != nil || user.Id != 7 {
+		t.Errorf("linking = %v, %v, want user 7", user, err)
+	}
+}
+
+func TestOIDCProvisionAvoidsTakenUsername(t *testing.T) {
+	users := newFakeUsers(&models.User{Id: 1, Username: "alice"})
+	service, issuer, _ := newTestOIDCService(t, users)
+
+	user, err := signIn(t, service, issuer, "alice", 0, nil)
+	if err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+	if user.Id == 1 || !strings.HasPrefix(user.Username, "alice_") {
+		t.Errorf("got user %d %q, want a new user with a suffixed name", user.Id, user.Username)
+	}
+}
+
+func TestOIDCLinksIdentity(t *testing.T) {
+	users := newFakeUsers(&models.User{Id: 7, Username: "bob"}, &models.User{Id: 8, Username: "carol"})
+	service, issuer, _ := newTestOIDCService(t, users)
+
+	user, err := signIn(t, service, issuer, "bob-sso", 7, nil)
+	if err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if user.Id != 7 || len(users.users) != 2 {
+		t.Errorf("identity linked to user %d, want 7 without provisioning", user.Id)
+	}
+
+	// logging in with the linked identity signs in as its user
+	user, err = signIn(t, service, issuer, "bob-sso", 0, nil)
+	if err != nil || user.Id != 7 {
+		t.Fatalf("login with linked identity = %v, %v, want user 7", user, err)
+	}
+
+	// another user can't take the identity over
+	_, err = signIn(t, service, issuer, "bob-sso", 8, nil)
+	if !errors.Is(err, ErrIdentityLinked) {
+		t.Errorf("linking an identity of another user: err = %v, want ErrIdentityLinked", err)
+	}
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	users := newFakeUsers()
+	service, issuer, _ := newTestOIDCService(t, users)
+
+	_, err := signIn(t, service, issuer, "mallory", 0, func(claims jwt.MapClaims) {
+		claims["nonce"] = "replayed"
+	})
+	if err == nil {
+		t.Fatal("callback accepted an id token with another nonce")
+	}
+	if len(users.users) != 0 {
+		t.Error("a user was provisioned for a rejected token")
+	}
+}
+
+func TestOIDCRejectsWrongAudience(t *testing.T) {
+	users := newFakeUsers()
+	service, issuer, _ := newTestOIDCService(t, users)
+
+	_, err := signIn(t, service, issuer, "mallory", 0, func(claims jwt.MapClaims) {
+		claims["aud"] = "another-client"
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid id token") {
+		t.Fatalf("err = %v, want an invalid id token error", err)
+	}
+	if len(users.users) != 0 {
+		t.Error("a user was provisioned for a rejected token")
+	}
+}
+
+func TestOIDCRejectsBadState(t *testing.T) {
+	users := newFakeUsers()
+	service, issuer, keys := newTestOIDCService(t, users)
+	ctx := context.Background()
+
+	loginUrl, stateToken, err := service.AuthCodeURL(ctx, testProvider, 0, config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.authorize(t, loginUrl, "mallory", nil)
+
+	parts := strings.Split(stateToken, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	tampered := strings.Replace(string(payload), `"linkUserId":0`, `"linkUserId":1`, 1)
+	if tampered == string(payload) {
+		t.Fatalf("state payload has no linkUserId: %s", payload)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(tampered))
+
+	expired, err := jwtToken.CreateNewToken(jwt.MapClaims{
+		"purpose":  "oidc_state",
+		"provider": testProvider,
+		"state":    state,
+		"exp":      time.Now().Add(-time.Minute).Unix(),
+	}, jwtToken.AudienceOIDCState, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a token of the same keys for another audience, such as an access token
+	otherAudience, err := jwtToken.CreateNewToken(jwt.MapClaims{
+		"purpose":  "oidc_state",
+		"provider": testProvider,
+		"state":    state,
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	}, "real-time-chat-api", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		state      string
+		stateToken string
+	}{
+		"tampered cookie": {state, strings.Join(parts, ".")},
+		"expired cookie":  {state, expired},
+		"other audience":  {state, otherAudience},
+		"other state":     {"other", stateToken},
+		"no cookie":       {state, ""},
+	}
+	for name, c := range cases {
+		_, _, err := service.Callback(ctx, testProvider, code, c.state, c.stateToken, &models.LoginSession{}, config.Config{})
+		if !errors.Is(err, ErrInvalidOIDCState) {
+			t.Errorf("%s: err = %v, want ErrInvalidOIDCState", name, err)
+		}
+	}
+
+	// the untouched state still works, so the cases above failed for their own reason
+	_, _, err = service.Callback(ctx, testProvider, code, state, stateToken, &models.LoginSession{}, config.Config{})
+	if err != nil {
+		t.Errorf("valid state rejected: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found in this room")
+	ErrAlreadyPinned   = errors.New("this message is already pinned")
+	ErrPinNotFound     = errors.New("this message is not pinned")
+	ErrPinLimit        = errors.New("pinned message limit reached")
+)
+
+// PinService manages the pinned messages and the topic moderators set on a room
+type PinService interface {
+	GetPinnedMessages(roomId int) ([]*models.PinnedMessage, error)
+	PinMessage(room *models.ChatRoom, messageId int, actor *models.AuditActor, wsServer *models.WsServer) (*models.PinnedMessage, error)
+	UnpinMessage(room *models.ChatRoom, messageId int, actor *models.AuditActor, wsServer *models.WsServer) error
+	SetRoomTopic(room *models.ChatRoom, topic string, actor *models.AuditActor, wsServer *models.WsServer) (*models.MessageResponse, error)
+	CanModerateRoom(userData *models.AccessToken, roomId int) (bool, error)
+}
+
+type pinService struct {
+	pinRepo         repositories.PinRepository
+	chatRepo        repositories.ChatRepository
+	joinRequestRepo repositories.JoinRequestRepository
+	auditService    AuditService
+	maxPins         int
+}
+
+func NewPinService(pinRepo repositories.PinRepository, chatRepo repositories.ChatRepository, joinRequestRepo repositories.JoinRequestRepository, auditService AuditService, maxPins int) PinService {
+	return &pinService{
+		pinRepo:         pinRepo,
+		chatRepo:        chatRepo,
+		joinRequestRepo: joinRequestRepo,
+		auditService:    auditService,
+		maxPins:         maxPins,
+	}
+}
+
+func (s *pinService) GetPinnedMessages(roomId int) ([]*models.PinnedMessage, error) {
+	return s.pinRepo.GetPinnedMessages(roomId)
+}
+
+// PinMessage pins a message of the room and tells everyone connected to it
+func (s *pinService) PinMessage(room *models.ChatRoom, messageId int, actor *models.AuditActor, wsServer *models.WsServer) (*models.PinnedMessage, error) {
+	if room.ArchivedAt != nil {
+		return nil, ErrRoomArchived
+	}
+
+	roomId := room.Id
+	pin, err := s.pinRepo.PinMessage(roomId, messageId, actor.UserId, s.maxPins)
+	if err != nil {
+		switch err.Error() {
+		case "room not found":
+			return nil, ErrRoomNotFound
+		case "message not found":
+			return nil, ErrMessageNotFound
+		case "message already pinned":
+			return nil, ErrAlreadyPinned
+		case "pin limit reached":
+			return nil, fmt.Errorf("%w, a room can have at most %d", ErrPinLimit, s.maxPins)
+		}
+		return nil, err
+	}
+
+	s.auditService.Record(actor, AuditRoomPin, "room", strconv.Itoa(roomId), nil, map[string]interface{}{"messageId": messageId})
+	ws.SendToRoom(wsServer, roomId, &models.PinEvent{Type: "messagePinned", RoomId: roomId, MessageId: messageId, Pin: pin})
+	return pin, nil
+}
+
+func (s *pinService) UnpinMessage(room *models.ChatRoom, messageId int, actor *models.AuditActor, wsServer *models.WsServer) error {
+	if room.ArchivedAt != nil {
+		return ErrRoomArchived
+	}
+
+	roomId := room.Id
+	err := s.pinRepo.UnpinMessage(roomId, messageId)
+	if err != nil {
+		if err.Error() == "pin not found" {
+			return ErrPinNotFound
+		}
+		return err
+	}
+
+	s.auditService.Record(actor, AuditRoomUnpin, "room", strconv.Itoa(roomId), map[string]interface{}{"messageId": messageId}, nil)
+	ws.SendToRoom(wsServer, roomId, &models.PinEvent{Type: "messageUnpinned", RoomId: roomId, MessageId: messageId})
+	return nil
+}
+
+// SetRoomTopic changes the topic of the room, the change is kept in the history as a system message
+func (s *pinService) SetRoomTopic(room *models.ChatRoom, topic string, actor *models.AuditActor, wsServer *models.WsServer) (*models.MessageResponse, error) {
+	if room.ArchivedAt != nil {
+		return nil, ErrRoomArchived
+	}
+
+	content := "changed the topic to: " + topic
+	if topic == "" {
+		content = "cleared the topic"
+	}
+
+	message, err := s.chatRepo.SetRoomTopic(room.Id, topic, content, actor.UserId)
+	if err != nil {
+		if err.Error() == "room not found" {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+
+	s.auditService.Record(actor, AuditRoomTopic, "room", strconv.Itoa(room.Id), map[string]interface{}{"topic": room.Topic}, map[string]interface{}{"topic": topic})
+	ws.SendToRoom(wsServer, room.Id, &models.TopicEvent{Type: "topicChanged", RoomId: room.Id, Topic: topic, Message: message})
+	return message, nil
+}
+
+// CanModerateRoom reports whether the user is an admin, the owner or a moderator of the room
+func (s *pinService) CanModerateRoom(userData *models.AccessToken, roomId int) (bool, error) {
+	if userData.Role == "ADMIN" {
+		return true, nil
+	}
+
+	managerIds, err := s.joinRequestRepo.GetRoomManagerIds(roomId)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(managerIds, userData.UserId), nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
+	"github.com/gauravst/real-time-chat/internal/utils/identicon"
+)
+
+// identiconSize is the width and height of generated avatars
+const identiconSize = 240
+
+type ProfileService interface {
+	GetProfile(userId int) (*models.Profile, error)
+	UpdateProfile(userId int, data *models.ProfileRequest) (*models.Profile, error)
+	SetAvatar(userId int, file *models.UploadedFile) (*models.Profile, error)
+	RemoveAvatar(userId int) error
+	GetIdenticon(userId int) ([]byte, error)
+}
+
+type profileService struct {
+	profileRepo repositories.ProfileRepository
+	storage     storage.Storage
+}
+
+func NewProfileService(profileRepo repositories.ProfileRepository, storage storage.Storage) ProfileService {
+	return &profileService{
+		profileRepo: profileRepo,
+		storage:     storage,
+	}
+}
+
+func (s *profileService) GetProfile(userId int) (*models.Profile, error) {
+	data, err := s.profileRepo.GetProfile(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.AvatarUrl = avatarUrl(data.AvatarUrl, data.UserId)
+	return data, nil
+}
+
+func (s *profileService) UpdateProfile(userId int, data *models.ProfileRequest) (*models.Profile, error) {
+	if data.StatusExpiresAt != nil && !data.StatusExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("statusExpiresAt must be in the future")
+	}
+
+	// an expiry without a status means nothing
+	if data.StatusText == "" {
+		data.StatusExpiresAt = nil
+	}
+
+	err := s.profileRepo.UpdateProfile(userId, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProfile(userId)
+}
+
+// SetAvatar makes an uploaded file the avatar of the user, the previous avatar is deleted
+func (s *profileService) SetAvatar(userId int, file *models.UploadedFile) (*models.Profile, error) {
+	old, err := s.profileRepo.SetAvatar(userId, file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteStoredFile(old)
+	return s.GetProfile(userId)
+}
+
+func (s *profileService) RemoveAvatar(userId int) error {
+	old, err := s.profileRepo.RemoveAvatar(userId)
+	if err != nil {
+		return err
+	}
+
+	s.deleteStoredFile(old)
+	return nil
+}
+
+func (s *profileService) GetIdenticon(userId int) ([]byte, error) {
+	return identicon.Generate(strconv.Itoa(userId), identiconSize)
+}
+
+// deleteStoredFile removes a replaced avatar from storage, a failure only leaves an orphan behind
+func (s *profileService) deleteStoredFile(file *models.UploadedFile) {
+	if file == nil || file.PublicId == "" {
+		return
+	}
+
+	err := s.storage.Delete(context.Background(), file.PublicId)
+	if err != nil {
+		slog.Warn("failed to delete old avatar", slog.String("publicId", file.PublicId), slog.String("error", err.Error()))
+	}
+}
+
+// avatarUrl falls back to the identicon of the user when no avatar was uploaded
+func avatarUrl(profilePic string, userId int) string {
+	if profilePic != "" {
+		return profilePic
+	}
+
+	return "/api/user/" + strconv.Itoa(userId) + "/identicon"
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/metrics"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
+)
+
+// retention modes
+const (
+	RetentionDelete = "delete"
+	RetentionRedact = "redact"
+)
+
+var ErrInvalidRetentionMode = errors.New("retention mode must be delete or redact")
+
+type RetentionService interface {
+	SetRoomRetention(room *models.ChatRoom, days *int, actor *models.AuditActor) error
+	PurgeExpiredMessages(ctx context.Context, cfg config.Retention) (*models.RetentionResult, error)
+}
+
+type retentionService struct {
+	retentionRepo repositories.RetentionRepository
+	auditService  AuditService
+	storage       storage.Storage
+}
+
+func NewRetentionService(retentionRepo repositories.RetentionRepository, auditService AuditService, storage storage.Storage) RetentionService {
+	return &retentionService{
+		retentionRepo: retentionRepo,
+		auditService:  auditService,
+		storage:       storage,
+	}
+}
+
+func (s *retentionService) SetRoomRetention(room *models.ChatRoom, days *int, actor *models.AuditActor) error {
+	err := s.retentionRepo.SetRoomRetention(room.Id, days)
+	if err != nil {
+		if err.Error() == "room not found" {
+			return ErrRoomNotFound
+		}
+		return err
+	}
+
+	s.auditService.Record(actor, AuditRoomRetention, "room", strconv.Itoa(room.Id),
+		map[string]interface{}{"retentionDays": room.RetentionDays}, map[string]interface{}{"retentionDays": days})
+	return nil
+}
+
+// PurgeExpiredMessages deletes or redacts messages older than the retention of their room,
+// batch by batch until none are left or ctx is cancelled. Every affected room gets an audit entry.
+func (s *retentionService) PurgeExpiredMessages(ctx context.Context, cfg config.Retention) (*models.RetentionResult, error) {
+	if cfg.Mode != RetentionDelete && cfg.Mode != RetentionRedact {
+		return nil, ErrInvalidRetentionMode
+	}
+
+	start := time.Now()
+	metrics.Retention.Add("runs", 1)
+
+	result, err := s.purgeBatches(ctx, cfg)
+
+	// whatever was removed before a failure is gone for good, so it is always recorded
+	messagesKey := "messagesDeleted"
+	if cfg.Mode == RetentionRedact {
+		messagesKey = "messagesRedacted"
+	}
+	metrics.Retention.Add(messagesKey, int64(result.Messages))
+	metrics.Retention.Add("filesDeleted", int64(result.Files))
+	metrics.Retention.Set("lastRunAt", intVar(start.Unix()))
+	metrics.Retention.Set("lastRunMillis", intVar(time.Since(start).Milliseconds()))
+
+	for roomId, count := range result.Rooms {
+		s.auditService.Record(nil, AuditRoomRetentionPurge, "room", strconv.Itoa(roomId), nil, map[string]interface{}{
+			"mode":     cfg.Mode,
+			"messages": count,
+		})
+	}
+
+	if err != nil {
+		metrics.Retention.Add("failures", 1)
+		return result, err
+	}
+	return result, nil
+}
+
+func (s *retentionService) purgeBatches(ctx context.Context, cfg config.Retention) (*models.RetentionResult, error) {
+	result := &models.RetentionResult{Rooms: make(map[int]int)}
+	for ctx.Err() == nil {
+		batch, err := s.retentionRepo.PurgeExpiredMessages(cfg.DefaultDays, cfg.BatchSize, cfg.Mode == RetentionRedact)
+		if err != nil {
+			return result, fmt.Errorf("failed to purge expired messages: %w", err)
+		}
+
+		// the rows are gone, a file left in storage is only an orphan
+		for _, publicId := range batch.PublicIds {
+			err := s.storage.Delete(ctx, publicId)
+			if err != nil {
+				slog.Warn("failed to delete file of expired message", slog.String("publicId", publicId), slog.String("error", err.Error()))
+			}
+		}
+
+		for roomId, count := range batch.Rooms {
+			result.Rooms[roomId] += count
+		}
+		result.Messages += batch.Messages
+		result.Files += batch.Files
+
+		if batch.Messages < cfg.BatchSize {
+			break
+		}
+	}
+
+	return result, ctx.Err()
+}
+
+func intVar(value int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(value)
+	return v
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	securetoken "github.com/gauravst/real-time-chat/internal/utils/secureToken"
+	"github.com/gauravst/real-time-chat/internal/utils/throttle"
+	"github.com/gauravst/real-time-chat/internal/utils/totp"
+)
+
+var (
+	ErrTwoFactorNotEnrolled = errors.New("2fa not enrolled")
+	ErrInvalidTwoFactorCode = errors.New("invalid 2fa code")
+	ErrTooManyAttempts      = errors.New("too many attempts, try again later")
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorService interface {
+	IsEnabled(userId int) (bool, error)
+	Enroll(userData *models.AccessToken, cfg config.Config) (*models.TwoFactorEnrollment, error)
+	Confirm(userId int, code string) ([]string, error)
+	Disable(userId int, code string) error
+	VerifyCode(userId int, code string) error
+}
+
+type twoFactorService struct {
+	twoFactorRepo repositories.TwoFactorRepository
+	attempts      *throttle.Limiter
+}
+
+func NewTwoFactorService(twoFactorRepo repositories.TwoFactorRepository) TwoFactorService {
+	return &twoFactorService{
+		twoFactorRepo: twoFactorRepo,
+		attempts:      throttle.New(5, 5*time.Minute),
+	}
+}
+
+func (s *twoFactorService) IsEnabled(userId int) (bool, error) {
+	data, err := s.twoFactorRepo.GetTotp(userId)
+	if err != nil {
+		if err.Error() == "2fa not enrolled" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return data.ConfirmedAt != nil, nil
+}
+
+// Enroll creates a new secret, it is only active once confirmed with a code
+func (s *twoFactorService) Enroll(userData *models.AccessToken, cfg config.Config) (*models.TwoFactorEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.twoFactorRepo.SaveTotpSecret(userData.UserId, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorEnrollment{
+		Secret: secret,
+		Uri:    totp.URI(cfg.Auth.TwoFactorIssuer, userData.Username, secret),
+	}, nil
+}
+
+// Confirm activates 2FA and returns the recovery codes, they are only shown once
+func (s *twoFactorService) Confirm(userId int, code string) ([]string, error) {
+	data, err := s.twoFactorRepo.GetTotp(userId)
+	if err != nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(data.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	err = s.twoFactorRepo.ConfirmTotp(userId, step)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, securetoken.Hash(normalizeRecoveryCode(code)))
+	}
+
+	err = s.twoFactorRepo.CreateRecoveryCodes(userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(userId int, code string) error {
+	err := s.VerifyCode(userId, code)
+	if err != nil {
+		return err
+	}
+
+	return s.twoFactorRepo.DeleteTotp(userId)
+}
+
+// VerifyCode accepts a current TOTP code or an unused recovery code
+func (s *twoFactorService) VerifyCode(userId int, code string) error {
+	key := strconv.Itoa(userId)
+	if !s.attempts.Allowed(key) {
+		return ErrTooManyAttempts
+	}
+
+	data, err := s.twoFactorRepo.GetTotp(userId)
+	if err != nil || data.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(data.Secret, code, time.Now())
+		if ok && s.twoFactorRepo.UseTotpStep(userId, step) == nil {
+			s.attempts.Reset(key)
+			return nil
+		}
+	} else {
+		err = s.twoFactorRepo.UseRecoveryCode(userId, securetoken.Hash(normalizeRecoveryCode(code)))
+		if err == nil {
+			s.attempts.Reset(key)
+			return nil
+		}
+	}
+
+	s.attempts.Fail(key)
+	return ErrInvalidTwoFactorCode
+}
+
+// generateRecoveryCode returns a code like "k7xq2-9fjw4"
+func generateRecoveryCode() (string, error) {
+	data := make([]byte, 7)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(data))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/metrics"
+	"github.com/gauravst/real-time-chat/internal/models"
+	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/utils/markdown"
+	"github.com/gauravst/real-time-chat/internal/utils/unfurl"
+	"github.com/gauravst/real-time-chat/internal/utils/ws"
+)
+
+// UnfurlService adds link previews to new messages. Messages are queued and unfurled by
+// background workers, so sending a message never waits for a page.
+type UnfurlService interface {
+	Unfurl(message *models.MessageResponse, blockedBy map[int]bool, wsServer *models.WsServer)
+	Run(ctx context.Context)
+	SetRoomUnfurl(room *models.ChatRoom, enabled bool, actor *models.AuditActor) error
+	DeleteStalePreviews() (int64, error)
+}
+
+// unfurlJob is a message waiting for its previews, users in blockedBy don't get them
+type unfurlJob struct {
+	message   *models.MessageResponse
+	links     []string
+	blockedBy map[int]bool
+	wsServer  *models.WsServer
+}
+
+type unfurlService struct {
+	unfurlRepo   repositories.UnfurlRepository
+	auditService AuditService
+	fetcher      *unfurl.Fetcher
+	cfg          config.Unfurl
+	queue        chan *unfurlJob
+}
+
+func NewUnfurlService(unfurlRepo repositories.UnfurlRepository, auditService AuditService, fetcher *unfurl.Fetcher, cfg config.Unfurl) UnfurlService {
+	return &unfurlService{
+		unfurlRepo:   unfurlRepo,
+		auditService: auditService,
+		fetcher:      fetcher,
+		cfg:          cfg,
+		queue:        make(chan *unfurlJob, cfg.QueueSize),
+	}
+}
+
+// Unfurl queues a message that has links. When the queue is full the message gets no
+// previews rather than holding up the sender.
+func (s *unfurlService) Unfurl(message *models.MessageResponse, blockedBy map[int]bool, wsServer *models.WsServer) {
+	if !s.cfg.Enabled {
+		return
+	}
+
+	links := markdown.Links(message.Content)
+	if len(links) == 0 {
+		return
+	}
+	if len(links) > s.cfg.MaxLinks {
+		links = links[:s.cfg.MaxLinks]
+	}
+
+	select {
+	case s.queue <- &unfurlJob{message: message, links: links, blockedBy: blockedBy, wsServer: wsServer}:
+	default:
+		metrics.Unfurl.Add("dropped", 1)
+		slog.Warn("link preview queue full", slog.Int("messageId", message.Id))
+	}
+}
+
+// Run unfurls queued messages with cfg.Workers workers until ctx is cancelled
+func (s *unfurlService) Run(ctx context.Context) {
+	if !s.cfg.Enabled {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(s.cfg.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.queue:
+					s.unfurl(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// unfurl saves the previews of a message and pushes them to the room
+func (s *unfurlService) unfurl(ctx context.Context, job *unfurlJob) {
+	message := job.message
+	enabled, err := s.unfurlRepo.IsRoomUnfurled(message.RoomId)
+	if err != nil {
+		slog.Error("failed to load room", slog.Int("roomId", message.RoomId), slog.String("error", err.Error()))
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	var previews []*models.LinkPreview
+	var urls []string
+	for _, link := range job.links {
+		preview := s.preview(ctx, link)
+		if preview != nil && preview.Ok {
+			previews = append(previews, preview)
+			urls = append(urls, preview.Url)
+		}
+	}
+
+	if len(previews) == 0 {
+		return
+	}
+
+	// fails when the message was deleted in the meantime
+	err = s.unfurlRepo.AddMessagePreviews(message.Id, urls)
+	if err != nil {
+		slog.Error("failed to save link previews", slog.Int("messageId", message.Id), slog.String("error", err.Error()))
+		return
+	}
+
+	ws.SendToRoomExcept(job.wsServer, message.RoomId, &models.PreviewEvent{
+		Type:      "messagePreviews",
+		RoomId:    message.RoomId,
+		MessageId: message.Id,
+		Previews:  previews,
+	}, job.blockedBy)
+}
+
+// preview returns the cached preview of link or fetches it, nil when neither worked.
+// Pages without a preview are cached too, so they aren't fetched for every message.
+func (s *unfurlService) preview(ctx context.Context, link string) *models.LinkPreview {
+	now := time.Now()
+	cached, err := s.unfurlRepo.GetLinkPreview(link, now.Add(-s.cfg.CacheTTL), now.Add(-s.cfg.FailureTTL))
+	if err != nil {
+		slog.Error("failed to load link preview", slog.String("error", err.Error()))
+		return nil
+	}
+	if cached != nil {
+		metrics.Unfurl.Add("cached", 1)
+		return cached
+	}
+
+	preview, err := s.fetcher.Fetch(ctx, link)
+	if err != nil {
+		// the server is stopping, the page itself may be fine
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		metrics.Unfurl.Add("failed", 1)
+		slog.Info("link preview failed", slog.String("url", link), slog.String("error", err.Error()))
+		preview = &models.LinkPreview{Url: link}
+	} else {
+		metrics.Unfurl.Add("fetched", 1)
+	}
+
+	err = s.unfurlRepo.SaveLinkPreview(preview)
+	if err != nil {
+		slog.Error("failed to save link preview", slog.String("error", err.Error()))
+	}
+	return preview
+}
+
+func (s *unfurlService) SetRoomUnfurl(room *models.ChatRoom, enabled bool, actor *models.AuditActor) error {
+	err := s.unfurlRepo.SetRoomUnfurl(room.Id, enabled)
+	if err != nil {
+		if err.Error() == "room not found" {
+			return ErrRoomNotFound
+		}
+		return err
+	}
+
+	s.auditService.Record(actor, AuditRoomUnfurl, "room", strconv.Itoa(room.Id),
+		map[string]interface{}{"unfurlLinks": room.UnfurlLinks}, map[string]interface{}{"unfurlLinks": enabled})
+	return nil
+}
+
+// DeleteStalePreviews removes cached previews that are out of date and not shown by any message
+func (s *unfurlService) DeleteStalePreviews() (int64, error) {
+	return s.unfurlRepo.DeleteStalePreviews(time.Now().Add(-max(s.cfg.CacheTTL, s.cfg.FailureTTL)))
+}
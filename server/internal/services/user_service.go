@@ -1,27 +1,38 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
 
+	"github.com/gauravst/real-time-chat/internal/config"
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gauravst/real-time-chat/internal/repositories"
+	"github.com/gauravst/real-time-chat/internal/storage"
 )
 
 type UserService interface {
 	CreateUser(user *models.User) error
 	GetAllUsers() ([]*models.User, error)
 	GetUserByID(id int) (*models.User, error)
-	UpdateUser(user *models.UserRequest) error
-	DeleteUser(id int) error
+	UpdateUser(user *models.UserRequest, actor *models.AuditActor) error
+	DeleteUser(id int, actor *models.AuditActor) error
+	CleanupGuests(cfg config.Guests) (int64, error)
 }
 
 type userService struct {
-	userRepo repositories.UserRepository
+	userRepo     repositories.UserRepository
+	auditService AuditService
+	storage      storage.Storage
 }
 
-func NewUserService(userRepo repositories.UserRepository) UserService {
+func NewUserService(userRepo repositories.UserRepository, auditService AuditService, storage storage.Storage) UserService {
 	return &userService{
-		userRepo: userRepo,
+		userRepo:     userRepo,
+		auditService: auditService,
+		storage:      storage,
 	}
 }
 
@@ -55,20 +66,78 @@ func (s *userService) GetUserByID(id int) (*models.User, error) {
 }
 
 // UpdateUser updates an existing user
-func (s *userService) UpdateUser(user *models.UserRequest) error {
-	err := s.userRepo.UpdateUser(user)
+func (s *userService) UpdateUser(user *models.UserRequest, actor *models.AuditActor) error {
+	before, err := s.userRepo.GetUserByID(user.Id)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
+	err = s.userRepo.UpdateUser(user)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	action := AuditUserUpdate
+	if before.Role != user.Role {
+		action = AuditUserRoleChange
+	}
+	after := &models.User{Id: user.Id, Username: user.Username, Role: user.Role}
+	s.auditService.Record(actor, action, "user", strconv.Itoa(user.Id), userSnapshot(before), userSnapshot(after))
+
 	return nil
 }
 
 // DeleteUser deletes a user by their ID
-func (s *userService) DeleteUser(id int) error {
-	err := s.userRepo.DeleteUser(id)
+func (s *userService) DeleteUser(id int, actor *models.AuditActor) error {
+	before, err := s.userRepo.GetUserByID(id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
+
+	err = s.userRepo.DeleteUser(id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	s.auditService.Record(actor, AuditUserDelete, "user", strconv.Itoa(id), userSnapshot(before), nil)
 	return nil
 }
+
+// userSnapshot keeps the audited fields of a user, never the password
+func userSnapshot(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       user.Id,
+		"username": user.Username,
+		"role":     user.Role,
+	}
+}
+
+// CleanupGuests deletes or anonymizes guests that were inactive longer than the TTL
+func (s *userService) CleanupGuests(cfg config.Guests) (int64, error) {
+	cutoff := time.Now().Add(-cfg.TTL)
+
+	var deleted int64
+	if cfg.Mode == "delete" {
+		count, publicIds, err := s.userRepo.DeleteInactiveGuests(cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete guests: %w", err)
+		}
+		deleted = count
+
+		// the rows are gone, a file left in storage is only an orphan
+		for _, publicId := range publicIds {
+			err := s.storage.Delete(context.Background(), publicId)
+			if err != nil {
+				slog.Warn("failed to delete file of removed guest", slog.String("publicId", publicId), slog.String("error", err.Error()))
+			}
+		}
+	}
+
+	// in delete mode this only catches guests that own a room
+	anonymized, err := s.userRepo.AnonymizeInactiveGuests(cutoff)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to anonymize guests: %w", err)
+	}
+
+	return deleted + anonymized, nil
+}
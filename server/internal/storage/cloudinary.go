@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+	"github.com/gauravst/real-time-chat/internal/config"
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+type cloudinaryStorage struct {
+	cld *cloudinary.Cloudinary
+}
+
+func NewCloudinary(cfg config.Cloudinary) (Storage, error) {
+	cld, err := cloudinary.NewFromParams(cfg.Name, cfg.Key, cfg.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cloudinary: %w", err)
+	}
+
+	return &cloudinaryStorage{cld: cld}, nil
+}
+
+func (s *cloudinaryStorage) Upload(ctx context.Context, filePath string, folder string) (*models.UploadedFile, error) {
+	result, err := s.cld.Upload.Upload(ctx, filePath, uploader.UploadParams{Folder: folder})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	if result.Error.Message != "" {
+		return nil, fmt.Errorf("failed to upload file: %s", result.Error.Message)
+	}
+
+	return &models.UploadedFile{
+		PublicId:         result.PublicID,
+		SecureUrl:        result.SecureURL,
+		Format:           result.Format,
+		ResourceType:     result.ResourceType,
+		Size:             float64(result.Bytes) / 1024,
+		Width:            result.Width,
+		Height:           result.Height,
+		OriginalFilename: result.OriginalFilename,
+		CreatedAt:        result.CreatedAt,
+	}, nil
+}
+
+func (s *cloudinaryStorage) Delete(ctx context.Context, publicId string) error {
+	_, err := s.cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: publicId})
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+// Open downloads the file from its delivery url
+func (s *cloudinaryStorage) Open(ctx context.Context, file *models.UploadedFile) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.SecureUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("failed to open file: status %d", res.StatusCode)
+	}
+
+	return res.Body, nil
+}
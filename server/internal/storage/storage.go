@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// Storage keeps uploaded files, the returned file is not saved in the database yet
+type Storage interface {
+	Upload(ctx context.Context, filePath string, folder string) (*models.UploadedFile, error)
+	Delete(ctx context.Context, publicId string) error
+	// Open reads a stored file, the caller closes it
+	Open(ctx context.Context, file *models.UploadedFile) (io.ReadCloser, error)
+}
@@ -0,0 +1,49 @@
+package auditchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// Genesis is the prevHash of the first event
+const Genesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// chainedFields fixes the field order that goes into the hash
+type chainedFields struct {
+	PrevHash   string  `json:"prevHash"`
+	ActorId    *int    `json:"actorId"`
+	ActorName  string  `json:"actorName"`
+	Action     string  `json:"action"`
+	TargetType string  `json:"targetType"`
+	TargetId   string  `json:"targetId"`
+	Before     *string `json:"before"`
+	After      *string `json:"after"`
+	Ip         string  `json:"ip"`
+	RequestId  string  `json:"requestId"`
+	CreatedAt  int64   `json:"createdAt"`
+}
+
+// Hash returns the hex sha256 over the event and event.PrevHash, so changing,
+// removing or reordering a row breaks every hash after it
+func Hash(event *models.AuditEvent) string {
+	data, _ := json.Marshal(chainedFields{
+		PrevHash:   event.PrevHash,
+		ActorId:    event.ActorId,
+		ActorName:  event.ActorName,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetId:   event.TargetId,
+		Before:     event.Before,
+		After:      event.After,
+		Ip:         event.Ip,
+		RequestId:  event.RequestId,
+		// microseconds survive the round trip through a postgres timestamp
+		CreatedAt: event.CreatedAt.UnixMicro(),
+	})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+// Package chatarchive reads the chat history exported from other chat services
+package chatarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/utils/unfurl"
+)
+
+// downloadTimeout bounds the download of one attachment
+const downloadTimeout = 2 * time.Minute
+
+// httpClient only reaches public addresses, attachment links come from the export and
+// could otherwise point at the server's own network
+var httpClient = unfurl.NewClient(downloadTimeout)
+
+// Archive is an export of one workspace or server
+type Archive struct {
+	// Source names the workspace or server, the ids below are only unique within it
+	Source   string
+	Users    []*User
+	Channels []*Channel
+	close    func() error
+}
+
+// Close releases the archive file
+func (a *Archive) Close() error {
+	if a.close == nil {
+		return nil
+	}
+	return a.close()
+}
+
+type User struct {
+	Id          string
+	Username    string
+	DisplayName string
+	Email       string
+	Bot         bool
+}
+
+type Channel struct {
+	Id      string
+	Name    string
+	Topic   string
+	Private bool
+	// Members are user ids, exports that don't list members leave it empty
+	Members   []string
+	CreatedAt time.Time
+	messages  func(fn func(msg *Message) error) error
+}
+
+// Messages calls fn for every message of the channel, oldest first. They are read while
+// iterating so a large channel is never held in memory.
+func (c *Channel) Messages(fn func(msg *Message) error) error {
+	return c.messages(fn)
+}
+
+type Message struct {
+	Id          string
+	Author      *User
+	Text        string
+	Time        time.Time
+	Attachments []*Attachment
+}
+
+type Attachment struct {
+	Id   string
+	Name string
+	Url  string
+	open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Open reads the attachment, the caller closes it
+func (a *Attachment) Open(ctx context.Context) (io.ReadCloser, error) {
+	return a.open(ctx)
+}
+
+// download fetches link, token is sent as a bearer token when set
+func download(ctx context.Context, link string, token string) (io.ReadCloser, error) {
+	target, err := url.Parse(link)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid attachment link %q", link)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("download failed with status %d", res.StatusCode)
+	}
+
+	return res.Body, nil
+}
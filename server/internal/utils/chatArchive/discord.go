@@ -0,0 +1,268 @@
+package chatarchive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type discordHeader struct {
+	Guild struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"guild"`
+	Channel struct {
+		Id    string `json:"id"`
+		Type  string `json:"type"`
+		Name  string `json:"name"`
+		Topic string `json:"topic"`
+	} `json:"channel"`
+}
+
+type discordUser struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Nickname string `json:"nickname"`
+	IsBot    bool   `json:"isBot"`
+}
+
+type discordMessage struct {
+	Id          string         `json:"id"`
+	Type        string         `json:"type"`
+	Timestamp   time.Time      `json:"timestamp"`
+	Content     string         `json:"content"`
+	Author      discordUser    `json:"author"`
+	Mentions    []*discordUser `json:"mentions"`
+	Attachments []struct {
+		Id       string `json:"id"`
+		Url      string `json:"url"`
+		FileName string `json:"fileName"`
+	} `json:"attachments"`
+}
+
+// discordTypes are the message types that carry chat
+var discordTypes = map[string]bool{
+	"Default": true,
+	"Reply":   true,
+}
+
+// discordFile is one exported channel, open reads it and openRelative the media saved next to it
+type discordFile struct {
+	open         func() (io.ReadCloser, error)
+	openRelative func(name string) (io.ReadCloser, error)
+}
+
+// OpenDiscord opens a DiscordChatExporter JSON export, a single channel .json file or
+// a zip with one .json file per channel. Media saved with the export is read from next
+// to the channel file, other attachments are downloaded.
+func OpenDiscord(filePath string) (*Archive, error) {
+	if !strings.EqualFold(filepath.Ext(filePath), ".zip") {
+		dir := filepath.Dir(filePath)
+		return readDiscord([]*discordFile{{
+			open: func() (io.ReadCloser, error) { return os.Open(filePath) },
+			openRelative: func(name string) (io.ReadCloser, error) {
+				name = filepath.FromSlash(name)
+				if !filepath.IsLocal(name) {
+					return nil, fmt.Errorf("attachment %q is outside the export", name)
+				}
+				return os.Open(filepath.Join(dir, name))
+			},
+		}})
+	}
+
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open discord export: %w", err)
+	}
+
+	var files []*discordFile
+	for _, file := range reader.File {
+		if !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+
+		dir := path.Dir(file.Name)
+		files = append(files, &discordFile{
+			open: file.Open,
+			openRelative: func(name string) (io.ReadCloser, error) {
+				return reader.Open(path.Join(dir, name))
+			},
+		})
+	}
+
+	archive, err := readDiscord(files)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	archive.close = reader.Close
+	return archive, nil
+}
+
+func readDiscord(files []*discordFile) (*Archive, error) {
+	archive := &Archive{}
+	for _, file := range files {
+		header := &discordHeader{}
+		err := readDiscordFile(file, header, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Channel.Id == "" {
+			return nil, fmt.Errorf("not a discord channel export")
+		}
+
+		if archive.Source == "" {
+			archive.Source = "discord:" + header.Guild.Id
+		}
+
+		archive.Channels = append(archive.Channels, &Channel{
+			Id:    header.Channel.Id,
+			Name:  header.Channel.Name,
+			Topic: header.Channel.Topic,
+			messages: func(fn func(msg *Message) error) error {
+				return readDiscordFile(file, nil, func(m *discordMessage) error {
+					if !discordTypes[m.Type] {
+						return nil
+					}
+					return fn(discordToMessage(file, m))
+				})
+			},
+		})
+	}
+
+	if archive.Source == "" {
+		return nil, fmt.Errorf("no channels found in discord export")
+	}
+
+	return archive, nil
+}
+
+// readDiscordFile walks the top level of a channel export. The header is read into header,
+// when fn is nil reading stops at the messages so large channels are not decoded twice.
+func readDiscordFile(file *discordFile, header *discordHeader, fn func(m *discordMessage) error) error {
+	reader, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	dec := json.NewDecoder(reader)
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read discord export: %w", err)
+	}
+	if token != json.Delim('{') {
+		return fmt.Errorf("not a discord channel export")
+	}
+
+	var raw json.RawMessage
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read discord export: %w", err)
+		}
+
+		switch key, _ := token.(string); {
+		case key == "messages" && fn == nil:
+			return nil
+		case key == "messages":
+			err = readDiscordMessages(dec, fn)
+		case key == "guild" && header != nil:
+			err = dec.Decode(&header.Guild)
+		case key == "channel" && header != nil:
+			err = dec.Decode(&header.Channel)
+		default:
+			err = dec.Decode(&raw)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read discord export: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func readDiscordMessages(dec *json.Decoder, fn func(m *discordMessage) error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("messages is not a list")
+	}
+
+	for dec.More() {
+		m := &discordMessage{}
+		err := dec.Decode(m)
+		if err != nil {
+			return err
+		}
+
+		err = fn(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = dec.Token()
+	return err
+}
+
+var discordMention = regexp.MustCompile(`<@!?(\d+)>`)
+
+func discordToMessage(file *discordFile, m *discordMessage) *Message {
+	content := discordMention.ReplaceAllStringFunc(m.Content, func(match string) string {
+		id := discordMention.FindStringSubmatch(match)[1]
+		for _, user := range m.Mentions {
+			if user.Id == id {
+				return "@" + user.Name
+			}
+		}
+		return match
+	})
+
+	msg := &Message{
+		Id: m.Id,
+		Author: &User{
+			Id:          m.Author.Id,
+			Username:    m.Author.Name,
+			DisplayName: m.Author.Nickname,
+			Bot:         m.Author.IsBot,
+		},
+		Text: content,
+		Time: m.Timestamp.UTC(),
+	}
+
+	for _, a := range m.Attachments {
+		location := a.Url
+		attachment := &Attachment{Id: a.Id, Name: a.FileName, Url: location}
+		if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+			attachment.open = func(ctx context.Context) (io.ReadCloser, error) {
+				return download(ctx, location, "")
+			}
+		} else {
+			attachment.open = func(ctx context.Context) (io.ReadCloser, error) {
+				name, err := url.PathUnescape(location)
+				if err != nil {
+					name = location
+				}
+				return file.openRelative(strings.TrimPrefix(filepath.ToSlash(name), "./"))
+			}
+		}
+
+		msg.Attachments = append(msg.Attachments, attachment)
+	}
+
+	return msg
+}
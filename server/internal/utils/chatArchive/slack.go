@@ -0,0 +1,303 @@
+package chatarchive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type slackUser struct {
+	Id       string `json:"id"`
+	TeamId   string `json:"team_id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	IsBot    bool   `json:"is_bot"`
+	Profile  struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+		Email       string `json:"email"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Created int64    `json:"created"`
+	Members []string `json:"members"`
+	Topic   struct {
+		Value string `json:"value"`
+	} `json:"topic"`
+	Purpose struct {
+		Value string `json:"value"`
+	} `json:"purpose"`
+}
+
+type slackMessage struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	User     string `json:"user"`
+	BotId    string `json:"bot_id"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	Ts       string `json:"ts"`
+	Files    []struct {
+		Id                 string `json:"id"`
+		Name               string `json:"name"`
+		Mode               string `json:"mode"`
+		UrlPrivate         string `json:"url_private"`
+		UrlPrivateDownload string `json:"url_private_download"`
+	} `json:"files"`
+}
+
+// slackFileHost serves the files of a workspace export
+const slackFileHost = "files.slack.com"
+
+// slackSubtypes are the message subtypes that carry chat, joins, leaves and
+// channel changes are left out
+var slackSubtypes = map[string]bool{
+	"":                 true,
+	"bot_message":      true,
+	"file_share":       true,
+	"me_message":       true,
+	"thread_broadcast": true,
+}
+
+// OpenSlack opens a Slack workspace export zip. token is sent when downloading files from
+// the Slack file host over https, exports made without file links that embed a token need it.
+func OpenSlack(filePath string, token string) (*Archive, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open slack export: %w", err)
+	}
+
+	archive, err := readSlack(&reader.Reader, token)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	archive.close = reader.Close
+	return archive, nil
+}
+
+func readSlack(reader *zip.Reader, token string) (*Archive, error) {
+	files := make(map[string]*zip.File)
+	days := make(map[string][]*zip.File)
+	for _, file := range reader.File {
+		files[file.Name] = file
+
+		dir, name := path.Split(file.Name)
+		if dir != "" && strings.HasSuffix(name, ".json") {
+			days[strings.TrimSuffix(dir, "/")] = append(days[strings.TrimSuffix(dir, "/")], file)
+		}
+	}
+
+	var users []*slackUser
+	err := readZipJson(files["users.json"], &users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users.json: %w", err)
+	}
+
+	archive := &Archive{Source: "slack"}
+	byId := make(map[string]*User, len(users))
+	for _, u := range users {
+		if u.TeamId != "" && archive.Source == "slack" {
+			archive.Source = "slack:" + u.TeamId
+		}
+
+		user := &User{
+			Id:          u.Id,
+			Username:    u.Name,
+			DisplayName: firstNonEmpty(u.Profile.DisplayName, u.Profile.RealName, u.RealName),
+			Email:       u.Profile.Email,
+			Bot:         u.IsBot,
+		}
+		byId[u.Id] = user
+		archive.Users = append(archive.Users, user)
+	}
+
+	for _, name := range []string{"channels.json", "groups.json"} {
+		file := files[name]
+		if file == nil {
+			continue
+		}
+
+		var channels []*slackChannel
+		err := readZipJson(file, &channels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		for _, c := range channels {
+			channelDays := days[c.Name]
+			sort.Slice(channelDays, func(i, j int) bool { return channelDays[i].Name < channelDays[j].Name })
+
+			channelId := c.Id
+			archive.Channels = append(archive.Channels, &Channel{
+				Id:        c.Id,
+				Name:      c.Name,
+				Topic:     firstNonEmpty(c.Topic.Value, c.Purpose.Value),
+				Private:   name == "groups.json",
+				Members:   c.Members,
+				CreatedAt: time.Unix(c.Created, 0).UTC(),
+				messages: func(fn func(msg *Message) error) error {
+					return readSlackMessages(channelId, channelDays, byId, token, fn)
+				},
+			})
+		}
+	}
+
+	return archive, nil
+}
+
+func readSlackMessages(channelId string, days []*zip.File, users map[string]*User, token string, fn func(msg *Message) error) error {
+	for _, day := range days {
+		var messages []*slackMessage
+		err := readZipJson(day, &messages)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", day.Name, err)
+		}
+
+		for _, m := range messages {
+			if m.Type != "message" || !slackSubtypes[m.Subtype] {
+				continue
+			}
+
+			created, err := parseSlackTs(m.Ts)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", day.Name, err)
+			}
+
+			author := users[m.User]
+			if author == nil {
+				id := firstNonEmpty(m.User, m.BotId)
+				author = &User{Id: id, Username: firstNonEmpty(m.Username, id), Bot: m.BotId != ""}
+			}
+
+			msg := &Message{
+				// ts is only unique within a channel
+				Id:     channelId + ":" + m.Ts,
+				Author: author,
+				Text:   slackText(m.Text, users),
+				Time:   created,
+			}
+
+			for _, f := range m.Files {
+				url := firstNonEmpty(f.UrlPrivateDownload, f.UrlPrivate)
+				if url == "" || f.Mode == "tombstone" {
+					continue
+				}
+
+				msg.Attachments = append(msg.Attachments, &Attachment{
+					Id:   f.Id,
+					Name: f.Name,
+					Url:  url,
+					open: func(ctx context.Context) (io.ReadCloser, error) {
+						return download(ctx, url, slackFileToken(url, token))
+					},
+				})
+			}
+
+			err = fn(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// slackFileToken returns token for https links to the Slack file host, the export names the
+// links and the workspace token must not be sent anywhere else
+func slackFileToken(link string, token string) string {
+	target, err := url.Parse(link)
+	if err != nil || target.Scheme != "https" || target.Hostname() != slackFileHost {
+		return ""
+	}
+	return token
+}
+
+// parseSlackTs reads a message ts such as 1599999999.000200
+func parseSlackTs(ts string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(ts, ".")
+	seconds, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid ts %q", ts)
+	}
+
+	var micros int64
+	if frac != "" {
+		micros, err = strconv.ParseInt((frac + "000000")[:6], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid ts %q", ts)
+		}
+	}
+
+	return time.Unix(seconds, micros*1000).UTC(), nil
+}
+
+var slackMarkup = regexp.MustCompile(`<([^<>]+)>`)
+
+var slackEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// slackText turns Slack's markup for mentions and links into plain text
+func slackText(text string, users map[string]*User) string {
+	text = slackMarkup.ReplaceAllStringFunc(text, func(match string) string {
+		target, label, _ := strings.Cut(match[1:len(match)-1], "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if user := users[target[1:]]; user != nil {
+				return "@" + user.Username
+			}
+			return "@" + firstNonEmpty(label, target[1:])
+		case strings.HasPrefix(target, "#"):
+			return "#" + firstNonEmpty(label, target[1:])
+		case strings.HasPrefix(target, "!"):
+			if label != "" {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!")
+		}
+
+		target = strings.TrimPrefix(target, "mailto:")
+		if label == "" || label == target {
+			return target
+		}
+		return label + " (" + target + ")"
+	})
+
+	return slackEntities.Replace(text)
+}
+
+func readZipJson(file *zip.File, v interface{}) error {
+	if file == nil {
+		return fmt.Errorf("file missing")
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return json.NewDecoder(reader).Decode(v)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
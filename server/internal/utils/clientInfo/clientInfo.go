@@ -0,0 +1,115 @@
+package clientinfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+type contextKey string
+
+const ipKey contextKey = "clientIp"
+
+// ParseProxies reads trusted proxies given as addresses or CIDR ranges
+func ParseProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ResolveIp returns the client address of a request. X-Forwarded-For is only read when the
+// connection comes from a trusted proxy, then the hops are walked from the right and the first
+// one that is not a trusted proxy is the client, so a client can't put its own address in front.
+func ResolveIp(r *http.Request, trusted []netip.Prefix) string {
+	remote := remoteIp(r)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrusted(addr, trusted) {
+		return remote
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+
+		addr = hop.Unmap()
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WithIp stores the resolved client address of a request
+func WithIp(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipKey, ip)
+}
+
+// GetIp returns the client address resolved by the ClientIp middleware, or the address of the
+// connection. X-Forwarded-For is never read here, it is set by the client unless a trusted proxy
+// is in front.
+func GetIp(r *http.Request) string {
+	if ip, ok := r.Context().Value(ipKey).(string); ok {
+		return ip
+	}
+	return remoteIp(r)
+}
+
+// NewLoginSession builds the device info stored with a login session
+func NewLoginSession(r *http.Request, deviceName string) *models.LoginSession {
+	if deviceName == "" {
+		deviceName = "Unknown device"
+	}
+
+	return &models.LoginSession{
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		Ip:         GetIp(r),
+	}
+}
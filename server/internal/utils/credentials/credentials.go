@@ -0,0 +1,79 @@
+package credentials
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gauravst/real-time-chat/internal/config"
+)
+
+// Error is returned when a username or password breaks the rules
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...any) error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{2,31}$`)
+
+// reservedPrefixes are used for generated guest and anonymized account names
+var reservedPrefixes = []string{"user_", "deleted_"}
+
+// ValidateUsername checks a username is 3-32 characters of letters, digits, "_", "." or "-"
+// and starts with a letter or digit
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return invalid("username must be 3-32 characters, start with a letter or digit and only contain letters, digits, _ . -")
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(strings.ToLower(username), prefix) {
+			return invalid("username can not start with %s", prefix)
+		}
+	}
+	return nil
+}
+
+// ValidatePassword checks a password against the configured policy
+func ValidatePassword(password string, policy config.PasswordPolicy) error {
+	if len([]rune(password)) < policy.MinLength {
+		return invalid("password must be at least %d characters", policy.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		return invalid("password must contain an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		return invalid("password must contain a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		return invalid("password must contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		return invalid("password must contain a symbol")
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package identicon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// grid is the number of cells per side, the left half is mirrored to the right
+const grid = 5
+
+// Generate returns a symmetric size x size PNG identicon derived from seed,
+// the same seed always gives the same image
+func Generate(seed string, size int) ([]byte, error) {
+	sum := sha256.Sum256([]byte(seed))
+
+	// hue from the hash, fixed saturation and lightness keep colors readable
+	fg := hslToRGB(float64(sum[0])/255*360, 0.55, 0.55)
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+
+	cell := size / (grid + 1)
+	margin := (size - cell*grid) / 2
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+
+	for row := 0; row < grid; row++ {
+		for col := 0; col < (grid+1)/2; col++ {
+			// one bit of the hash per cell
+			bit := row*((grid+1)/2) + col
+			if sum[1+bit/8]>>(bit%8)&1 == 0 {
+				continue
+			}
+
+			fill(img, margin+col*cell, margin+row*cell, cell, fg)
+			fill(img, margin+(grid-1-col)*cell, margin+row*cell, cell, fg)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func fill(img *image.RGBA, x int, y int, size int, c color.RGBA) {
+	draw.Draw(img, image.Rect(x, y, x+size, y+size), &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+func hslToRGB(h float64, s float64, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{R: uint8((r + m) * 255), G: uint8((g + m) * 255), B: uint8((b + m) * 255), A: 255}
+}
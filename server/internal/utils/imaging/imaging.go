@@ -0,0 +1,280 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"slices"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels rejects images that would take too much memory to decode
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupported = errors.New("unsupported image")
+	ErrTooLarge    = errors.New("image is too large")
+)
+
+// Decode reads a png, jpeg, gif or webp image, the size is checked before the pixels are decoded
+func Decode(r io.ReadSeeker) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+
+	return img, format, nil
+}
+
+// Square crops the center of img and scales it to size x size
+func Square(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x, y, x+side, y+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Over, nil)
+	return dst
+}
+
+// Fit scales img down so its longer side is size, images that are smaller keep their size
+func Fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if max(width, height) <= size {
+		return img
+	}
+
+	if width >= height {
+		width, height = size, max(height*size/width, 1)
+	} else {
+		width, height = max(width*size/height, 1), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Orient turns and flips img the way an exif orientation from 2 to 8 asks for
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	// 5 to 8 are turned by a quarter, which swaps the sides
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := x, y
+			switch orientation {
+			case 2:
+				dx = width - 1 - x
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dy = height - 1 - y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// WritePNG encodes img into a new temporary file in dir and returns its path
+func WritePNG(dir string, pattern string, img image.Image) (string, error) {
+	return writeTemp(dir, pattern, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
+
+// WriteJPEG is WritePNG for jpeg, quality goes from 1 to 100
+func WriteJPEG(dir string, pattern string, img image.Image, quality int) (string, error) {
+	return writeTemp(dir, pattern, func(w io.Writer) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	})
+}
+
+// writeTemp creates a temporary file in dir, fills it with encode and returns its path
+func writeTemp(dir string, pattern string, encode func(w io.Writer) error) (string, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	err = encode(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// Processed is an upload after Process. Path is the image without its metadata and Width and
+// Height are its size as it is shown, after the exif orientation.
+type Processed struct {
+	Path     string
+	Format   string
+	Width    int
+	Height   int
+	Variants []*Variant
+}
+
+// Variant is a thumbnail of a processed image
+type Variant struct {
+	Name   string
+	Path   string
+	Width  int
+	Height int
+}
+
+// extensions are the file extensions of the formats Process reads
+var extensions = map[string]string{"jpeg": ".jpg", "png": ".png", "gif": ".gif", "webp": ".webp"}
+
+// Process removes the metadata of the jpeg, png, gif or webp image at path and writes a thumbnail
+// into dir for every named size that is smaller than the image. Files that are no such image
+// return ErrUnsupported. Jpegs with an exif orientation are turned upright and encoded again
+// with quality, everything else keeps its pixels and animation. The thumbnails are jpegs, or
+// pngs when they have transparent pixels, and show the first frame of an animation.
+func Process(path string, dir string, sizes map[string]int, quality int) (*Processed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || extensions[format] == "" {
+		return nil, ErrUnsupported
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = Orientation(data)
+	}
+
+	stripped, err := strip(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// animated webp can't be decoded, it is stored without thumbnails
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil && format != "webp" {
+		return nil, err
+	}
+
+	result := &Processed{Format: format, Width: config.Width, Height: config.Height}
+	if img != nil {
+		img = Orient(img, orientation)
+		result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	if img != nil && orientation > 1 {
+		result.Path, err = WriteJPEG(dir, "image-*.jpg", img, quality)
+	} else {
+		result.Path, err = writeTemp(dir, "image-*"+extensions[format], func(w io.Writer) error {
+			_, err := w.Write(stripped)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if img == nil {
+		return result, nil
+	}
+
+	for name, size := range sizes {
+		if size <= 0 || size >= max(result.Width, result.Height) {
+			continue
+		}
+
+		thumb := Fit(img, size)
+		variant := &Variant{Name: name, Width: thumb.Bounds().Dx(), Height: thumb.Bounds().Dy()}
+		if opaque(thumb) {
+			variant.Path, err = WriteJPEG(dir, "thumb-*.jpg", thumb, quality)
+		} else {
+			variant.Path, err = WritePNG(dir, "thumb-*.png", thumb)
+		}
+		if err != nil {
+			result.Remove()
+			return nil, err
+		}
+
+		result.Variants = append(result.Variants, variant)
+	}
+
+	slices.SortFunc(result.Variants, func(a, b *Variant) int {
+		return a.Width*a.Height - b.Width*b.Height
+	})
+	return result, nil
+}
+
+// Remove deletes the files Process wrote
+func (p *Processed) Remove() {
+	os.Remove(p.Path)
+	for _, variant := range p.Variants {
+		os.Remove(variant.Path)
+	}
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+)
+
+// pngMetadata are the chunks that only carry text, times or exif data
+var pngMetadata = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+// strip removes exif, xmp, comments and other metadata from an encoded image without
+// decoding it, the pixels and the animation of the image are kept as they are
+func strip(data []byte, format string) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJPEG(data)
+	case "png":
+		return stripPNG(data)
+	case "gif":
+		return stripGIF(data)
+	case "webp":
+		return stripWebP(data)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, format)
+}
+
+// jpegSegments calls fn with every marker segment in front of the image data, including
+// its marker and length, and returns the offset of the start of scan
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, fmt.Errorf("invalid jpeg")
+	}
+
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return 0, fmt.Errorf("invalid jpeg")
+		}
+
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			pos++
+			continue
+		case marker == 0xDA:
+			return pos, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, fmt.Errorf("invalid jpeg")
+		}
+
+		fn(marker, data[pos:end])
+		pos = end
+	}
+}
+
+// jpegScans calls fn with every scan, its SOS segment together with the entropy-coded data, and
+// with the segments between the scans of a progressive jpeg. It stops at the EOI marker that
+// ends the image, data after it, such as the MPF images of a camera, is not part of the image.
+func jpegScans(data []byte, sos int, fn func(marker byte, segment []byte)) error {
+	pos := sos
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return fmt.Errorf("invalid jpeg")
+		}
+
+		marker := data[pos+1]
+		switch marker {
+		case 0xFF:
+			// fill byte
+			pos++
+			continue
+		case 0xD9:
+			return nil
+		}
+
+		if pos+4 > len(data) {
+			return fmt.Errorf("invalid jpeg")
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return fmt.Errorf("invalid jpeg")
+		}
+
+		if marker == 0xDA {
+			end = jpegEntropyEnd(data, end)
+		}
+
+		fn(marker, data[pos:end])
+		pos = end
+	}
+}
+
+// jpegEntropyEnd returns the offset of the marker after the entropy-coded data at pos, stuffed
+// 0xFF bytes and restart markers belong to the data
+func jpegEntropyEnd(data []byte, pos int) int {
+	for ; pos+1 < len(data); pos++ {
+		if data[pos] != 0xFF {
+			continue
+		}
+
+		next := data[pos+1]
+		if next == 0x00 || (next >= 0xD0 && next <= 0xD7) {
+			pos++
+			continue
+		}
+		return pos
+	}
+	return len(data)
+}
+
+// stripJPEG drops the app segments and comments, only the JFIF header, the color profile
+// and the Adobe segment that tells how the colors are stored are kept. Everything after the
+// end of the image is dropped, it can hold more images with their own exif data.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+
+	copySegment := func(marker byte, segment []byte) {
+		payload := segment[4:]
+		keep := true
+		switch {
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+		case marker == 0xEE:
+			keep = bytes.HasPrefix(payload, []byte("Adobe"))
+		case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE:
+			keep = false
+		}
+
+		if keep {
+			out = append(out, segment...)
+		}
+	}
+
+	sos, err := jpegSegments(data, copySegment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = jpegScans(data, sos, copySegment)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, 0xFF, 0xD9), nil
+}
+
+// Orientation reads the exif orientation of a jpeg, 1 when it has none
+func Orientation(data []byte) int {
+	orientation := 1
+	jpegSegments(data, func(marker byte, segment []byte) {
+		if marker == 0xE1 && bytes.HasPrefix(segment[4:], exifHeader) {
+			orientation = exifOrientation(segment[4+len(exifHeader):])
+		}
+	})
+	return orientation
+}
+
+// exifOrientation finds the orientation tag in the first directory of the tiff data of an exif segment
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		// a SHORT value sits at the start of the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// stripPNG drops the text, time and exif chunks
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("invalid png")
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	for pos := len(pngSignature); pos+12 <= len(data); {
+		// length, type, data and crc
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if end > len(data) || end < pos {
+			break
+		}
+
+		kind := string(data[pos+4 : pos+8])
+		if !pngMetadata[kind] {
+			out = append(out, data[pos:end]...)
+		}
+		if kind == "IEND" {
+			return out, nil
+		}
+		pos = end
+	}
+	return nil, fmt.Errorf("invalid png")
+}
+
+// stripGIF drops comments and application extensions other than the animation loop count
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, fmt.Errorf("invalid gif")
+	}
+
+	// header, logical screen descriptor and global color table
+	pos := 13 + gifColorTableSize(data[10])
+	if pos > len(data) {
+		return nil, fmt.Errorf("invalid gif")
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:pos]...)
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x3B:
+			return append(out, 0x3B), nil
+
+		case 0x21:
+			if pos+2 > len(data) {
+				return nil, fmt.Errorf("invalid gif")
+			}
+
+			end, err := gifSkipBlocks(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			if keepGIFExtension(data[pos+1], data[pos+2:end]) {
+				out = append(out, data[start:end]...)
+			}
+			pos = end
+
+		case 0x2C:
+			if pos+10 > len(data) {
+				return nil, fmt.Errorf("invalid gif")
+			}
+
+			// image descriptor, local color table and lzw code size
+			end, err := gifSkipBlocks(data, pos+10+gifColorTableSize(data[pos+9])+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data[start:end]...)
+			pos = end
+
+		default:
+			return nil, fmt.Errorf("invalid gif")
+		}
+	}
+
+	// the trailer is left out by some encoders
+	return append(out, 0x3B), nil
+}
+
+func gifColorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << ((flags & 0x07) + 1)
+}
+
+// gifSkipBlocks returns the offset after the data sub-blocks that start at pos
+func gifSkipBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, fmt.Errorf("invalid gif")
+		}
+
+		size := int(data[pos])
+		pos += 1 + size
+		if size == 0 {
+			return pos, nil
+		}
+	}
+}
+
+func keepGIFExtension(label byte, blocks []byte) bool {
+	switch label {
+	case 0xFE:
+		return false
+	case 0xFF:
+		if len(blocks) < 12 || blocks[0] != 11 {
+			return false
+		}
+		app := string(blocks[1:12])
+		return app == "NETSCAPE2.0" || app == "ANIMEXTS1.0"
+	}
+	return true
+}
+
+// stripWebP drops the EXIF and XMP chunks and clears their flags in the extended header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("invalid webp")
+	}
+
+	riffEnd := min(8+int(binary.LittleEndian.Uint32(data[4:])), len(data))
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	for pos := 12; pos < riffEnd; {
+		if pos+8 > riffEnd {
+			return nil, fmt.Errorf("invalid webp")
+		}
+
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if pos+8+size > riffEnd {
+			return nil, fmt.Errorf("invalid webp")
+		}
+		// chunks are padded to an even size
+		end := min(pos+8+size+size&1, riffEnd)
+
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[pos:end]...)
+			if size > 0 {
+				out[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
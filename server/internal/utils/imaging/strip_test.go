@@ -0,0 +1,286 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	_ "golang.org/x/image/webp"
+)
+
+// secret is the location the fixtures carry in their metadata, it must not survive strip
+var secret = []byte("GPS 52.3702N 4.8952E")
+
+// exifPayload is an exif segment with an orientation of 6 and a GPS directory
+func exifPayload() []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	// orientation and the offset of the GPS directory, then no next directory
+	tiff = append(tiff, 0x00, 0x02)
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00)
+	tiff = append(tiff, 0x88, 0x25, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	// GPSLatitudeRef N
+	tiff = append(tiff, 0x00, 0x01)
+	tiff = append(tiff, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x02, 'N', 0x00, 0x00, 0x00)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	tiff = append(tiff, secret...)
+	return append(append([]byte{}, exifHeader...), tiff...)
+}
+
+func testImage() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 16, 12), palette.Plan9)
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 20), 128, 255})
+		}
+	}
+	return img
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegFixture has exif, xmp and a comment in front of the image and a second image with
+// its own exif after it, like the MPF images of a camera
+func jpegFixture(t *testing.T) []byte {
+	plain := encodeJPEG(t)
+
+	data := []byte{0xFF, 0xD8}
+	data = append(data, jpegSegment(0xE1, exifPayload())...)
+	data = append(data, jpegSegment(0xE1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), secret...))...)
+	data = append(data, jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01profile"))...)
+	data = append(data, jpegSegment(0xFE, secret)...)
+	data = append(data, plain[2:]...)
+
+	data = append(data, 0xFF, 0xD8)
+	data = append(data, jpegSegment(0xE1, exifPayload())...)
+	return append(data, plain[2:]...)
+}
+
+func pngChunk(kind string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngFixture has text, exif and time chunks after the header
+func pngFixture(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, testImage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	// signature and IHDR
+	ihdr := len(pngSignature) + 12 + int(binary.BigEndian.Uint32(plain[len(pngSignature):]))
+	data := append([]byte{}, plain[:ihdr]...)
+	data = append(data, pngChunk("tEXt", append([]byte("Comment\x00"), secret...))...)
+	data = append(data, pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), secret...))...)
+	data = append(data, pngChunk("eXIf", exifPayload()[len(exifHeader):])...)
+	data = append(data, pngChunk("tIME", []byte{0x07, 0xE9, 1, 2, 3, 4, 5})...)
+	return append(data, plain[ihdr:]...)
+}
+
+// gifFixture is an animation with a comment and an xmp application extension
+func gifFixture(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{testImage(), testImage()}, Delay: []int{10, 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	pos := 13 + gifColorTableSize(plain[10])
+	data := append([]byte{}, plain[:pos]...)
+	data = append(data, 0x21, 0xFE, byte(len(secret)))
+	data = append(data, secret...)
+	data = append(data, 0x00)
+	data = append(data, 0x21, 0xFF, 11)
+	data = append(data, "XMP DataXMP"...)
+	data = append(data, byte(len(secret)))
+	data = append(data, secret...)
+	data = append(data, 0x00)
+	return append(data, plain[pos:]...)
+}
+
+// webpLossless is a 1x1 lossless webp
+const webpLossless = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+func webpChunk(kind string, payload []byte) []byte {
+	chunk := append([]byte(kind), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpFixture is an extended webp with exif and xmp chunks and their flags set
+func webpFixture(t *testing.T) []byte {
+	plain, err := base64.StdEncoding.DecodeString(webpLossless)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flags, reserved bytes and the canvas size minus one
+	vp8x := []byte{0x08 | 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	data = append(data, webpChunk("VP8X", vp8x)...)
+	data = append(data, plain[12:]...)
+	data = append(data, webpChunk("EXIF", exifPayload()[len(exifHeader):])...)
+	data = append(data, webpChunk("XMP ", secret)...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		format string
+		data   []byte
+		// keep must still be in the output
+		keep []string
+	}{
+		{"jpeg", jpegFixture(t), []string{"ICC_PROFILE"}},
+		{"png", pngFixture(t), []string{"IHDR", "IDAT", "IEND"}},
+		{"gif", gifFixture(t), []string{"NETSCAPE2.0"}},
+		{"webp", webpFixture(t), []string{"VP8X", "VP8L"}},
+	}
+
+	for _, test := range tests {
+		if !bytes.Contains(test.data, secret) {
+			t.Fatalf("%s: fixture has no metadata", test.format)
+		}
+
+		out, err := strip(test.data, test.format)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+
+		if bytes.Contains(out, secret) || bytes.Contains(out, []byte("Exif")) {
+			t.Errorf("%s: metadata survived strip", test.format)
+		}
+		for _, keep := range test.keep {
+			if !bytes.Contains(out, []byte(keep)) {
+				t.Errorf("%s: %s was removed", test.format, keep)
+			}
+		}
+
+		img, format, err := image.Decode(bytes.NewReader(out))
+		if err != nil || format != test.format {
+			t.Fatalf("%s: stripped image does not decode: %s, %v", test.format, format, err)
+		}
+
+		// stripping again changes nothing
+		again, err := strip(out, test.format)
+		if err != nil || !bytes.Equal(again, out) {
+			t.Errorf("%s: stripping a stripped image changed it: %v", test.format, err)
+		}
+
+		if test.format == "webp" {
+			if out[20]&(0x08|0x04) != 0 {
+				t.Errorf("webp: exif and xmp flags are still set: %08b", out[20])
+			}
+			if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+				t.Errorf("webp: riff size %d, want %d", size, len(out)-8)
+			}
+		}
+		if test.format == "gif" {
+			if n := len(img.(*image.Paletted).Pix); n == 0 {
+				t.Errorf("gif: first frame is empty")
+			}
+		}
+	}
+}
+
+func TestStripJPEGEndsAtPrimaryImage(t *testing.T) {
+	plain := encodeJPEG(t)
+	out, err := strip(jpegFixture(t), "jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasSuffix(out, []byte{0xFF, 0xD9}) || bytes.Count(out, []byte{0xFF, 0xD8}) != 1 {
+		t.Errorf("output does not end with the primary image")
+	}
+	if len(out) >= 2*len(plain) {
+		t.Errorf("output has %d bytes, the second image was kept", len(out))
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	if got := Orientation(jpegFixture(t)); got != 6 {
+		t.Errorf("orientation = %d, want 6", got)
+	}
+	if got := Orientation(encodeJPEG(t)); got != 1 {
+		t.Errorf("orientation without exif = %d, want 1", got)
+	}
+}
+
+func TestStripTruncated(t *testing.T) {
+	jpegData := jpegFixture(t)
+	pngData := pngFixture(t)
+	gifData := gifFixture(t)
+	webpData := webpFixture(t)
+
+	plainJPEG := encodeJPEG(t)
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+	}{
+		{"jpeg header only", "jpeg", jpegData[:2]},
+		{"jpeg inside a segment", "jpeg", jpegData[:10]},
+		{"jpeg without end of image", "jpeg", plainJPEG[:len(plainJPEG)-2]},
+		{"jpeg inside the scan", "jpeg", plainJPEG[:len(plainJPEG)/2]},
+		{"not a jpeg", "jpeg", pngData},
+		{"png signature only", "png", pngData[:len(pngSignature)]},
+		{"png without end", "png", pngData[:len(pngData)-12]},
+		{"png inside a chunk", "png", pngData[:len(pngData)/2]},
+		{"gif header only", "gif", gifData[:6]},
+		{"gif inside the color table", "gif", gifData[:20]},
+		{"gif inside an image descriptor", "gif", gifData[:13+gifColorTableSize(gifData[10])+4]},
+		{"webp header only", "webp", webpData[:8]},
+		{"webp inside a chunk header", "webp", webpData[:16]},
+		{"webp inside a chunk", "webp", webpData[:40]},
+	}
+
+	for _, test := range tests {
+		if _, err := strip(test.data, test.format); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+
+	// no prefix of a fixture makes strip panic
+	for _, data := range []struct {
+		format string
+		data   []byte
+	}{{"jpeg", jpegData}, {"png", pngData}, {"gif", gifData}, {"webp", webpData}} {
+		for i := range data.data {
+			strip(data.data[:i], data.format)
+		}
+	}
+}
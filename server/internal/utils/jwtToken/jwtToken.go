@@ -11,58 +11,66 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func VerifyJwtAndGetData[T any](jwtToken string, key string) (*T, error) {
-	token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
-		// Ensure the token uses the correct signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		// Convert key (string) to []byte for HS256
-		return []byte(key), nil
-	})
+// RefreshTokenPath is the only path the refreshToken cookie is sent to
+const RefreshTokenPath = "/api/auth/refresh"
 
-	// Extract claims regardless of token validity
-	var claims jwt.MapClaims
-	if token != nil {
-		if data, ok := token.Claims.(jwt.MapClaims); ok {
-			claims = data
-		}
-	}
+// audiences of the tokens that only this server reads, access tokens use the configured audience
+const (
+	AudienceTwoFactor = "2fa"
+	AudienceOIDCState = "oidc_state"
+)
 
-	// Convert claims into JSON and then unmarshal into struct T
-	jsonData, _ := json.Marshal(claims)
-	var result T
-	errUnmarshal := json.Unmarshal(jsonData, &result)
+// VerifyJwtAndGetData verifies a token of the issuer of keys that was made for audience and
+// reads its claims into T
+func VerifyJwtAndGetData[T any](jwtToken string, audience string, keys *KeySet) (*T, error) {
+	// the key is picked by kid, only asymmetric algorithms are accepted
+	token, err := jwt.Parse(jwtToken, keys.keyFunc, jwt.WithValidMethods([]string{
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodEdDSA.Alg(),
+	}), jwt.WithIssuer(keys.issuer), jwt.WithAudience(audience))
 
-	// Check if there's an error, but still return claims if possible
+	// claims of a token that failed verification are never returned
 	if err != nil {
-		// If token expired, return claims with specific error
 		if errors.Is(err, jwt.ErrSignatureInvalid) {
 			return nil, fmt.Errorf("invalid token signature")
 		}
-		if claims != nil {
-			return &result, fmt.Errorf("token has expired")
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, fmt.Errorf("token has expired")
 		}
 		return nil, err
 	}
 
-	// Handle potential JSON unmarshal errors separately
-	if errUnmarshal != nil {
-		return nil, errUnmarshal
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims type")
+	}
+
+	// Convert claims into JSON and then unmarshal into struct T
+	jsonData, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var result T
+	err = json.Unmarshal(jsonData, &result)
+	if err != nil {
+		return nil, err
 	}
 
 	return &result, nil
 }
 
-func CreateNewToken(data interface{}, key string) (string, error) {
+// CreateNewToken signs claims for audience with the current signing key of keys, the token
+// names the issuer of keys
+func CreateNewToken(data interface{}, audience string, keys *KeySet) (string, error) {
 	claims, ok := data.(jwt.MapClaims)
 	if !ok {
 		return "", errors.New("invalid claims type")
 	}
+	claims["iss"] = keys.issuer
+	claims["aud"] = audience
 
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
-	tokenString, err := token.SignedString(key)
-
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -99,6 +107,68 @@ func RemoveAccessToken(w http.ResponseWriter, r *http.Request, secure bool) {
 	})
 }
 
+// SetRefreshToken sets the refreshToken cookie, it is only sent to the refresh endpoint
+func SetRefreshToken(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time, secure bool) {
+	isLocal := isLocalRequest(r)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refreshToken",
+		Value:    token,
+		Path:     RefreshTokenPath,
+		HttpOnly: true,
+		Secure:   getSecureSetting(isLocal, secure),
+		SameSite: getSameSiteMode(isLocal),
+		Expires:  expiresAt,
+	})
+}
+
+// RemoveRefreshToken removes the refreshToken cookie
+func RemoveRefreshToken(w http.ResponseWriter, r *http.Request, secure bool) {
+	isLocal := isLocalRequest(r)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refreshToken",
+		Value:    "",
+		Path:     RefreshTokenPath,
+		HttpOnly: true,
+		Secure:   getSecureSetting(isLocal, secure),
+		SameSite: getSameSiteMode(isLocal),
+		MaxAge:   -1, // Expire immediately
+		Expires:  time.Unix(0, 0),
+	})
+}
+
+// SetOIDCState sets the short lived cookie that carries the login state to the OIDC callback
+func SetOIDCState(w http.ResponseWriter, r *http.Request, token string, secure bool) {
+	isLocal := isLocalRequest(r)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidcState",
+		Value:    token,
+		Path:     "/api/auth/oidc/",
+		HttpOnly: true,
+		Secure:   getSecureSetting(isLocal, secure),
+		SameSite: http.SameSiteLaxMode, // sent on the redirect back from the provider
+		MaxAge:   600,
+	})
+}
+
+// RemoveOIDCState removes the oidcState cookie
+func RemoveOIDCState(w http.ResponseWriter, r *http.Request, secure bool) {
+	isLocal := isLocalRequest(r)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidcState",
+		Value:    "",
+		Path:     "/api/auth/oidc/",
+		HttpOnly: true,
+		Secure:   getSecureSetting(isLocal, secure),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1, // Expire immediately
+		Expires:  time.Unix(0, 0),
+	})
+}
+
 // isLocalRequest checks if the request is from localhost
 func isLocalRequest(r *http.Request) bool {
 	host := r.Host
@@ -0,0 +1,216 @@
+package jwtToken
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted for signing or verifying
+const minRSABits = 2048
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for keys that are only kept to verify old tokens
+	public  crypto.PublicKey
+}
+
+// KeySet holds the keys tokens are verified with, one of them signs new tokens.
+// Every token carries the kid of its key so keys can be rotated while older tokens are still valid,
+// and the issuer so other services that trust the keys can tell our tokens apart.
+type KeySet struct {
+	issuer  string
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet reads every *.pem file in dir, the file name without extension is the kid.
+// Private keys (PKCS#8, or PKCS#1 for RSA) can sign, public keys (PKIX) only verify.
+// signingKeyId picks the signing key, when empty the last private key by name is used,
+// so naming keys by date rotates to the newest one. Tokens are issued as issuer.
+func LoadKeySet(dir string, signingKeyId string, issuer string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no jwt keys found in %s", dir)
+	}
+
+	sort.Strings(files)
+	keySet := &KeySet{issuer: issuer, keys: make(map[string]*signingKey)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", kid, err)
+		}
+
+		keySet.keys[kid] = key
+		if key.private != nil && signingKeyId == "" {
+			keySet.signing = key
+		}
+	}
+
+	if signingKeyId != "" {
+		keySet.signing = keySet.keys[signingKeyId]
+	}
+
+	if keySet.signing == nil || keySet.signing.private == nil {
+		return nil, fmt.Errorf("no private jwt key to sign with")
+	}
+
+	return keySet, nil
+}
+
+// GenerateKeySet creates a single Ed25519 key in memory, tokens stop working on restart
+func GenerateKeySet(issuer string) (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		id:      "ephemeral",
+		method:  jwt.SigningMethodEdDSA,
+		private: private,
+		public:  public,
+	}
+
+	return &KeySet{
+		issuer:  issuer,
+		signing: key,
+		keys:    map[string]*signingKey{key.id: key},
+	}, nil
+}
+
+// Sign creates a token signed with the current signing key
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+
+	return token.SignedString(k.signing.private)
+}
+
+// keyFunc picks the verification key by kid and makes sure the alg belongs to that key
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+// JWKS returns the public keys so other services can verify tokens
+func (k *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+func parseKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: kid}
+	switch value := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, value, &value.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, value
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, value, value.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, value
+	default:
+		return nil, fmt.Errorf("only RSA and Ed25519 keys are supported")
+	}
+
+	if public, ok := key.public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("rsa key must be at least %d bits", minRSABits)
+	}
+
+	return key, nil
+}
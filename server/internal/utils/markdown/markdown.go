@@ -0,0 +1,597 @@
+// Package markdown renders the Markdown subset of chat messages to HTML. HTML in a message is
+// never passed through, all text is escaped and only these tags are created:
+//
+//	**bold** or __bold__      <strong>
+//	*italic* or _italic_      <em>
+//	`code`                    <code>
+//	```go                     <pre><code class="language-go">
+//	[text](https://...)       <a>, bare http and https links too
+//	- item or 1. item         <ul> and <ol>
+//	> quote                   <blockquote>
+//
+// Line breaks inside a paragraph are kept as <br>. Other Markdown such as headings, images and
+// tables stays plain text.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxDepth limits nested quotes, lists and emphasis, deeper markers are left as text
+	maxDepth = 8
+	// maxUrlLength keeps a [ without a link target from being searched to the end of the message
+	maxUrlLength = 2048
+)
+
+// Render returns the sanitized HTML of a message
+func Render(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\x00", "\uFFFD")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = expandIndent(line)
+	}
+
+	var b strings.Builder
+	renderBlocks(&b, lines, 0, false)
+	return b.String()
+}
+
+// renderBlocks renders lines as paragraphs, code blocks, quotes and lists. bare leaves out
+// the <p> around paragraphs, for the items of tight lists.
+func renderBlocks(b *strings.Builder, lines []string, depth int, bare bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case isFence(line):
+			i = renderCode(b, lines, i)
+		case depth < maxDepth && isQuote(line):
+			i = renderQuote(b, lines, i, depth)
+		case depth < maxDepth && parseItem(line) != nil:
+			i = renderList(b, lines, i, depth)
+		default:
+			i = renderParagraph(b, lines, i, depth, bare)
+		}
+	}
+}
+
+func renderParagraph(b *strings.Builder, lines []string, i int, depth int, bare bool) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if len(text) > 0 && interruptsParagraph(line, depth) {
+			break
+		}
+		text = append(text, strings.TrimSpace(line))
+	}
+
+	if !bare {
+		b.WriteString("<p>")
+	}
+	renderInline(b, strings.Join(text, "\n"), 0, true)
+	if !bare {
+		b.WriteString("</p>")
+	}
+	return i
+}
+
+// interruptsParagraph is true for lines that end a paragraph. Only lists starting at 1 do,
+// so a sentence wrapped before "2020." stays one paragraph.
+func interruptsParagraph(line string, depth int) bool {
+	if isBlank(line) || isFence(line) {
+		return true
+	}
+	if depth >= maxDepth {
+		return false
+	}
+	if isQuote(line) {
+		return true
+	}
+
+	item := parseItem(line)
+	return item != nil && (!item.ordered || item.number == 1)
+}
+
+var fencePattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})(.*)$")
+
+var languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+
+func isFence(line string) bool {
+	match := fencePattern.FindStringSubmatch(line)
+	return match != nil && !(match[1][0] == '`' && strings.Contains(match[2], "`"))
+}
+
+// renderCode renders a fenced code block, a block that is never closed runs to the end
+func renderCode(b *strings.Builder, lines []string, i int) int {
+	match := fencePattern.FindStringSubmatch(lines[i])
+	fence := match[1]
+
+	language := ""
+	if fields := strings.Fields(match[2]); len(fields) > 0 && languagePattern.MatchString(fields[0]) {
+		language = fields[0]
+	}
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		closing := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+
+	if language != "" {
+		b.WriteString(`<pre><code class="language-` + language + `">`)
+	} else {
+		b.WriteString("<pre><code>")
+	}
+	b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+	b.WriteString("</code></pre>")
+	return i
+}
+
+var quotePattern = regexp.MustCompile(`^ {0,3}> ?`)
+
+func isQuote(line string) bool {
+	return quotePattern.MatchString(line)
+}
+
+func renderQuote(b *strings.Builder, lines []string, i int, depth int) int {
+	var quoted []string
+	for ; i < len(lines) && isQuote(lines[i]); i++ {
+		line := lines[i]
+		quoted = append(quoted, line[len(quotePattern.FindString(line)):])
+	}
+
+	b.WriteString("<blockquote>")
+	renderBlocks(b, quoted, depth+1, false)
+	b.WriteString("</blockquote>")
+	return i
+}
+
+var itemPattern = regexp.MustCompile(`^( {0,3})([-*+]|(\d{1,9})([.)])) +(\S.*)$`)
+
+// item is the first line of a list item
+type item struct {
+	ordered bool
+	// marker is the bullet, or the delimiter after the number
+	marker string
+	number int
+	// indent is where the text starts, the lines of the item are indented at least as far
+	indent int
+	text   string
+}
+
+func parseItem(line string) *item {
+	match := itemPattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		return nil
+	}
+
+	data := &item{marker: line[match[4]:match[5]], indent: match[10], text: line[match[10]:]}
+	if match[6] != -1 {
+		data.ordered = true
+		data.number, _ = strconv.Atoi(line[match[6]:match[7]])
+		data.marker = line[match[8]:match[9]]
+	}
+	return data
+}
+
+func (it *item) sameList(other *item) bool {
+	return other != nil && other.ordered == it.ordered && other.marker == it.marker
+}
+
+// renderList renders the items that follow each other with the same kind of marker,
+// lines indented under an item belong to it
+func renderList(b *strings.Builder, lines []string, i int, depth int) int {
+	first := parseItem(lines[i])
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+
+	if first.ordered && first.number != 1 {
+		b.WriteString(`<ol start="` + strconv.Itoa(first.number) + `">`)
+	} else {
+		b.WriteString("<" + tag + ">")
+	}
+
+	for i < len(lines) {
+		current := parseItem(lines[i])
+		if !first.sameList(current) {
+			break
+		}
+
+		itemLines := []string{current.text}
+		loose := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if !isBlank(line) {
+				if indentOf(line) < current.indent {
+					break
+				}
+				itemLines = append(itemLines, line[current.indent:])
+				continue
+			}
+
+			// blank lines stay in the item when it goes on after them
+			next := i
+			for next < len(lines) && isBlank(lines[next]) {
+				next++
+			}
+			if next == len(lines) || indentOf(lines[next]) < current.indent {
+				break
+			}
+
+			for ; i < next; i++ {
+				itemLines = append(itemLines, "")
+			}
+			i--
+			loose = true
+		}
+
+		b.WriteString("<li>")
+		renderBlocks(b, itemLines, depth+1, !loose)
+		b.WriteString("</li>")
+
+		// the list goes on after blank lines when the next item follows
+		next := i
+		for next < len(lines) && isBlank(lines[next]) {
+			next++
+		}
+		if next == len(lines) || !first.sameList(parseItem(lines[next])) {
+			break
+		}
+		i = next
+	}
+
+	b.WriteString("</" + tag + ">")
+	return i
+}
+
+// renderInline renders the text of a paragraph: emphasis, code spans, links and line breaks.
+// links is false inside link text, links can't be nested.
+func renderInline(b *strings.Builder, s string, depth int, links bool) {
+	// searches that found nothing are not repeated, a later search would cover less text
+	missing := map[string]bool{}
+	bracket, target, linkEnd := -1, "", -1
+
+	plain := 0
+	flush := func(end int) {
+		b.WriteString(html.EscapeString(s[plain:end]))
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			flush(i)
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			plain = i
+			continue
+
+		case c == '\n':
+			flush(i)
+			b.WriteString("<br>")
+			i++
+			plain = i
+			continue
+
+		case c == '`':
+			run := runLength(s, i, '`')
+			fence := s[i : i+run]
+			if !missing[fence] {
+				if end := findCodeEnd(s, i+run, run); end != -1 {
+					flush(i)
+					code := s[i+run : end]
+					if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+						code = code[1 : len(code)-1]
+					}
+					b.WriteString("<code>" + html.EscapeString(strings.ReplaceAll(code, "\n", " ")) + "</code>")
+					i = end + run
+					plain = i
+					continue
+				}
+				missing[fence] = true
+			}
+			i += run
+			continue
+
+		case (c == '*' || c == '_') && depth < maxDepth:
+			run := runLength(s, i, c)
+			if canOpen(s, i, run, c) {
+				if end, size := findEmphasis(s, i, run, c, missing); end != -1 {
+					flush(i)
+					tag := "em"
+					if size == 2 {
+						tag = "strong"
+					}
+					b.WriteString("<" + tag + ">")
+					renderInline(b, s[i+size:end], depth+1, links)
+					b.WriteString("</" + tag + ">")
+					i = end + size
+					plain = i
+					continue
+				}
+			}
+			i += run
+			continue
+
+		case c == '[' && links:
+			// links starting before the same ] all end there, so each ] is only looked up once
+			if bracket < i {
+				bracket, target, linkEnd = parseLink(s, i)
+			}
+
+			href, ok := safeUrl(target)
+			if linkEnd == -1 || !ok {
+				i++
+				continue
+			}
+
+			flush(i)
+			b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer">`)
+			renderInline(b, s[i+1:bracket], depth+1, false)
+			b.WriteString("</a>")
+			i = linkEnd
+			plain = i
+			continue
+
+		case c == 'h' && links && (i == 0 || !isWord(s[i-1])):
+			end := autolinkEnd(s, i)
+			if end == -1 {
+				i++
+				continue
+			}
+
+			flush(i)
+			link := s[i:end]
+			b.WriteString(`<a href="` + html.EscapeString(link) + `" rel="nofollow noopener noreferrer">` + html.EscapeString(link) + "</a>")
+			i = end
+			plain = i
+			continue
+		}
+
+		i++
+	}
+
+	flush(len(s))
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// findCodeEnd returns where the backticks closing a code span of run backticks start
+func findCodeEnd(s string, i int, run int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j == -1 {
+			return -1
+		}
+
+		i += j
+		n := runLength(s, i, '`')
+		if n == run {
+			return i
+		}
+		i += n
+	}
+	return -1
+}
+
+// canOpen is true when the delimiter run at i is followed by text, an underscore inside
+// a word like snake_case doesn't open
+func canOpen(s string, i int, run int, c byte) bool {
+	if i+run >= len(s) || isSpace(s[i+run]) {
+		return false
+	}
+	return c != '_' || i == 0 || !isWord(s[i-1])
+}
+
+// findEmphasis returns where the emphasis opened by the delimiter run at i closes and how many
+// delimiters it uses, strong emphasis is tried first. Delimiters without a closer are added to missing.
+func findEmphasis(s string, i int, run int, c byte, missing map[string]bool) (int, int) {
+	for _, size := range []int{2, 1} {
+		delimiter := strings.Repeat(string(c), size)
+		if run < size || missing[delimiter] {
+			continue
+		}
+
+		end := findCloser(s, i+size, c, size)
+		if end != -1 {
+			return end, size
+		}
+		missing[delimiter] = true
+	}
+	return -1, 0
+}
+
+// findCloser returns where size delimiters c closing the emphasis start, searching from i.
+// The closer is the end of a run that follows text.
+func findCloser(s string, i int, c byte, size int) int {
+	for j := i; j < len(s); {
+		switch s[j] {
+		case '\\':
+			j += 2
+		case c:
+			run := runLength(s, j, c)
+			end := j + run
+			closer := end - size
+			if run >= size && closer > i && !isSpace(s[closer-1]) && (c != '_' || end == len(s) || !isWord(s[end])) {
+				return closer
+			}
+			j = end
+		default:
+			j++
+		}
+	}
+	return -1
+}
+
+// parseLink reads [text](target) at i. It returns the position of the ] ending the text, or
+// len(s) when there is none, and the position after the link, or -1 when it isn't a link.
+func parseLink(s string, i int) (text int, target string, end int) {
+	text = len(s)
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+		} else if s[j] == ']' {
+			text = j
+			break
+		}
+	}
+
+	if text+1 >= len(s) || s[text+1] != '(' {
+		return text, "", -1
+	}
+
+	open := 0
+	for j := text + 2; j < len(s) && j < text+2+maxUrlLength; j++ {
+		switch {
+		case isSpace(s[j]):
+			return text, "", -1
+		case s[j] == '(':
+			open++
+		case s[j] == ')':
+			if open == 0 {
+				return text, s[text+2 : j], j + 1
+			}
+			open--
+		}
+	}
+	return text, "", -1
+}
+
+// safeUrl only allows http, https and mailto links, so javascript: and data: urls are shown as text
+func safeUrl(raw string) (string, bool) {
+	link, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(link.Scheme) {
+	case "http", "https":
+		return raw, link.Host != ""
+	case "mailto":
+		return raw, link.Opaque != ""
+	}
+	return "", false
+}
+
+// autolinkEnd returns the end of a bare http or https link at i, or -1. Punctuation at the end
+// belongs to the sentence and a closing parenthesis only to the link when it opened one.
+func autolinkEnd(s string, i int) int {
+	rest := s[i:]
+	scheme := ""
+	for _, prefix := range []string{"https://", "http://"} {
+		if strings.HasPrefix(rest, prefix) {
+			scheme = prefix
+			break
+		}
+	}
+	if scheme == "" {
+		return -1
+	}
+
+	end := i
+	for end < len(s) && !isSpace(s[end]) && s[end] != '<' && s[end] != '>' && s[end] != '"' && s[end] != '`' {
+		end++
+	}
+
+	for end > i+len(scheme) {
+		last := s[end-1]
+		if strings.IndexByte(".,:;!?'*_", last) != -1 {
+			end--
+			continue
+		}
+		if last == ')' && strings.Count(s[i:end], "(") < strings.Count(s[i:end], ")") {
+			end--
+			continue
+		}
+		break
+	}
+
+	if end == i+len(scheme) {
+		return -1
+	}
+	if _, ok := safeUrl(s[i:end]); !ok {
+		return -1
+	}
+	return end
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// expandIndent turns tabs in the indent of a line into spaces, to the next multiple of 4
+func expandIndent(line string) string {
+	if !strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+		return line
+	}
+
+	width := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return strings.Repeat(" ", width) + line[i:]
+		}
+	}
+	return ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// isWord is true for letters and digits, bytes of other scripts count as letters
+func isWord(c byte) bool {
+	return c >= 0x80 || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isPunct(c byte) bool {
+	return c < 0x80 && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
+
+var hrefPattern = regexp.MustCompile(`<a href="([^"]*)"`)
+
+// Links returns the http and https links of a message once each, in the order Render links them.
+// Urls in code are not links.
+func Links(text string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, match := range hrefPattern.FindAllStringSubmatch(Render(text), -1) {
+		link := html.UnescapeString(match[1])
+		if seen[link] || !strings.HasPrefix(strings.ToLower(link), "http") {
+			continue
+		}
+
+		seen[link] = true
+		links = append(links, link)
+	}
+	return links
+}
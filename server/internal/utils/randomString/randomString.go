@@ -1,18 +1,31 @@
 package randomstring
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
 )
 
-func GenerateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-	result := make([]byte, length)
-	for i := range result {
-		result[i] = charset[seededRand.Intn(len(charset))]
+// GenerateRandomString returns length alphanumeric characters from crypto/rand
+func GenerateRandomString(length int) (string, error) {
+	// bytes above the largest multiple of len(charset) are skipped so every character is equally likely
+	limit := byte(256 - 256%len(charset))
+
+	result := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(result) < length {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if b >= limit || len(result) == length {
+				continue
+			}
+			result = append(result, charset[int(b)%len(charset)])
+		}
 	}
-	return string(result)
 
+	return string(result), nil
 }
@@ -0,0 +1,30 @@
+package slug
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaxLength keeps slugs readable in urls
+const MaxLength = 64
+
+var (
+	separators = regexp.MustCompile(`[^a-z0-9]+`)
+	valid      = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Make turns a display name into a slug of lowercase letters, digits and single dashes.
+// It returns an empty string when the name has none of those characters.
+func Make(name string) string {
+	s := separators.ReplaceAllString(strings.ToLower(name), "-")
+	s = strings.Trim(s, "-")
+	if len(s) > MaxLength {
+		s = strings.TrimRight(s[:MaxLength], "-")
+	}
+	return s
+}
+
+// Valid reports whether s could have been returned by Make
+func Valid(s string) bool {
+	return len(s) <= MaxLength && valid.MatchString(s)
+}
@@ -0,0 +1,84 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts failures per key inside a sliding window and blocks a key
+// once it reached the maximum
+type Limiter struct {
+	mutex    sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string][]time.Time
+	swept    time.Time
+}
+
+func New(max int, window time.Duration) *Limiter {
+	return &Limiter{
+		max:      max,
+		window:   window,
+		failures: make(map[string][]time.Time),
+	}
+}
+
+// Allowed reports whether key may try again
+func (l *Limiter) Allowed(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep()
+	return len(l.prune(key)) < l.max
+}
+
+// Fail records a failed attempt for key
+func (l *Limiter) Fail(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep()
+	l.failures[key] = append(l.prune(key), time.Now())
+}
+
+// Reset forgets the failures of key, e.g. after a successful attempt
+func (l *Limiter) Reset(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.failures, key)
+}
+
+// sweep prunes every key once per window, so keys that are never used again don't stay in
+// the map. The caller holds the lock.
+func (l *Limiter) sweep() {
+	now := time.Now()
+	if now.Sub(l.swept) < l.window {
+		return
+	}
+	l.swept = now
+
+	for key := range l.failures {
+		l.prune(key)
+	}
+}
+
+// prune drops failures older than the window, the caller holds the lock
+func (l *Limiter) prune(key string) []time.Time {
+	cutoff := time.Now().Add(-l.window)
+	failures := l.failures[key]
+
+	i := 0
+	for i < len(failures) && failures[i].Before(cutoff) {
+		i++
+	}
+	failures = failures[i:]
+
+	if len(failures) == 0 {
+		delete(l.failures, key)
+		return nil
+	}
+
+	l.failures[key] = failures
+	return failures
+}
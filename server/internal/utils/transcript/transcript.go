@@ -0,0 +1,188 @@
+package transcript
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+)
+
+// Writer writes the messages of a room one by one in an export format
+type Writer interface {
+	WriteMessage(msg *models.MessageResponse) error
+	// Close writes what follows the last message, it does not close the underlying writer
+	Close() error
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+// NewJSONL writes one JSON object per line
+func NewJSONL(w io.Writer) Writer {
+	return &jsonlWriter{enc: json.NewEncoder(w)}
+}
+
+func (t *jsonlWriter) WriteMessage(msg *models.MessageResponse) error {
+	return t.enc.Encode(msg)
+}
+
+func (t *jsonlWriter) Close() error {
+	return nil
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// NewCSV writes a header row and a row per message
+func NewCSV(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (t *csvWriter) WriteMessage(msg *models.MessageResponse) error {
+	if !t.wroteHeader {
+		t.wroteHeader = true
+		err := t.w.Write([]string{"id", "type", "createdAt", "userId", "username", "content", "fileName", "fileUrl", "redactedAt"})
+		if err != nil {
+			return err
+		}
+	}
+
+	var fileName, fileUrl, redactedAt string
+	if msg.File != nil {
+		fileName = msg.File.OriginalFilename
+		fileUrl = msg.File.SecureUrl
+	}
+	if msg.RedactedAt != nil {
+		redactedAt = msg.RedactedAt.UTC().Format(time.RFC3339)
+	}
+
+	return t.w.Write([]string{
+		strconv.Itoa(msg.Id),
+		msg.Type,
+		msg.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.Itoa(msg.UserId),
+		csvCell(msg.Username),
+		csvCell(msg.Content),
+		csvCell(fileName),
+		fileUrl,
+		redactedAt,
+	})
+}
+
+func (t *csvWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// csvCell keeps spreadsheets from running user text as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+var htmlHead = template.Must(template.New("head").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+.message { padding: 0.5rem 0; border-bottom: 1px solid #eee; }
+.meta { color: #777; font-size: 0.85rem; }
+.system { font-style: italic; color: #555; }
+.content p { margin: 0.25rem 0; }
+.content pre { background: #f5f5f5; padding: 0.5rem; overflow-x: auto; }
+.content blockquote { margin: 0.25rem 0; padding-left: 0.75rem; border-left: 3px solid #ddd; color: #555; }
+img { max-width: 100%; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+`))
+
+var htmlMessage = template.Must(template.New("message").Parse(`<div class="message{{if eq .Message.Type "system"}} system{{end}}" id="m{{.Message.Id}}">
+<div class="meta"><strong>{{.Message.Username}}</strong> <time datetime="{{.Time}}">{{.Time}}</time></div>
+{{if .Message.RedactedAt}}<div class="content"><em>removed by the retention policy</em></div>
+{{else}}<div class="content">{{.Html}}</div>
+{{if .Attachment}}{{if .Image}}<img src="{{.Attachment}}" alt="{{.Message.File.OriginalFilename}}">
+{{else}}<a href="{{.Attachment}}">{{.Message.File.OriginalFilename}}</a>
+{{end}}{{end}}{{end}}</div>
+`))
+
+type htmlWriter struct {
+	w          io.Writer
+	room       *models.ChatRoom
+	wroteHead  bool
+	attachment func(file *models.UploadedFile) string
+}
+
+// NewHTML writes a standalone HTML page, attachment returns the link of a file next to the page
+func NewHTML(w io.Writer, room *models.ChatRoom, attachment func(file *models.UploadedFile) string) Writer {
+	return &htmlWriter{w: w, room: room, attachment: attachment}
+}
+
+func (t *htmlWriter) writeHead() error {
+	if t.wroteHead {
+		return nil
+	}
+	t.wroteHead = true
+	return htmlHead.Execute(t.w, t.room)
+}
+
+func (t *htmlWriter) WriteMessage(msg *models.MessageResponse) error {
+	err := t.writeHead()
+	if err != nil {
+		return err
+	}
+
+	// Html is escaped by the markdown renderer, the template must not escape it again
+	data := map[string]interface{}{
+		"Message": msg,
+		"Html":    template.HTML(msg.Html),
+		"Time":    msg.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if msg.File != nil {
+		data["Attachment"] = t.attachment(msg.File)
+		data["Image"] = msg.File.ResourceType == "image"
+	}
+
+	return htmlMessage.Execute(t.w, data)
+}
+
+func (t *htmlWriter) Close() error {
+	err := t.writeHead()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(t.w, "</body>\n</html>\n")
+	return err
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// AttachmentName is the path of a file inside an export archive
+func AttachmentName(file *models.UploadedFile) string {
+	name := unsafeName.ReplaceAllString(path.Base(file.OriginalFilename), "_")
+	if name == "." || name == "_" {
+		name = "file"
+	}
+	if file.Format != "" && path.Ext(name) == "" {
+		name += "." + file.Format
+	}
+	return fmt.Sprintf("attachments/%d-%s", file.Id, name)
+}
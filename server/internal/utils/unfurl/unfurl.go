@@ -0,0 +1,254 @@
+// Package unfurl reads link previews from the OpenGraph and Twitter card tags of a page.
+// Pages are only fetched from public addresses, so a link can't reach the server's own network.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gauravst/real-time-chat/internal/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	maxRedirects      = 5
+	maxTitleLength    = 300
+	maxTextLength     = 1000
+	maxSiteNameLength = 100
+	maxUrlLength      = 2048
+)
+
+var ErrBlockedAddress = errors.New("address not allowed")
+
+// blockedPrefixes are special-purpose ranges netip doesn't flag: shared, benchmark and
+// documentation ranges, and IPv6 ranges that can embed an IPv4 address
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// IsPublic is false for loopback, private, link-local and other addresses that are not on the internet
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewClient returns a client that only connects to public addresses on port 80 and 443. The
+// address is checked when connecting, after the DNS lookup and for every redirect, so neither
+// a redirect nor a name that resolves to an internal address gets around it.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !IsPublic(ip) || (port != "80" && port != "443") {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would be the address that is checked, so none is used
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       30 * time.Second,
+			ForceAttemptHTTP2:     true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s not allowed", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// Fetcher reads previews, Client decides which addresses can be reached and MaxBytes
+// is how much of a page is read at most
+type Fetcher struct {
+	Client    *http.Client
+	MaxBytes  int64
+	UserAgent string
+}
+
+// New returns a Fetcher with a client from NewClient
+func New(timeout time.Duration, maxBytes int64, userAgent string) *Fetcher {
+	return &Fetcher{Client: NewClient(timeout), MaxBytes: maxBytes, UserAgent: userAgent}
+}
+
+// Fetch reads the preview of the page at link. The preview is not Ok when the page has
+// no title or description, an error means the page could not be read.
+func (f *Fetcher) Fetch(ctx context.Context, link string) (*models.LinkPreview, error) {
+	target, err := url.Parse(link)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid link %q", link)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("not a page: %s", mediaType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.MaxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// relative images are resolved against the page the redirects ended at
+	preview := parseHead(body, resp.Request.URL)
+	preview.Url = link
+	if preview.SiteName == "" {
+		preview.SiteName = resp.Request.URL.Hostname()
+	}
+	preview.Ok = preview.Title != "" || preview.Description != ""
+	return preview, nil
+}
+
+// parseHead reads the meta tags and title of the head, the body is never parsed
+func parseHead(r io.Reader, base *url.URL) *models.LinkPreview {
+	meta := map[string]string{}
+	title := ""
+
+	z := html.NewTokenizer(r)
+	for done := false; !done; {
+		switch z.Next() {
+		case html.ErrorToken:
+			done = true
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				done = true
+			case "title":
+				if title == "" && z.Next() == html.TextToken {
+					title = string(z.Text())
+				}
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+
+				var key, content string
+				for more := true; more; {
+					var attr, value []byte
+					attr, value, more = z.TagAttr()
+					switch string(attr) {
+					case "property", "name":
+						key = strings.ToLower(strings.TrimSpace(string(value)))
+					case "content":
+						content = string(value)
+					}
+				}
+				if _, ok := meta[key]; key != "" && !ok {
+					meta[key] = content
+				}
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				done = true
+			}
+		}
+	}
+
+	preview := &models.LinkPreview{
+		Title:       clean(first(meta["og:title"], meta["twitter:title"], title), maxTitleLength),
+		Description: clean(first(meta["og:description"], meta["twitter:description"], meta["description"]), maxTextLength),
+		SiteName:    clean(meta["og:site_name"], maxSiteNameLength),
+	}
+
+	image := first(meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])
+	if image != "" {
+		if link, err := base.Parse(strings.TrimSpace(image)); err == nil && (link.Scheme == "http" || link.Scheme == "https") {
+			if image = link.String(); len(image) <= maxUrlLength {
+				preview.ImageUrl = image
+			}
+		}
+	}
+	return preview
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and cuts text to max runes
+func clean(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
@@ -0,0 +1,224 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFetcher uses the redirect rules of NewClient with a transport that can reach the loopback test server
+func testFetcher(maxBytes int64) *Fetcher {
+	client := NewClient(5 * time.Second)
+	client.Transport = http.DefaultTransport.(*http.Transport).Clone()
+	return &Fetcher{Client: client, MaxBytes: maxBytes, UserAgent: "unfurl-test"}
+}
+
+func servePage(w http.ResponseWriter, head string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html><html><head>%s</head><body><title>not the title</title></body></html>", head)
+}
+
+func TestFetchFallbacks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<title>Page</title>
+			<meta name="twitter:title" content="Twitter">
+			<meta property="og:title" content="  Open   Graph ">
+			<meta name="description" content="Plain">
+			<meta property="og:description" content="OG description">
+			<meta property="og:site_name" content="Site">`)
+	})
+	mux.HandleFunc("/twitter", func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<title>Page</title>
+			<meta name="twitter:title" content="Twitter">
+			<meta name="description" content="Plain">
+			<meta name="twitter:description" content="Twitter description">`)
+	})
+	mux.HandleFunc("/title", func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<title>Page</title><meta name="description" content="Plain">`)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<meta charset="utf-8">`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	hostname := host[:strings.LastIndex(host, ":")]
+
+	tests := []struct {
+		path        string
+		title       string
+		description string
+		siteName    string
+		ok          bool
+	}{
+		{"/og", "Open Graph", "OG description", "Site", true},
+		{"/twitter", "Twitter", "Twitter description", hostname, true},
+		{"/title", "Page", "Plain", hostname, true},
+		{"/empty", "", "", hostname, false},
+	}
+
+	f := testFetcher(1 << 20)
+	for _, test := range tests {
+		preview, err := f.Fetch(context.Background(), srv.URL+test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if preview.Title != test.title || preview.Description != test.description || preview.SiteName != test.siteName || preview.Ok != test.ok {
+			t.Errorf("%s: got %q, %q, %q, ok %v, want %q, %q, %q, ok %v", test.path,
+				preview.Title, preview.Description, preview.SiteName, preview.Ok,
+				test.title, test.description, test.siteName, test.ok)
+		}
+		if preview.Url != srv.URL+test.path {
+			t.Errorf("%s: url = %q, want the requested link", test.path, preview.Url)
+		}
+	}
+}
+
+func TestFetchResolvesImageAfterRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/articles/post", http.StatusFound)
+	})
+	mux.HandleFunc("/articles/post", func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<meta property="og:title" content="Post"><meta property="og:image" content="images/cover.png">`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	preview, err := testFetcher(1<<20).Fetch(context.Background(), srv.URL+"/short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/articles/images/cover.png"; preview.ImageUrl != want {
+		t.Errorf("image = %q, want %q", preview.ImageUrl, want)
+	}
+	if preview.Url != srv.URL+"/short" {
+		t.Errorf("url = %q, want the shared link", preview.Url)
+	}
+}
+
+func TestFetchRejectsResponses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"no"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"/missing", "unexpected status 404"},
+		{"/image", "not a page: image/png"},
+		{"/json", "not a page: application/json"},
+	}
+
+	f := testFetcher(1 << 20)
+	for _, test := range tests {
+		_, err := f.Fetch(context.Background(), srv.URL+test.path)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: err = %v, want %q", test.path, err, test.err)
+		}
+	}
+
+	if _, err := f.Fetch(context.Background(), "ftp://example.com/file"); err == nil {
+		t.Errorf("fetching an ftp link did not fail")
+	}
+}
+
+func TestFetchStopsAtMaxBytes(t *testing.T) {
+	padding := strings.Repeat(" ", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<meta property="og:description" content="Early">`+padding+`<meta property="og:title" content="Late">`)
+	}))
+	defer srv.Close()
+
+	preview, err := testFetcher(1024).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Description != "Early" || preview.Title != "" {
+		t.Errorf("got title %q, description %q, want only the tags in the first 1024 bytes", preview.Title, preview.Description)
+	}
+
+	preview, err = testFetcher(1<<20).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Title != "Late" {
+		t.Errorf("title = %q, want Late without the limit", preview.Title)
+	}
+}
+
+func TestFetchStopsAfterRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/%d", &n)
+		if n < maxRedirects {
+			http.Redirect(w, r, fmt.Sprintf("/%d", n+1), http.StatusFound)
+			return
+		}
+		servePage(w, `<title>End</title>`)
+	}))
+	defer srv.Close()
+
+	// like the default of net/http the limit counts the requests, /1 ends after maxRedirects requests
+	f := testFetcher(1 << 20)
+	_, err := f.Fetch(context.Background(), srv.URL+"/0")
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("stopped after %d redirects", maxRedirects)) {
+		t.Errorf("err = %v, want the redirect limit", err)
+	}
+
+	preview, err := f.Fetch(context.Background(), srv.URL+"/1")
+	if err != nil || preview.Title != "End" {
+		t.Errorf("%d requests: got %v, %v, want the page", maxRedirects, preview, err)
+	}
+}
+
+func TestNewClientBlocksAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servePage(w, `<title>Internal</title>`)
+	}))
+	defer srv.Close()
+
+	links := []string{
+		srv.URL,
+		"http://127.0.0.1/",
+		"http://10.0.0.1/",
+		"http://172.16.0.1/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"http://[64:ff9b::a00:1]/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://93.184.215.14:8080/",
+		"https://93.184.215.14:22/",
+	}
+
+	client := NewClient(2 * time.Second)
+	for _, link := range links {
+		resp, err := client.Get(link)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("%s: err = %v, want ErrBlockedAddress", link, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes sent to clients when the server drops a connection. Codes in
+// the 4000-4999 range are reserved for applications by RFC 6455.
+const (
+	// CloseMessageTooBig is sent when a frame exceeds the configured read limit
+	CloseMessageTooBig = websocket.CloseMessageTooBig
+	// CloseIdleTimeout is sent when no chat message was received within the idle timeout
+	CloseIdleTimeout = 4000
+	// ClosePongTimeout is sent when the client stopped answering pings
+	ClosePongTimeout = 4001
+	// CloseSessionRevoked is sent when the login session behind the socket was revoked
+	CloseSessionRevoked = 4002
+	// CloseRoomArchived is sent when the room was archived and became read-only
+	CloseRoomArchived = 4003
+	// CloseRoomDeleted is sent when the room was deleted
+	CloseRoomDeleted = 4004
+)
+
+// StartPing sends a ping frame every interval until the returned channel is closed
+// or a ping can not be written
+func StartPing(conn *websocket.Conn, interval time.Duration, writeWait time.Duration) chan struct{} {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return stop
+}
+
+// CloseWithCode sends a close frame with the given code and closes the connection
+func CloseWithCode(conn *websocket.Conn, code int, reason string, writeWait time.Duration) {
+	message := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+	conn.Close()
+}
+
+// CloseCodeForReadError maps a read error to the close code the client should see.
+// It returns 0 when the client closed the connection itself.
+func CloseCodeForReadError(err error) (int, string) {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return CloseMessageTooBig, "message too big"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ClosePongTimeout, "pong timeout"
+	}
+
+	return 0, ""
+}
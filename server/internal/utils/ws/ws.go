@@ -3,17 +3,19 @@ package ws
 import (
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/gauravst/real-time-chat/internal/models"
 	"github.com/gorilla/websocket"
 )
 
-func BroadcastMessage(wsServer *models.WsServer, roomName string, sender *websocket.Conn, message *models.MessageResponse) {
+// BroadcastMessage sends message to the room, users in blockedBy have blocked the author and don't get it
+func BroadcastMessage(wsServer *models.WsServer, roomId int, sender *websocket.Conn, message *models.MessageResponse, blockedBy map[int]bool) {
 
 	wsServer.RoomMutex.Lock()
 	defer wsServer.RoomMutex.Unlock()
 
-	clients := wsServer.Rooms[roomName]
+	clients := wsServer.Rooms[roomId]
 
 	// Convert the message struct to JSON
 	jsonMessage, err := json.Marshal(message)
@@ -28,6 +30,132 @@ func BroadcastMessage(wsServer *models.WsServer, roomName string, sender *websoc
 			continue
 		}
 
+		if blockedBy[wsServer.ConnUsers[conn]] {
+			continue
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, jsonMessage); err != nil {
+			log.Println("Failed to send message:", err)
+		}
+	}
+}
+
+// CloseSessions closes every live connection opened with one of the given login sessions
+func CloseSessions(wsServer *models.WsServer, sessionIds []int, writeWait time.Duration) {
+	wsServer.RoomMutex.Lock()
+	var conns []*websocket.Conn
+	for _, id := range sessionIds {
+		conns = append(conns, wsServer.Sessions[id]...)
+	}
+	wsServer.RoomMutex.Unlock()
+
+	// read loops remove the connections from the rooms once they are closed
+	for _, conn := range conns {
+		CloseWithCode(conn, CloseSessionRevoked, "session revoked", writeWait)
+	}
+}
+
+// CloseApiTokens closes every live connection opened with one of the given personal access tokens
+func CloseApiTokens(wsServer *models.WsServer, apiTokenIds []int, writeWait time.Duration) {
+	wsServer.RoomMutex.Lock()
+	var conns []*websocket.Conn
+	for _, id := range apiTokenIds {
+		conns = append(conns, wsServer.ApiTokens[id]...)
+	}
+	wsServer.RoomMutex.Unlock()
+
+	for _, conn := range conns {
+		CloseWithCode(conn, CloseSessionRevoked, "token revoked", writeWait)
+	}
+}
+
+// NotifyRoom sends an event about the room itself to everyone connected to it
+func NotifyRoom(wsServer *models.WsServer, room *models.ChatRoom, eventType string) {
+	wsServer.RoomMutex.Lock()
+	defer wsServer.RoomMutex.Unlock()
+
+	notifyRoom(wsServer, room, eventType)
+}
+
+// CloseRoom tells everyone connected to the room what happened and closes their connections
+func CloseRoom(wsServer *models.WsServer, room *models.ChatRoom, eventType string, code int, reason string, writeWait time.Duration) {
+	wsServer.RoomMutex.Lock()
+	conns := notifyRoom(wsServer, room, eventType)
+	wsServer.RoomMutex.Unlock()
+
+	// read loops remove the connections from the room once they are closed
+	for _, conn := range conns {
+		CloseWithCode(conn, code, reason, writeWait)
+	}
+}
+
+// notifyRoom writes a RoomEvent to the connections of the room and returns them,
+// the caller holds RoomMutex
+func notifyRoom(wsServer *models.WsServer, room *models.ChatRoom, eventType string) []*websocket.Conn {
+	jsonMessage, err := json.Marshal(&models.RoomEvent{Type: eventType, RoomId: room.Id, Name: room.Name, Slug: room.Slug})
+	if err != nil {
+		log.Println("Failed to marshal message:", err)
+		return nil
+	}
+
+	conns := append([]*websocket.Conn(nil), wsServer.Rooms[room.Id]...)
+	for _, conn := range conns {
+		if err := conn.WriteMessage(websocket.TextMessage, jsonMessage); err != nil {
+			log.Println("Failed to send message:", err)
+		}
+	}
+
+	return conns
+}
+
+// SendToRoom sends payload to everyone connected to the room
+func SendToRoom(wsServer *models.WsServer, roomId int, payload interface{}) {
+	SendToRoomExcept(wsServer, roomId, payload, nil)
+}
+
+// SendToRoomExcept sends payload to everyone connected to the room but the users in skip
+func SendToRoomExcept(wsServer *models.WsServer, roomId int, payload interface{}, skip map[int]bool) {
+	jsonMessage, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Failed to marshal message:", err)
+		return
+	}
+
+	wsServer.RoomMutex.Lock()
+	defer wsServer.RoomMutex.Unlock()
+
+	for _, conn := range wsServer.Rooms[roomId] {
+		if skip[wsServer.ConnUsers[conn]] {
+			continue
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, jsonMessage); err != nil {
+			log.Println("Failed to send message:", err)
+		}
+	}
+}
+
+// SendToUsers sends payload to every open connection of the given users
+func SendToUsers(wsServer *models.WsServer, userIds []int, payload interface{}) {
+	jsonMessage, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Failed to marshal message:", err)
+		return
+	}
+
+	users := make(map[int]bool, len(userIds))
+	for _, id := range userIds {
+		users[id] = true
+	}
+
+	wsServer.RoomMutex.Lock()
+	defer wsServer.RoomMutex.Unlock()
+
+	for conn, userId := range wsServer.ConnUsers {
+		if !users[userId] {
+			continue
+		}
+
 		if err := conn.WriteMessage(websocket.TextMessage, jsonMessage); err != nil {
 			log.Println("Failed to send message:", err)
 		}
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_loginsession_userid;
+
+ALTER TABLE loginSession
+DROP CONSTRAINT IF EXISTS fk_loginsession_user,
+DROP COLUMN IF EXISTS deviceName,
+DROP COLUMN IF EXISTS userAgent,
+DROP COLUMN IF EXISTS ip,
+DROP COLUMN IF EXISTS lastUsedAt;
@@ -0,0 +1,17 @@
+DELETE FROM loginSession
+WHERE
+  userId NOT IN (
+    SELECT
+      id
+    FROM
+      users
+  );
+
+ALTER TABLE loginSession
+ADD COLUMN deviceName TEXT NOT NULL DEFAULT '',
+ADD COLUMN userAgent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN lastUsedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+ADD CONSTRAINT fk_loginsession_user FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX idx_loginsession_userid ON loginSession (userId);
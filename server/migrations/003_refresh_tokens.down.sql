@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS refreshTokens;
+
+DELETE FROM loginSession;
+
+ALTER TABLE loginSession
+ADD COLUMN token TEXT NOT NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE refreshTokens (
+  id SERIAL PRIMARY KEY,
+  sessionId INTEGER NOT NULL,
+  tokenHash TEXT UNIQUE NOT NULL,
+  expiresAt TIMESTAMP NOT NULL,
+  rotatedAt TIMESTAMP,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (sessionId) REFERENCES loginSession (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_refreshtokens_sessionid ON refreshTokens (sessionId);
+
+-- existing sessions only have JWT refresh tokens which can not be rotated
+DELETE FROM loginSession;
+
+ALTER TABLE loginSession
+DROP COLUMN token;
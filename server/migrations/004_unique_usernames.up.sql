@@ -0,0 +1,16 @@
+-- keep the oldest account for every username and rename the duplicates
+UPDATE users u
+SET
+  username = u.username || '_' || u.id
+WHERE
+  EXISTS (
+    SELECT
+      1
+    FROM
+      users o
+    WHERE
+      LOWER(o.username) = LOWER(u.username)
+      AND o.id < u.id
+  );
+
+CREATE UNIQUE INDEX idx_users_username ON users (LOWER(username));
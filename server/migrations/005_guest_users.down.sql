@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_guest_lastseen;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS isGuest,
+DROP COLUMN IF EXISTS lastSeenAt,
+DROP COLUMN IF EXISTS anonymizedAt;
@@ -0,0 +1,15 @@
+ALTER TABLE users
+ADD COLUMN isGuest BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN lastSeenAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN anonymizedAt TIMESTAMP;
+
+-- accounts created by loginWithoutAuth before guests were tracked
+UPDATE users
+SET
+  isGuest = TRUE
+WHERE
+  username ~ '^user_[a-zA-Z0-9]{6}$';
+
+CREATE INDEX idx_users_guest_lastseen ON users (lastSeenAt)
+WHERE
+  isGuest;
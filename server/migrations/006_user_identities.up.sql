@@ -0,0 +1,12 @@
+CREATE TABLE userIdentities (
+  id SERIAL PRIMARY KEY,
+  userId INTEGER NOT NULL,
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  email TEXT,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (provider, subject),
+  FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_useridentities_userid ON userIdentities (userId);
@@ -0,0 +1,6 @@
+ALTER TABLE loginSession
+DROP COLUMN IF EXISTS mfa;
+
+DROP TABLE IF EXISTS recoveryCodes;
+
+DROP TABLE IF EXISTS userTotp;
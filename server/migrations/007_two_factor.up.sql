@@ -0,0 +1,21 @@
+CREATE TABLE userTotp (
+  userId INTEGER PRIMARY KEY,
+  secret TEXT NOT NULL,
+  confirmedAt TIMESTAMP,
+  lastUsedStep BIGINT NOT NULL DEFAULT 0,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE recoveryCodes (
+  id SERIAL PRIMARY KEY,
+  userId INTEGER NOT NULL,
+  codeHash TEXT NOT NULL,
+  usedAt TIMESTAMP,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (userId, codeHash),
+  FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE loginSession
+ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
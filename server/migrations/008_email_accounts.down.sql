@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS emailTokens;
+
+DROP INDEX IF EXISTS idx_users_verified_email;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS emailVerifiedAt,
+DROP COLUMN IF EXISTS email;
@@ -0,0 +1,21 @@
+ALTER TABLE users
+ADD COLUMN email TEXT,
+ADD COLUMN emailVerifiedAt TIMESTAMP;
+
+-- an address can be pending on several accounts but verified on only one
+CREATE UNIQUE INDEX idx_users_verified_email ON users (LOWER(email))
+WHERE emailVerifiedAt IS NOT NULL;
+
+CREATE TABLE emailTokens (
+  id SERIAL PRIMARY KEY,
+  userId INTEGER NOT NULL,
+  purpose TEXT NOT NULL,
+  email TEXT NOT NULL,
+  tokenHash TEXT UNIQUE NOT NULL,
+  expiresAt TIMESTAMP NOT NULL,
+  usedAt TIMESTAMP,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_emailtokens_userid ON emailTokens (userId);
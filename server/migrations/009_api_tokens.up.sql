@@ -0,0 +1,14 @@
+CREATE TABLE apiTokens (
+  id SERIAL PRIMARY KEY,
+  userId INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  tokenHash TEXT UNIQUE NOT NULL,
+  scopes TEXT[] NOT NULL,
+  rooms TEXT[] NOT NULL DEFAULT '{}',
+  expiresAt TIMESTAMP,
+  lastUsedAt TIMESTAMP,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_apitokens_userid ON apiTokens (userId);
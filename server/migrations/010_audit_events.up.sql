@@ -0,0 +1,31 @@
+-- actorId has no foreign key so events outlive the users they mention
+CREATE TABLE audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  actorId INTEGER,
+  actorName TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL,
+  targetType TEXT NOT NULL,
+  targetId TEXT NOT NULL,
+  beforeData TEXT,
+  afterData TEXT,
+  ip TEXT NOT NULL DEFAULT '',
+  requestId TEXT NOT NULL DEFAULT '',
+  createdAt TIMESTAMP NOT NULL,
+  prevHash TEXT NOT NULL,
+  hash TEXT UNIQUE NOT NULL
+);
+
+CREATE INDEX idx_audit_events_action ON audit_events (action);
+CREATE INDEX idx_audit_events_actorid ON audit_events (actorId);
+CREATE INDEX idx_audit_events_target ON audit_events (targetType, targetId);
+
+-- rows are append only, the hash chain shows changes made around this trigger
+CREATE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,6 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS avatarFileId,
+DROP COLUMN IF EXISTS statusExpiresAt,
+DROP COLUMN IF EXISTS statusText,
+DROP COLUMN IF EXISTS bio,
+DROP COLUMN IF EXISTS displayName;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+ADD COLUMN displayName TEXT,
+ADD COLUMN bio TEXT,
+ADD COLUMN statusText TEXT,
+ADD COLUMN statusExpiresAt TIMESTAMP,
+ADD COLUMN avatarFileId INTEGER REFERENCES files (id) ON DELETE SET NULL;
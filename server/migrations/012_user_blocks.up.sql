@@ -0,0 +1,11 @@
+CREATE TABLE userBlocks (
+  blockerId INTEGER NOT NULL,
+  blockedId INTEGER NOT NULL,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (blockerId, blockedId),
+  CHECK (blockerId <> blockedId),
+  FOREIGN KEY (blockerId) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (blockedId) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_userblocks_blockedid ON userBlocks (blockedId);
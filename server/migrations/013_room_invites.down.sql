@@ -0,0 +1,6 @@
+ALTER TABLE groupMembers
+DROP COLUMN IF EXISTS joinedAt,
+DROP COLUMN IF EXISTS inviteId,
+DROP COLUMN IF EXISTS role;
+
+DROP TABLE IF EXISTS roomInvites;
@@ -0,0 +1,30 @@
+CREATE TABLE roomInvites (
+  id SERIAL PRIMARY KEY,
+  roomName TEXT NOT NULL,
+  code TEXT UNIQUE NOT NULL,
+  createdBy INTEGER NOT NULL,
+  role TEXT NOT NULL DEFAULT 'MEMBER',
+  maxUses INTEGER,
+  uses INTEGER NOT NULL DEFAULT 0,
+  expiresAt TIMESTAMP,
+  revokedAt TIMESTAMP,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (roomName) REFERENCES chatRoom (name) ON DELETE CASCADE,
+  FOREIGN KEY (createdBy) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_roominvites_roomname ON roomInvites (roomName);
+
+ALTER TABLE groupMembers
+ADD COLUMN role TEXT NOT NULL DEFAULT 'MEMBER',
+ADD COLUMN inviteId INTEGER REFERENCES roomInvites (id) ON DELETE SET NULL,
+ADD COLUMN joinedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE groupMembers gm
+SET
+  role = 'OWNER'
+FROM
+  chatRoom cr
+WHERE
+  cr.name = gm.roomName
+  AND cr.userId = gm.userId;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS joinRequests;
+
+ALTER TABLE chatRoom
+DROP COLUMN IF EXISTS requestToJoin;
@@ -0,0 +1,22 @@
+ALTER TABLE chatRoom
+ADD COLUMN requestToJoin BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE joinRequests (
+  id SERIAL PRIMARY KEY,
+  roomName TEXT NOT NULL,
+  userId INTEGER NOT NULL,
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  decidedBy INTEGER,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  decidedAt TIMESTAMP,
+  FOREIGN KEY (roomName) REFERENCES chatRoom (name) ON DELETE CASCADE,
+  FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (decidedBy) REFERENCES users (id) ON DELETE SET NULL
+);
+
+-- a user can only wait for one answer per room
+CREATE UNIQUE INDEX idx_joinrequests_pending ON joinRequests (roomName, userId)
+WHERE
+  status = 'PENDING';
+
+CREATE INDEX idx_joinrequests_userid ON joinRequests (userId);
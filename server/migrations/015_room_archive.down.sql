@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_messages_roomname;
+
+ALTER TABLE chatRoom
+DROP COLUMN IF EXISTS deletedAt,
+DROP COLUMN IF EXISTS archivedAt;
@@ -0,0 +1,9 @@
+ALTER TABLE chatRoom
+ADD COLUMN archivedAt TIMESTAMP,
+ADD COLUMN deletedAt TIMESTAMP;
+
+CREATE INDEX idx_chatroom_deletedat ON chatRoom (deletedAt)
+WHERE
+  deletedAt IS NOT NULL;
+
+CREATE INDEX idx_messages_roomname ON messages (roomName);
@@ -0,0 +1,108 @@
+-- fails when two rooms share a name
+ALTER TABLE chatRoom
+ADD CONSTRAINT chatroom_name_key UNIQUE (name);
+
+-- apiTokens
+ALTER TABLE apiTokens
+ADD COLUMN rooms TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE apiTokens t
+SET
+  rooms = ARRAY(
+    SELECT
+      cr.name
+    FROM
+      chatRoom cr
+    WHERE
+      cr.id = ANY (t.roomIds)
+  );
+
+ALTER TABLE apiTokens
+DROP COLUMN roomIds;
+
+-- joinRequests
+ALTER TABLE joinRequests
+ADD COLUMN roomName TEXT;
+
+UPDATE joinRequests jr
+SET
+  roomName = cr.name
+FROM
+  chatRoom cr
+WHERE
+  cr.id = jr.roomId;
+
+ALTER TABLE joinRequests
+ALTER COLUMN roomName
+SET NOT NULL,
+DROP COLUMN roomId,
+ADD FOREIGN KEY (roomName) REFERENCES chatRoom (name) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX idx_joinrequests_pending ON joinRequests (roomName, userId)
+WHERE
+  status = 'PENDING';
+
+-- roomInvites
+ALTER TABLE roomInvites
+ADD COLUMN roomName TEXT;
+
+UPDATE roomInvites ri
+SET
+  roomName = cr.name
+FROM
+  chatRoom cr
+WHERE
+  cr.id = ri.roomId;
+
+ALTER TABLE roomInvites
+ALTER COLUMN roomName
+SET NOT NULL,
+DROP COLUMN roomId,
+ADD FOREIGN KEY (roomName) REFERENCES chatRoom (name) ON DELETE CASCADE;
+
+CREATE INDEX idx_roominvites_roomname ON roomInvites (roomName);
+
+-- messages
+ALTER TABLE messages
+ADD COLUMN roomName TEXT;
+
+UPDATE messages m
+SET
+  roomName = cr.name
+FROM
+  chatRoom cr
+WHERE
+  cr.id = m.roomId;
+
+ALTER TABLE messages
+ALTER COLUMN roomName
+SET NOT NULL,
+DROP COLUMN roomId;
+
+CREATE INDEX idx_messages_roomname ON messages (roomName);
+
+-- groupMembers
+ALTER TABLE groupMembers
+ADD COLUMN roomName TEXT;
+
+UPDATE groupMembers gm
+SET
+  roomName = cr.name
+FROM
+  chatRoom cr
+WHERE
+  cr.id = gm.roomId;
+
+ALTER TABLE groupMembers
+ALTER COLUMN roomName
+SET NOT NULL,
+DROP COLUMN roomId,
+ADD FOREIGN KEY (roomName) REFERENCES chatRoom (name) ON DELETE CASCADE,
+ADD UNIQUE (userId, roomName);
+
+DROP TABLE IF EXISTS roomSlugRedirects;
+
+DROP INDEX IF EXISTS idx_chatroom_slug;
+
+ALTER TABLE chatRoom
+DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,191 @@
+-- rooms get a url slug, the name is only displayed and can change
+ALTER TABLE chatRoom
+ADD COLUMN slug TEXT;
+
+UPDATE chatRoom
+SET
+  slug = TRIM(
+    BOTH '-'
+    FROM
+      LOWER(REGEXP_REPLACE(name, '[^a-zA-Z0-9]+', '-', 'g'))
+  );
+
+-- names without usable characters get a placeholder with the id
+UPDATE chatRoom
+SET
+  slug = 'room-' || id
+WHERE
+  slug = '';
+
+-- rooms with the same slug as an older room get the id appended, until every slug is unique.
+-- a suffixed slug can match the slug of another room ("chat" of room 5 and "chat 5"), so it
+-- is checked again
+DO $$
+BEGIN
+  LOOP
+    UPDATE chatRoom cr
+    SET
+      slug = cr.slug || '-' || cr.id
+    WHERE
+      EXISTS (
+        SELECT
+          1
+        FROM
+          chatRoom o
+        WHERE
+          o.slug = cr.slug
+          AND o.id < cr.id
+      );
+
+    EXIT WHEN NOT FOUND;
+  END LOOP;
+END $$;
+
+ALTER TABLE chatRoom
+ALTER COLUMN slug
+SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_chatroom_slug ON chatRoom (slug);
+
+-- old slugs keep pointing at their room after a rename
+CREATE TABLE roomSlugRedirects (
+  slug TEXT PRIMARY KEY,
+  roomId INTEGER NOT NULL,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE
+);
+
+-- links and sockets used the room name so far
+INSERT INTO
+  roomSlugRedirects (slug, roomId)
+SELECT
+  cr.name,
+  cr.id
+FROM
+  chatRoom cr
+WHERE
+  cr.name <> cr.slug
+  AND NOT EXISTS (
+    SELECT
+      1
+    FROM
+      chatRoom o
+    WHERE
+      o.slug = cr.name
+  );
+
+-- groupMembers
+ALTER TABLE groupMembers
+ADD COLUMN roomId INTEGER;
+
+UPDATE groupMembers gm
+SET
+  roomId = cr.id
+FROM
+  chatRoom cr
+WHERE
+  cr.name = gm.roomName;
+
+ALTER TABLE groupMembers
+ALTER COLUMN roomId
+SET NOT NULL,
+DROP COLUMN roomName,
+ADD CONSTRAINT fk_groupmembers_room FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE,
+ADD CONSTRAINT groupmembers_userid_roomid_key UNIQUE (userId, roomId);
+
+-- messages
+ALTER TABLE messages
+ADD COLUMN roomId INTEGER;
+
+UPDATE messages m
+SET
+  roomId = cr.id
+FROM
+  chatRoom cr
+WHERE
+  cr.name = m.roomName;
+
+-- messages of rooms that were removed while deletion was still a hard delete
+DELETE FROM messages
+WHERE
+  roomId IS NULL;
+
+DROP INDEX IF EXISTS idx_messages_roomname;
+
+ALTER TABLE messages
+ALTER COLUMN roomId
+SET NOT NULL,
+DROP COLUMN roomName,
+ADD CONSTRAINT fk_messages_room FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE;
+
+CREATE INDEX idx_messages_roomid ON messages (roomId, createdAt);
+
+-- roomInvites
+ALTER TABLE roomInvites
+ADD COLUMN roomId INTEGER;
+
+UPDATE roomInvites ri
+SET
+  roomId = cr.id
+FROM
+  chatRoom cr
+WHERE
+  cr.name = ri.roomName;
+
+ALTER TABLE roomInvites
+ALTER COLUMN roomId
+SET NOT NULL,
+DROP COLUMN roomName,
+ADD CONSTRAINT fk_roominvites_room FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE;
+
+CREATE INDEX idx_roominvites_roomid ON roomInvites (roomId);
+
+-- joinRequests
+ALTER TABLE joinRequests
+ADD COLUMN roomId INTEGER;
+
+UPDATE joinRequests jr
+SET
+  roomId = cr.id
+FROM
+  chatRoom cr
+WHERE
+  cr.name = jr.roomName;
+
+ALTER TABLE joinRequests
+ALTER COLUMN roomId
+SET NOT NULL,
+DROP COLUMN roomName,
+ADD CONSTRAINT fk_joinrequests_room FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX idx_joinrequests_pending ON joinRequests (roomId, userId)
+WHERE
+  status = 'PENDING';
+
+-- apiTokens
+ALTER TABLE apiTokens
+ADD COLUMN roomIds INTEGER[] NOT NULL DEFAULT '{}';
+
+UPDATE apiTokens t
+SET
+  roomIds = ARRAY(
+    SELECT
+      cr.id
+    FROM
+      chatRoom cr
+    WHERE
+      cr.name = ANY (t.rooms)
+  );
+
+-- a token limited to rooms that are gone must not become a token for every room
+DELETE FROM apiTokens
+WHERE
+  CARDINALITY(rooms) > 0
+  AND CARDINALITY(roomIds) = 0;
+
+ALTER TABLE apiTokens
+DROP COLUMN rooms;
+
+-- nothing references the name anymore, rooms may share it
+ALTER TABLE chatRoom
+DROP CONSTRAINT chatroom_name_key;
@@ -0,0 +1,22 @@
+DROP INDEX IF EXISTS idx_chatroom_created;
+
+DROP INDEX IF EXISTS idx_chatroom_activity;
+
+DROP INDEX IF EXISTS idx_chatroom_members;
+
+DROP TABLE IF EXISTS roomTags;
+
+DROP TRIGGER IF EXISTS chatroom_count_messages ON messages;
+
+DROP FUNCTION IF EXISTS chatroom_count_messages();
+
+DROP TRIGGER IF EXISTS chatroom_count_members ON groupMembers;
+
+DROP FUNCTION IF EXISTS chatroom_count_members();
+
+ALTER TABLE chatRoom
+ALTER COLUMN createdAt
+DROP NOT NULL,
+DROP COLUMN IF EXISTS lastActivityAt,
+DROP COLUMN IF EXISTS messageCount,
+DROP COLUMN IF EXISTS memberCount;
@@ -0,0 +1,108 @@
+-- counts are kept on the room so discovery doesn't join members and messages
+ALTER TABLE chatRoom
+ADD COLUMN memberCount INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN messageCount INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN lastActivityAt TIMESTAMP;
+
+UPDATE chatRoom
+SET
+  createdAt = CURRENT_TIMESTAMP
+WHERE
+  createdAt IS NULL;
+
+ALTER TABLE chatRoom
+ALTER COLUMN createdAt
+SET NOT NULL;
+
+UPDATE chatRoom cr
+SET
+  memberCount = (
+    SELECT
+      COUNT(*)
+    FROM
+      groupMembers gm
+    WHERE
+      gm.roomId = cr.id
+  ),
+  messageCount = (
+    SELECT
+      COUNT(*)
+    FROM
+      messages m
+    WHERE
+      m.roomId = cr.id
+  ),
+  lastActivityAt = COALESCE(
+    (
+      SELECT
+        MAX(m.createdAt)
+      FROM
+        messages m
+      WHERE
+        m.roomId = cr.id
+    ),
+    cr.createdAt
+  );
+
+ALTER TABLE chatRoom
+ALTER COLUMN lastActivityAt
+SET DEFAULT CURRENT_TIMESTAMP,
+ALTER COLUMN lastActivityAt
+SET NOT NULL;
+
+CREATE FUNCTION chatroom_count_members() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE chatRoom SET memberCount = memberCount + 1 WHERE id = NEW.roomId;
+  ELSE
+    UPDATE chatRoom SET memberCount = memberCount - 1 WHERE id = OLD.roomId;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER chatroom_count_members
+AFTER INSERT OR DELETE ON groupMembers
+FOR EACH ROW EXECUTE FUNCTION chatroom_count_members();
+
+CREATE FUNCTION chatroom_count_messages() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE chatRoom SET messageCount = messageCount + 1, lastActivityAt = GREATEST(lastActivityAt, NEW.createdAt)
+    WHERE id = NEW.roomId;
+  ELSE
+    UPDATE chatRoom SET messageCount = messageCount - 1 WHERE id = OLD.roomId;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER chatroom_count_messages
+AFTER INSERT OR DELETE ON messages
+FOR EACH ROW EXECUTE FUNCTION chatroom_count_messages();
+
+-- tags are slugs so "Go Lang" and "go-lang" are the same tag
+CREATE TABLE roomTags (
+  roomId INTEGER NOT NULL,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (roomId, tag),
+  FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_roomtags_tag ON roomTags (tag);
+
+-- one index per sort order of the listing, the id breaks ties for the cursor
+CREATE INDEX idx_chatroom_members ON chatRoom (memberCount DESC, id DESC)
+WHERE
+  archivedAt IS NULL
+  AND deletedAt IS NULL;
+
+CREATE INDEX idx_chatroom_activity ON chatRoom (lastActivityAt DESC, id DESC)
+WHERE
+  archivedAt IS NULL
+  AND deletedAt IS NULL;
+
+CREATE INDEX idx_chatroom_created ON chatRoom (createdAt DESC, id DESC)
+WHERE
+  archivedAt IS NULL
+  AND deletedAt IS NULL;
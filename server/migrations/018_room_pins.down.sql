@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS roomPins;
+
+DELETE FROM messages
+WHERE
+  type <> 'chat';
+
+ALTER TABLE messages
+DROP COLUMN IF EXISTS type;
+
+ALTER TABLE chatRoom
+DROP COLUMN IF EXISTS topic;
@@ -0,0 +1,19 @@
+ALTER TABLE chatRoom
+ADD COLUMN topic TEXT NOT NULL DEFAULT '';
+
+-- system messages record changes to the room in its history, userId is who made them
+ALTER TABLE messages
+ADD COLUMN type TEXT NOT NULL DEFAULT 'chat';
+
+CREATE TABLE roomPins (
+  roomId INTEGER NOT NULL,
+  messageId INTEGER NOT NULL,
+  pinnedBy INTEGER,
+  pinnedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (roomId, messageId),
+  FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE,
+  FOREIGN KEY (messageId) REFERENCES messages (id) ON DELETE CASCADE,
+  FOREIGN KEY (pinnedBy) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_roompins_messageid ON roomPins (messageId);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_messages_createdat;
+
+ALTER TABLE messages
+DROP COLUMN IF EXISTS redactedAt;
+
+ALTER TABLE chatRoom
+DROP COLUMN IF EXISTS retentionDays;
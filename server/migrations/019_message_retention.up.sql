@@ -0,0 +1,11 @@
+-- days messages of the room are kept, NULL uses the server default and 0 keeps them forever
+ALTER TABLE chatRoom
+ADD COLUMN retentionDays INTEGER CHECK (retentionDays >= 0);
+
+-- redacted messages stay in the history without their content and file
+ALTER TABLE messages
+ADD COLUMN redactedAt TIMESTAMP;
+
+CREATE INDEX idx_messages_createdat ON messages (createdAt)
+WHERE
+  redactedAt IS NULL;
@@ -0,0 +1,19 @@
+CREATE TABLE roomExports (
+  id SERIAL PRIMARY KEY,
+  roomId INTEGER NOT NULL,
+  requestedBy INTEGER,
+  format TEXT NOT NULL,
+  fromTime TIMESTAMP,
+  toTime TIMESTAMP,
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  path TEXT NOT NULL DEFAULT '',
+  size BIGINT NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  startedAt TIMESTAMP,
+  finishedAt TIMESTAMP,
+  FOREIGN KEY (roomId) REFERENCES chatRoom (id) ON DELETE CASCADE,
+  FOREIGN KEY (requestedBy) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_roomexports_status ON roomExports (status, createdAt);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS importedObjects;
+
+DROP TABLE IF EXISTS imports;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS isPlaceholder;
@@ -0,0 +1,31 @@
+-- users created for authors of imported messages who have no account here
+ALTER TABLE users
+ADD COLUMN isPlaceholder BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE imports (
+  id SERIAL PRIMARY KEY,
+  source TEXT NOT NULL,
+  path TEXT NOT NULL,
+  requestedBy INTEGER,
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  rooms INTEGER NOT NULL DEFAULT 0,
+  users INTEGER NOT NULL DEFAULT 0,
+  messages INTEGER NOT NULL DEFAULT 0,
+  files INTEGER NOT NULL DEFAULT 0,
+  skipped INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  startedAt TIMESTAMP,
+  finishedAt TIMESTAMP,
+  FOREIGN KEY (requestedBy) REFERENCES users (id) ON DELETE SET NULL
+);
+
+-- rooms and messages created by imports, keyed by their id in the source, so running
+-- an import again only adds what is missing. Users are linked through userIdentities.
+CREATE TABLE importedObjects (
+  source TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  externalId TEXT NOT NULL,
+  localId INTEGER NOT NULL,
+  PRIMARY KEY (source, kind, externalId)
+);
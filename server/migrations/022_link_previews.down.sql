@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS messagePreviews;
+
+DROP TABLE IF EXISTS linkPreviews;
+
+ALTER TABLE chatRoom
+DROP COLUMN IF EXISTS unfurlLinks;
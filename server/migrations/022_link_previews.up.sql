@@ -0,0 +1,25 @@
+ALTER TABLE chatRoom
+ADD COLUMN unfurlLinks BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- previews are cached by url, failed fetches too so they are not retried until the entry is stale
+CREATE TABLE linkPreviews (
+  url TEXT PRIMARY KEY,
+  ok BOOLEAN NOT NULL,
+  title TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  siteName TEXT NOT NULL DEFAULT '',
+  imageUrl TEXT NOT NULL DEFAULT '',
+  fetchedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE messagePreviews (
+  messageId INTEGER NOT NULL,
+  url TEXT NOT NULL,
+  position INTEGER NOT NULL,
+  PRIMARY KEY (messageId, url),
+  FOREIGN KEY (messageId) REFERENCES messages (id) ON DELETE CASCADE,
+  FOREIGN KEY (url) REFERENCES linkPreviews (url) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_messagepreviews_url ON messagePreviews (url);
+CREATE INDEX idx_linkpreviews_fetchedat ON linkPreviews (fetchedAt);
@@ -0,0 +1,13 @@
+-- thumbnails of uploaded images, they go with their file
+CREATE TABLE fileVariants (
+  fileId INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  publicId TEXT NOT NULL,
+  secureUrl TEXT NOT NULL,
+  format TEXT NOT NULL,
+  size DOUBLE PRECISION NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  PRIMARY KEY (fileId, name),
+  FOREIGN KEY (fileId) REFERENCES files (id) ON DELETE CASCADE
+);
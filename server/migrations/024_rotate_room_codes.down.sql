@@ -0,0 +1 @@
+-- the old room codes are not kept, rooms keep their new codes
@@ -0,0 +1,8 @@
+-- room codes made before 013 have 5 characters and can be guessed, they get 20 random hex
+-- characters (80 bits) instead. gen_random_uuid uses a strong random source, random() doesn't.
+UPDATE chatRoom
+SET
+  code = LEFT(ENCODE(SHA256((gen_random_uuid()::TEXT || gen_random_uuid()::TEXT)::BYTEA), 'hex'), 20)
+WHERE
+  code IS NOT NULL
+  AND LENGTH(code) < 12;